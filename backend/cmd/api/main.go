@@ -2,56 +2,212 @@ package main
 
 import (
 	"context"
-	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net"
 	"net/http"
+	"os"
+	"strings"
+	"test/portal/internal/proxy"
+	"test/portal/internal/proxy/accesslog"
+	"test/portal/internal/proxy/cache"
+	"test/portal/internal/proxy/drain"
+	"test/portal/internal/proxy/forwarding"
+	proxymetrics "test/portal/internal/proxy/metrics"
+	"test/portal/internal/proxy/stream"
 	routedelivery "test/portal/internal/route/delivery/http"
+	"test/portal/internal/route/expiry"
+	routemetrics "test/portal/internal/route/metrics"
 	routeyamlrepository "test/portal/internal/route/repository/yaml"
+	"test/portal/internal/route/schedule"
 	routeusecase "test/portal/internal/route/usecase"
+	"test/portal/pkg/envutils"
+	"test/portal/pkg/httputils"
+	"test/portal/pkg/iputils"
+	"test/portal/pkg/logutils"
+	"test/portal/pkg/traceutils"
 	"test/portal/pkg/validations"
+	"time"
+	// Route schedules use IANA time zones, the runtime image has no zone database
+	_ "time/tzdata"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 type App struct{}
 
+// Address of the management API
+const webAddr = ":8080"
+
+// Bound the flush of the buffered spans and logs on exit
+const shutdownTimeout = 5 * time.Second
+
+// Registered as the dependencies are initiated, run by fatal in reverse order
+var shutdownHooks []func(context.Context) error
+
 func newApp() App {
 	return App{}
 }
 
 func (*App) start(ctx context.Context) {
+	// Initiate logger, sensitive fields are redacted
+	logger, err := logutils.NewLogger(os.Stderr, envutils.GetString("LOG_LEVEL", "info"), envutils.GetString("LOG_FORMAT", "text"))
+	if err != nil {
+		fatal("Invalid logger settings", err)
+	}
+	slog.SetDefault(logger)
+
+	// Initiate tracing, exported to stdout or an OTLP collector
+	shutdown, err := traceutils.Setup(ctx, envutils.GetString("TRACE_EXPORTER", "none"), envutils.GetString("OTEL_SERVICE_NAME", "route-portal"))
+	if err != nil {
+		fatal("Failed initiate tracing", err)
+	}
+	shutdownHooks = append(shutdownHooks, shutdown)
+
 	// Initiate all dependencies
 	// Initiate repository
-	routeRepo := routeyamlrepository.NewRouteYamlRepository()
+	routeMetrics := routemetrics.New(prometheus.DefaultRegisterer)
+	routeRepo := routeyamlrepository.NewInstrumentedRouteYamlRepository(routeMetrics)
+	streamRepo := routeyamlrepository.NewInstrumentedStreamRouteYamlRepository(routeMetrics)
 
-	// Initiate usecase
-	routeUsecase := routeusecase.NewRouteUsecase(routeRepo)
+	// Initiate usecase, static routes serve directories under STATIC_ROOT.
+	// Disabled and deleted routes keep their requests for DRAIN_GRACE_SECONDS,
+	// backends can't point back at the proxy or the web service and stream
+	// routes can't listen on their ports
+	proxyAddr := envutils.GetString("PROXY_ADDR", ":8000")
+	routeusecase.StaticRoot = envutils.GetString("STATIC_ROOT", routeusecase.StaticRoot)
+	drainTracker := drain.New(time.Duration(envutils.GetInt64("DRAIN_GRACE_SECONDS", 30)) * time.Second)
+	routeUsecase := routeusecase.NewConfiguredRouteUsecase(routeRepo, routeusecase.Config{
+		Drainer:       drainTracker,
+		ExpiryWarning: time.Duration(envutils.GetInt64("EXPIRY_WARNING_HOURS", 24)) * time.Hour,
+		ListenAddrs:   []string{proxyAddr, webAddr},
+	})
+	streamUsecase := routeusecase.NewConfiguredStreamRouteUsecase(streamRepo, routeusecase.StreamConfig{
+		ListenAddrs: []string{proxyAddr, webAddr},
+	})
+
+	// Routes entering or leaving their schedule are checked every SCHEDULE_INTERVAL_SECONDS
+	routeScheduler := schedule.NewScheduler(routeUsecase, drainTracker)
+	go routeScheduler.Run(ctx, time.Duration(envutils.GetInt64("SCHEDULE_INTERVAL_SECONDS", 10))*time.Second)
+	// Expired routes are disabled or deleted every REAPER_INTERVAL_SECONDS
+	go expiry.NewReaper(routeUsecase).Run(ctx, time.Duration(envutils.GetInt64("REAPER_INTERVAL_SECONDS", 60))*time.Second)
 
 	// Initiate custom validator dependencies
 	customValidator := validator.New()
 	if err := customValidator.RegisterValidation("is_valid_name", validations.IsValidName); err != nil {
-		log.Println("Failed initiate validator is_valid_name", err)
+		slog.Warn("Failed initiate validator", "validator", "is_valid_name", "error", err)
 	}
 	if err := customValidator.RegisterValidation("is_valid_path", validations.IsValidPath); err != nil {
-		log.Println("Failed initiate validator is_valid_path", err)
+		slog.Warn("Failed initiate validator", "validator", "is_valid_path", "error", err)
 	}
 	if err := customValidator.RegisterValidation("is_valid_host", validations.IsValidHostName); err != nil {
-		log.Println("Failed initiate validator is_valid_host", err)
+		slog.Warn("Failed initiate validator", "validator", "is_valid_host", "error", err)
 	}
 	if err := customValidator.RegisterValidation("is_valid_backend_url", validations.IsValidBackendUrl); err != nil {
-		log.Println("Failed initiate validator is_valid_backend_url", err)
+		slog.Warn("Failed initiate validator", "validator", "is_valid_backend_url", "error", err)
+	}
+	if err := customValidator.RegisterValidation("is_valid_cidr", validations.IsValidCIDR); err != nil {
+		slog.Warn("Failed initiate validator", "validator", "is_valid_cidr", "error", err)
+	}
+	if err := customValidator.RegisterValidation("is_valid_header_name", validations.IsValidHeaderName); err != nil {
+		slog.Warn("Failed initiate validator", "validator", "is_valid_header_name", "error", err)
 	}
+	if err := customValidator.RegisterValidation("is_valid_sni_host", validations.IsValidSNIHost); err != nil {
+		slog.Warn("Failed initiate validator", "validator", "is_valid_sni_host", "error", err)
+	}
+
+	// Initiate proxy response cache
+	responseCache := cache.New(cache.NewMemoryStore(envutils.GetInt64("CACHE_MAX_BYTES", 64<<20)), time.Now)
 
 	// Initiate delivery
-	routedelivery.NewRouteDelivery(ctx, customValidator, routeUsecase)
+	httputils.MaxBodyBytes = envutils.GetInt64("API_MAX_BODY_BYTES", httputils.MaxBodyBytes)
+	routedelivery.NewRouteDelivery(ctx, customValidator, routeUsecase, routeMetrics)
+	routedelivery.NewRouteCacheDelivery(ctx, responseCache)
+	routedelivery.NewStreamRouteDelivery(ctx, customValidator, streamUsecase, routeMetrics)
 	// Health
 	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("Uk0tMjAyNS0xMC1BTDdRMuKAjAo="))
 	})
 
-	fmt.Println("Start The Web Service on port :8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	// Initiate proxy, serve the routes traffic on its own listener
+	trustedProxies, err := iputils.ParsePrefixes(envutils.GetList("TRUSTED_PROXIES"))
+	if err != nil {
+		fatal("Invalid TRUSTED_PROXIES", err)
+	}
+	accessLogFormat, err := accesslog.ParseFormat(envutils.GetString("ACCESS_LOG_FORMAT", string(accesslog.FormatJSON)))
+	if err != nil {
+		fatal("Invalid ACCESS_LOG_FORMAT", err)
+	}
+	accessLogOutput := io.Writer(os.Stdout)
+	if path := envutils.GetString("ACCESS_LOG_FILE", ""); path != "" {
+		accessLogFile, err := accesslog.OpenFile(path, envutils.GetInt64("ACCESS_LOG_MAX_BYTES", 100<<20), int(envutils.GetInt64("ACCESS_LOG_MAX_BACKUPS", 5)))
+		if err != nil {
+			fatal("Failed open access log file", err)
+		}
+		shutdownHooks = append(shutdownHooks, func(context.Context) error { return accessLogFile.Close() })
+		accessLogOutput = accessLogFile
+	}
+	routeProxy := proxy.NewProxy(routeUsecase, proxy.Config{
+		TrustedProxies: trustedProxies,
+		Cache:          responseCache,
+		AccessLog:      accesslog.New(accessLogOutput, accessLogFormat, rand.Float64),
+		Metrics:        proxymetrics.New(prometheus.DefaultRegisterer),
+		StaticRoot:     routeusecase.StaticRoot,
+		Drain:          drainTracker,
+		ViaName:        envutils.GetString("PROXY_VIA_NAME", instanceViaName()),
+		MaxLoopHops:    int(envutils.GetInt64("PROXY_MAX_LOOP_HOPS", 1)),
+	})
+	prometheus.MustRegister(proxymetrics.NewStateCollector(routeUsecase, routeProxy))
+	http.Handle("/metrics", promhttp.Handler())
+	proxyListener, err := net.Listen("tcp", proxyAddr)
+	if err != nil {
+		fatal("Failed listen proxy address", err)
+	}
+	if envutils.GetBool("PROXY_PROTOCOL", false) {
+		// Trusted load balancers may prepend the PROXY protocol header
+		proxyListener = forwarding.NewListener(proxyListener, trustedProxies)
+	}
+	// Stream routes listen on their own ports, synced with the stored routes
+	streamProxy := stream.NewProxy(streamUsecase, stream.Config{
+		ListenHost:  envutils.GetString("STREAM_LISTEN_HOST", ""),
+		IdleTimeout: time.Duration(envutils.GetInt64("STREAM_IDLE_TIMEOUT_SECONDS", 300)) * time.Second,
+	})
+	go streamProxy.Run(ctx, time.Duration(envutils.GetInt64("STREAM_SYNC_INTERVAL_SECONDS", 5))*time.Second)
+
+	go func() {
+		slog.Info("Start the proxy", "addr", proxyAddr)
+		fatal("Proxy stopped", http.Serve(proxyListener, httputils.RequestID(routeProxy)))
+	}()
+
+	slog.Info("Start the web service", "addr", webAddr)
+	fatal("Web service stopped", http.ListenAndServe(webAddr, httputils.RequestID(httputils.LogRequests(http.DefaultServeMux))))
+}
+
+// Via pseudonym unique to the instance, portals chained on purpose (edge then
+// internal) each count their own hops instead of taking the other for a loop
+func instanceViaName() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		return ""
+	}
+	return "route-portal-" + strings.ToLower(hostname)
+}
+
+// Run the shutdown hooks before exiting, os.Exit skip the deferred calls
+func fatal(message string, err error) {
+	slog.Error(message, "error", err)
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	for i := len(shutdownHooks) - 1; i >= 0; i-- {
+		if err := shutdownHooks[i](ctx); err != nil {
+			slog.Error("Failed shutdown", "error", err)
+		}
+	}
+	cancel()
+	os.Exit(1)
 }
 
 func main() {
@@ -0,0 +1,7 @@
+package domain
+
+type RouteAccessLog struct {
+	Enabled bool `json:"enabled"`
+	// Share of the requests written to the access log, 0 log every request
+	SampleRate float64 `json:"sampleRate,omitempty" yaml:"sampleRate,omitempty" validate:"gte=0,lte=1"`
+}
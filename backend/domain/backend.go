@@ -0,0 +1,47 @@
+package domain
+
+type RouteBackend struct {
+	URL string           `json:"url" validate:"required,min=5,is_valid_backend_url"`
+	TLS *RouteBackendTLS `json:"tls,omitempty" yaml:"tls,omitempty"`
+}
+
+// TLS settings of an https backend, files are read on the proxy host
+type RouteBackendTLS struct {
+	// PEM bundle of the CA trusted for the backend certificate, system roots when empty
+	CAFile string `json:"caFile,omitempty" yaml:"caFile,omitempty"`
+	// Client certificate and key presented to backends requiring mTLS
+	ClientCertFile string `json:"clientCertFile,omitempty" yaml:"clientCertFile,omitempty" validate:"required_with=ClientKeyFile"`
+	ClientKeyFile  string `json:"clientKeyFile,omitempty" yaml:"clientKeyFile,omitempty" validate:"required_with=ClientCertFile"`
+	// Name verified against the backend certificate and sent as SNI
+	ServerName string `json:"serverName,omitempty" yaml:"serverName,omitempty" validate:"omitempty,is_valid_host"`
+	MinVersion string `json:"minVersion,omitempty" yaml:"minVersion,omitempty" validate:"omitempty,oneof=1.0 1.1 1.2 1.3"`
+	// Disable the certificate verification, only meant for testing
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty" yaml:"insecureSkipVerify,omitempty"`
+}
+
+// Session affinity pin a client to one backend of the route
+type RouteAffinity struct {
+	// cookie: the proxy issue a cookie naming the backend
+	// header: the value of a request header select the backend
+	Mode string `json:"mode" validate:"required,oneof=cookie header"`
+
+	CookieName       string `json:"cookieName,omitempty" yaml:"cookieName,omitempty" validate:"omitempty,max=64,is_valid_header_name"`
+	CookieTTLSeconds int    `json:"cookieTtlSeconds,omitempty" yaml:"cookieTtlSeconds,omitempty" validate:"gte=0"`
+	CookieSecure     bool   `json:"cookieSecure,omitempty" yaml:"cookieSecure,omitempty"`
+	CookieHTTPOnly   bool   `json:"cookieHttpOnly,omitempty" yaml:"cookieHttpOnly,omitempty"`
+	CookieSameSite   string `json:"cookieSameSite,omitempty" yaml:"cookieSameSite,omitempty" validate:"omitempty,oneof=lax strict none"`
+
+	HeaderName string `json:"headerName,omitempty" yaml:"headerName,omitempty" validate:"required_if=Mode header,omitempty,is_valid_header_name"`
+}
+
+// Targets return the backends serving the route, the single Backend URL
+// when no backend list is configured and none for a static route
+func (r RouteItem) Targets() []RouteBackend {
+	if r.Static != nil {
+		return nil
+	}
+	if len(r.Backends) > 0 {
+		return r.Backends
+	}
+	return []RouteBackend{{URL: r.Backend}}
+}
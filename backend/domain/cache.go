@@ -0,0 +1,25 @@
+package domain
+
+import "context"
+
+type RouteCachePolicy struct {
+	Enabled bool `json:"enabled"`
+	// Freshness of the cached responses when the backend doesn't set one
+	DefaultTTLSeconds int `json:"defaultTtlSeconds" yaml:"defaultTtlSeconds" validate:"gte=0"`
+	// Honor Cache-Control and Expires from the client and the backend
+	RespectCacheControl bool `json:"respectCacheControl" yaml:"respectCacheControl"`
+	// Request headers that are part of the cache key
+	VaryHeaders []string `json:"varyHeaders,omitempty" yaml:"varyHeaders,omitempty" validate:"omitempty,dive,is_valid_header_name"`
+	// Larger responses are streamed to the client without being stored, 0 use the default
+	MaxObjectSizeBytes int64 `json:"maxObjectSizeBytes" yaml:"maxObjectSizeBytes" validate:"gte=0"`
+}
+
+type CachePurgeResult struct {
+	Purged int `json:"purged"`
+}
+
+type RouteCachePurger interface {
+	// Purge drop the cached responses of the route (every route when empty)
+	// whose path start with the prefix, it return the number of entries removed
+	Purge(ctx context.Context, routeName string, pathPrefix string) int
+}
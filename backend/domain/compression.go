@@ -0,0 +1,11 @@
+package domain
+
+type RouteCompressionPolicy struct {
+	Enabled bool `json:"enabled"`
+	// Encodings offered to the client in order of preference, gzip and br
+	Algorithms []string `json:"algorithms,omitempty" yaml:"algorithms,omitempty" validate:"omitempty,dive,oneof=gzip br"`
+	// Smaller responses are sent as is
+	MinSizeBytes int64 `json:"minSizeBytes" yaml:"minSizeBytes" validate:"gte=0"`
+	// Media types to compress (text/* wildcard allowed), empty use the default text types
+	ContentTypes []string `json:"contentTypes,omitempty" yaml:"contentTypes,omitempty" validate:"omitempty,dive,required"`
+}
@@ -0,0 +1,23 @@
+package domain
+
+import "time"
+
+// Traffic a disabled or deleted route is still serving, kept until the
+// requests end or the grace period is over
+type RouteDrainStatus struct {
+	Draining bool       `json:"draining"`
+	Since    *time.Time `json:"since,omitempty"`
+	// In-flight requests and upgraded connections left are cancelled at the deadline
+	Deadline            *time.Time `json:"deadline,omitempty"`
+	InFlightRequests    int        `json:"inFlightRequests"`
+	UpgradedConnections int        `json:"upgradedConnections"`
+}
+
+type RouteDrainer interface {
+	// Drain start the grace period of the traffic of the route
+	Drain(routeName string)
+	// CancelDrain stop draining a route enabled again
+	CancelDrain(routeName string)
+	// DrainStatus return nil when the route isn't draining anymore
+	DrainStatus(routeName string) *RouteDrainStatus
+}
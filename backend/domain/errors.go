@@ -2,9 +2,18 @@ package domain
 
 var (
 	// Error made by client
-	ErrBadRequest = `400:Bad Request`
-	ErrNotFound   = `404:Not Found`
+	ErrBadRequest       = `400:Bad Request`
+	ErrForbidden        = `403:Forbidden`
+	ErrNotFound         = `404:Not Found`
+	ErrMethodNotAllowed = `405:Method Not Allowed`
+
+	ErrPayloadTooLarge      = `413:Payload Too Large`
+	ErrUnsupportedMediaType = `415:Unsupported Media Type`
+	ErrHeaderTooLarge       = `431:Request Header Fields Too Large`
 
 	// Server
 	ErrInternalServer = `500:Internal Server Error`
+	ErrBadGateway     = `502:Bad Gateway`
+	ErrUnavailable    = `503:Service Unavailable`
+	ErrLoopDetected   = `508:Loop Detected`
 )
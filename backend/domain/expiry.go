@@ -0,0 +1,25 @@
+package domain
+
+import "time"
+
+// What the reaper do with an expired route
+const (
+	RouteExpiryDisable = "disable"
+	RouteExpiryDelete  = "delete"
+)
+
+// Computed when the route is read
+type RouteExpiryStatus struct {
+	Expired bool `json:"expired"`
+	// 0 once expired
+	ExpiresInSeconds int64 `json:"expiresInSeconds"`
+	// Set inside the warning window before the expiry
+	Warning string `json:"warning,omitempty"`
+}
+
+// Payload of PUT /routes/{name}/expiry, a new expiry or a duration added to
+// the current one (to now when already expired)
+type RouteExpiryExtension struct {
+	ExpiresAt     *time.Time `json:"expiresAt,omitempty" validate:"required_without=ExtendSeconds,excluded_with=ExtendSeconds"`
+	ExtendSeconds int64      `json:"extendSeconds,omitempty" validate:"gte=0"`
+}
@@ -0,0 +1,27 @@
+package domain
+
+import "time"
+
+/*
+Faults injected by the proxy to test how clients cope with a slow or failing
+backend. Enabling it require an expiry so a forgotten experiment stop by itself.
+*/
+type RouteFaultInjection struct {
+	Enabled   bool             `json:"enabled"`
+	ExpiresAt *time.Time       `json:"expiresAt,omitempty" yaml:"expiresAt,omitempty" validate:"required_if=Enabled true"`
+	Delay     *RouteFaultDelay `json:"delay,omitempty" yaml:"delay,omitempty" validate:"required_without=Abort"`
+	Abort     *RouteFaultAbort `json:"abort,omitempty" yaml:"abort,omitempty"`
+	// Only requests carrying the header, with the value when set, get the faults
+	HeaderName  string `json:"headerName,omitempty" yaml:"headerName,omitempty" validate:"required_with=HeaderValue,omitempty,is_valid_header_name"`
+	HeaderValue string `json:"headerValue,omitempty" yaml:"headerValue,omitempty"`
+}
+
+type RouteFaultDelay struct {
+	DurationMs int     `json:"durationMs" yaml:"durationMs" validate:"gt=0,lte=60000"`
+	Percentage float64 `json:"percentage" yaml:"percentage" validate:"gt=0,lte=100"`
+}
+
+type RouteFaultAbort struct {
+	StatusCode int     `json:"statusCode" yaml:"statusCode" validate:"gte=400,lte=599"`
+	Percentage float64 `json:"percentage" yaml:"percentage" validate:"gt=0,lte=100"`
+}
@@ -0,0 +1,11 @@
+package domain
+
+type RouteLoadBalancing struct {
+	// round_robin spread the requests evenly, consistent_hash keep the same
+	// key on the same backend with minimal reshuffling when backends change
+	Strategy string `json:"strategy" validate:"required,oneof=round_robin consistent_hash"`
+	// Part of the request the hash key is read from
+	HashOn string `json:"hashOn,omitempty" yaml:"hashOn,omitempty" validate:"required_if=Strategy consistent_hash,omitempty,oneof=header cookie query client_ip"`
+	// Header, cookie or query parameter name, unused for client_ip
+	HashKey string `json:"hashKey,omitempty" yaml:"hashKey,omitempty" validate:"required_if=HashOn header,required_if=HashOn cookie,required_if=HashOn query,omitempty,max=64"`
+}
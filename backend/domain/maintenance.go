@@ -0,0 +1,14 @@
+package domain
+
+type RouteMaintenance struct {
+	Enabled bool `json:"enabled"`
+	// Optional page returned instead of the standard JSON error
+	ContentType string `json:"contentType,omitempty" yaml:"contentType,omitempty" validate:"required_with=Body,omitempty,oneof=text/html application/json"`
+	Body        string `json:"body,omitempty" yaml:"body,omitempty" validate:"max=65536"`
+	// Sent as Retry-After, 0 omit the header
+	RetryAfterSeconds int `json:"retryAfterSeconds,omitempty" yaml:"retryAfterSeconds,omitempty" validate:"gte=0"`
+	// Clients still reaching the backend, by address or with the bypass header
+	BypassCIDRs       []string `json:"bypassCidrs,omitempty" yaml:"bypassCidrs,omitempty" validate:"omitempty,dive,is_valid_cidr"`
+	BypassHeader      string   `json:"bypassHeader,omitempty" yaml:"bypassHeader,omitempty" validate:"required_with=BypassHeaderValue,omitempty,is_valid_header_name"`
+	BypassHeaderValue string   `json:"bypassHeaderValue,omitempty" yaml:"bypassHeaderValue,omitempty" validate:"required_with=BypassHeader"`
+}
@@ -0,0 +1,42 @@
+package domain
+
+// Trailing slash policies of the path matching
+const (
+	TrailingSlashIgnore   = "ignore"
+	TrailingSlashStrict   = "strict"
+	TrailingSlashRedirect = "redirect"
+)
+
+// How the request path is compared to the route path, the zero value match
+// the path as received
+type RoutePathMatching struct {
+	// Literal segments ignore the ASCII case, captured parameters keep it
+	CaseInsensitive bool `json:"caseInsensitive,omitempty" yaml:"caseInsensitive,omitempty"`
+	// ignore (default) serve /api and /api/ alike, strict only serve the form
+	// of the route path and redirect send the other form to it
+	TrailingSlash string `json:"trailingSlash,omitempty" yaml:"trailingSlash,omitempty" validate:"omitempty,oneof=ignore strict redirect"`
+	// Runs of slashes count as one, /api//users match /api/users
+	MergeSlashes bool `json:"mergeSlashes,omitempty" yaml:"mergeSlashes,omitempty"`
+	// Match the percent-decoded path, %2F, %5C and %25 excepted. Paths with
+	// encoded control characters, invalid UTF-8 or dot segments don't match
+	DecodePercent bool `json:"decodePercent,omitempty" yaml:"decodePercent,omitempty"`
+}
+
+// Route serving a request, reported by GET /match
+type RouteMatch struct {
+	Route *RouteItem `json:"route"`
+	// Parameters of the path template, the wildcard segments under "*"
+	Params map[string]string `json:"params,omitempty"`
+	// Escaped request path after normalization, forwarded to the backend
+	Path string `json:"path"`
+	// Location the request is redirected to by the trailing slash policy
+	Redirect string `json:"redirect,omitempty"`
+
+	// Request path left after the route path, empty with a wildcard. Like the
+	// parameters it's percent-decoded as far as the route decode the path
+	Rest string `json:"-"`
+	// Rebuild of the route index the request was matched against, growing
+	// with each rebuild, and the names of the routes it holds (read only)
+	Generation uint64   `json:"-"`
+	RouteNames []string `json:"-"`
+}
@@ -1,13 +1,69 @@
 package domain
 
-import "context"
+import (
+	"context"
+	"net/url"
+	"time"
+)
 
 type RouteItem struct {
 	Name    string `json:"name" validate:"required,min=3,max=32,is_valid_name"`
 	Host    string `json:"host" validate:"required,min=5,is_valid_host"`
 	Path    string `json:"path" validate:"required,is_valid_path"`
-	Backend string `json:"backend" validate:"required,min=5,is_valid_backend_url"`
+	Backend string `json:"backend" validate:"required_without_all=Backends Static,excluded_with=Backends Static,omitempty,min=5,is_valid_backend_url"`
 	Enabled *bool  `json:"enabled" validate:"required"`
+
+	// Several backends replace Backend, requests are balanced between them
+	Backends      []RouteBackend      `json:"backends,omitempty" yaml:"backends,omitempty" validate:"omitempty,dive"`
+	Affinity      *RouteAffinity      `json:"affinity,omitempty" yaml:"affinity,omitempty"`
+	LoadBalancing *RouteLoadBalancing `json:"loadBalancing,omitempty" yaml:"loadBalancing,omitempty"`
+
+	// Client IP ranges in CIDR notation, deny always wins over allow.
+	// When AllowCIDRs is set only clients inside one of the ranges are served.
+	AllowCIDRs []string `json:"allowCidrs,omitempty" yaml:"allowCidrs,omitempty" validate:"omitempty,dive,is_valid_cidr"`
+	DenyCIDRs  []string `json:"denyCidrs,omitempty" yaml:"denyCidrs,omitempty" validate:"omitempty,dive,is_valid_cidr"`
+
+	// Opt out of sending Forwarded and X-Forwarded-* headers to the backend
+	DisableForwardedHeaders bool `json:"disableForwardedHeaders,omitempty" yaml:"disableForwardedHeaders,omitempty"`
+
+	// Path sent to the backend instead of the request path, {name} and {*}
+	// reference the parameters captured by Path. The request path left after
+	// Path is appended
+	RewritePath string `json:"rewritePath,omitempty" yaml:"rewritePath,omitempty" validate:"omitempty,startswith=/"`
+	// Headers set on the forwarded request, values may reference the parameters
+	RequestHeaders map[string]string `json:"requestHeaders,omitempty" yaml:"requestHeaders,omitempty" validate:"omitempty,dive,keys,is_valid_header_name,endkeys,max=1024"`
+	// Normalization of the request path before matching, the normalized path
+	// is the one forwarded
+	PathMatching *RoutePathMatching `json:"pathMatching,omitempty" yaml:"pathMatching,omitempty"`
+
+	// Request limits enforced before forwarding, 0 or empty mean unlimited
+	MaxRequestBodyBytes   int64    `json:"maxRequestBodyBytes,omitempty" yaml:"maxRequestBodyBytes,omitempty" validate:"gte=0"`
+	MaxRequestHeaderBytes int64    `json:"maxRequestHeaderBytes,omitempty" yaml:"maxRequestHeaderBytes,omitempty" validate:"gte=0"`
+	AllowedContentTypes   []string `json:"allowedContentTypes,omitempty" yaml:"allowedContentTypes,omitempty" validate:"omitempty,dive,required"`
+
+	Maintenance *RouteMaintenance       `json:"maintenance,omitempty" yaml:"maintenance,omitempty"`
+	Cache       *RouteCachePolicy       `json:"cache,omitempty" yaml:"cache,omitempty"`
+	Compression *RouteCompressionPolicy `json:"compression,omitempty" yaml:"compression,omitempty"`
+	AccessLog   *RouteAccessLog         `json:"accessLog,omitempty" yaml:"accessLog,omitempty"`
+	Faults      *RouteFaultInjection    `json:"faults,omitempty" yaml:"faults,omitempty"`
+
+	// Serve files from disk, replace Backend and Backends
+	Static *RouteStatic `json:"static,omitempty" yaml:"static,omitempty" validate:"omitempty,excluded_with=Backend Backends"`
+
+	// Served only inside the schedule, the route stay enabled outside of it
+	Schedule *RouteSchedule `json:"schedule,omitempty" yaml:"schedule,omitempty"`
+
+	// Temporary route, stop being served at ExpiresAt then disabled (default)
+	// or deleted by the reaper
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty" yaml:"expiresAt,omitempty"`
+	ExpiryPolicy string     `json:"expiryPolicy,omitempty" yaml:"expiryPolicy,omitempty" validate:"omitempty,oneof=disable delete"`
+
+	// Computed when the route is read, never stored. EffectiveState is
+	// active, inactive (outside the schedule), expired or disabled, Drain is
+	// reported while a route not active still serve requests
+	EffectiveState string             `json:"effectiveState,omitempty" yaml:"-" validate:"-"`
+	Drain          *RouteDrainStatus  `json:"drain,omitempty" yaml:"-" validate:"-"`
+	Expiry         *RouteExpiryStatus `json:"expiry,omitempty" yaml:"-" validate:"-"`
 }
 
 type RouteItemRepository interface {
@@ -16,6 +72,9 @@ type RouteItemRepository interface {
 	GetAll(ctx context.Context) ([]RouteItem, error)
 	GetOne(ctx context.Context, name string) (*RouteItem, error)
 	Delete(ctx context.Context, name string) error
+	// Version change whenever the stored routes change, cheap enough to be
+	// checked on every request
+	Version(ctx context.Context) (string, error)
 }
 
 type RouteItemUsecase interface {
@@ -24,4 +83,12 @@ type RouteItemUsecase interface {
 	GetAll(ctx context.Context) ([]RouteItem, error)
 	GetOne(ctx context.Context, name string) (*RouteItem, error)
 	Delete(ctx context.Context, name string) error
+	SetMaintenance(ctx context.Context, name string, maintenance RouteMaintenance) (*RouteItem, error)
+	// MatchRoute find the route the proxy would serve the request with
+	MatchRoute(ctx context.Context, host string, requestURL *url.URL) (*RouteMatch, error)
+	// GetDrainStatus also report the routes deleted while still draining
+	GetDrainStatus(ctx context.Context, name string) (*RouteDrainStatus, error)
+	ExtendExpiry(ctx context.Context, name string, extension RouteExpiryExtension) (*RouteItem, error)
+	// ReapExpired disable or delete the expired routes, it return their names
+	ReapExpired(ctx context.Context) ([]string, error)
 }
@@ -0,0 +1,34 @@
+package domain
+
+import "time"
+
+// Effective state of a route reported by the API, an enabled route is only
+// served inside its schedule and before its expiry
+const (
+	RouteStateActive   = "active"
+	RouteStateInactive = "inactive"
+	RouteStateExpired  = "expired"
+	RouteStateDisabled = "disabled"
+)
+
+/*
+RouteSchedule limit when an enabled route is served. Outside of
+[ActiveFrom, ActiveUntil) the route is inactive, inside it the route is
+active when there is no window or when one of the windows contain the time.
+*/
+type RouteSchedule struct {
+	ActiveFrom  *time.Time `json:"activeFrom,omitempty" yaml:"activeFrom,omitempty"`
+	ActiveUntil *time.Time `json:"activeUntil,omitempty" yaml:"activeUntil,omitempty"`
+	// IANA name of the time zone of the windows, UTC when empty
+	TimeZone string                `json:"timeZone,omitempty" yaml:"timeZone,omitempty"`
+	Windows  []RouteScheduleWindow `json:"windows,omitempty" yaml:"windows,omitempty" validate:"omitempty,dive"`
+}
+
+// Recurring window, every listed day from Start to End
+type RouteScheduleWindow struct {
+	// Day of week field of a cron expression: *, 1-5, mon-fri, sat,sun (0 and 7 are sunday)
+	Days string `json:"days" yaml:"days" validate:"required"`
+	// HH:MM, an End before Start close the window the next day
+	Start string `json:"start" yaml:"start" validate:"required"`
+	End   string `json:"end" yaml:"end" validate:"required"`
+}
@@ -0,0 +1,15 @@
+package domain
+
+// Static route served from files on disk instead of a backend
+type RouteStatic struct {
+	// Directory under the configured static root, relative to it or absolute
+	Directory string `json:"directory" yaml:"directory" validate:"required"`
+	// File served for a directory, index.html when empty
+	IndexFile string `json:"indexFile,omitempty" yaml:"indexFile,omitempty" validate:"omitempty,excludesall=/\\"`
+	// Serve the root index file for missing paths without extension (client side routing)
+	SPAFallback bool `json:"spaFallback,omitempty" yaml:"spaFallback,omitempty"`
+	// List the directories without index file instead of answering 404
+	DirectoryListing bool `json:"directoryListing,omitempty" yaml:"directoryListing,omitempty"`
+	// Cache-Control max-age of the files, index documents are always revalidated. 0 send no header
+	MaxAgeSeconds int `json:"maxAgeSeconds,omitempty" yaml:"maxAgeSeconds,omitempty" validate:"gte=0"`
+}
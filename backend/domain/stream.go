@@ -0,0 +1,38 @@
+package domain
+
+import "context"
+
+/*
+StreamRoute forward raw TCP connections (databases behind TLS, MQTT) that
+can't be proxied at HTTP level. Without SNIHost the route own its listen
+port and every connection is forwarded to the upstream. With SNIHost the
+port can be shared, TLS connections are routed by the server name of the
+ClientHello and passed through without being terminated.
+*/
+type StreamRoute struct {
+	Name       string `json:"name" validate:"required,min=3,max=32,is_valid_name"`
+	ListenPort int    `json:"listenPort" yaml:"listenPort" validate:"required,min=1,max=65535"`
+	// Exact server name, or *.example.com for one level of subdomain
+	SNIHost string `json:"sniHost,omitempty" yaml:"sniHost,omitempty" validate:"omitempty,is_valid_sni_host"`
+	// host:port the connections are forwarded to
+	Upstream string `json:"upstream" validate:"required,hostname_port"`
+	// Close the connection once no byte flowed for this long, 0 use the proxy default
+	IdleTimeoutSeconds int   `json:"idleTimeoutSeconds,omitempty" yaml:"idleTimeoutSeconds,omitempty" validate:"gte=0,lte=86400"`
+	Enabled            *bool `json:"enabled" validate:"required"`
+}
+
+type StreamRouteRepository interface {
+	Create(ctx context.Context, route StreamRoute) (*StreamRoute, error)
+	Update(ctx context.Context, route StreamRoute) (*StreamRoute, error)
+	GetAll(ctx context.Context) ([]StreamRoute, error)
+	GetOne(ctx context.Context, name string) (*StreamRoute, error)
+	Delete(ctx context.Context, name string) error
+}
+
+type StreamRouteUsecase interface {
+	Create(ctx context.Context, route StreamRoute) (*StreamRoute, error)
+	Update(ctx context.Context, route StreamRoute) (*StreamRoute, error)
+	GetAll(ctx context.Context) ([]StreamRoute, error)
+	GetOne(ctx context.Context, name string) (*StreamRoute, error)
+	Delete(ctx context.Context, name string) error
+}
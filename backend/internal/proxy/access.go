@@ -0,0 +1,28 @@
+package proxy
+
+import (
+	"net/netip"
+	"test/portal/domain"
+	"test/portal/pkg/iputils"
+)
+
+// Evaluate the allow and deny lists of the route against the real client IP
+func isAllowed(route *domain.RouteItem, clientIP netip.Addr) bool {
+	if len(route.AllowCIDRs) == 0 && len(route.DenyCIDRs) == 0 {
+		return true
+	}
+
+	deny, err := iputils.ParsePrefixes(route.DenyCIDRs)
+	if err != nil || iputils.Contains(deny, clientIP) {
+		return false
+	}
+
+	if len(route.AllowCIDRs) == 0 {
+		return true
+	}
+	allow, err := iputils.ParsePrefixes(route.AllowCIDRs)
+	if err != nil {
+		return false
+	}
+	return iputils.Contains(allow, clientIP)
+}
@@ -0,0 +1,136 @@
+package accesslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"test/portal/domain"
+	"time"
+)
+
+type Format string
+
+const (
+	FormatJSON     Format = "json"
+	FormatCommon   Format = "common"
+	FormatCombined Format = "combined"
+)
+
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(strings.ToLower(name)); format {
+	case FormatJSON, FormatCommon, FormatCombined:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown access log format %q", name)
+}
+
+// One proxied request, the path is logged without its query string
+type Entry struct {
+	Time      time.Time     `json:"time"`
+	Route     string        `json:"route"`
+	ClientIP  string        `json:"clientIp"`
+	Method    string        `json:"method"`
+	Host      string        `json:"host"`
+	Path      string        `json:"path"`
+	Proto     string        `json:"proto"`
+	Status    int           `json:"status"`
+	Bytes     int64         `json:"bytes"`
+	Latency   time.Duration `json:"-"`
+	Upstream  string        `json:"upstream,omitempty"`
+	RequestID string        `json:"requestId,omitempty"`
+	Referer   string        `json:"referer,omitempty"`
+	UserAgent string        `json:"userAgent,omitempty"`
+}
+
+type Logger struct {
+	mu     sync.Mutex
+	output io.Writer
+	format Format
+	// Source of the sampling decisions, in [0, 1)
+	random func() float64
+}
+
+func New(output io.Writer, format Format, random func() float64) *Logger {
+	return &Logger{output: output, format: format, random: random}
+}
+
+// Sampled tell whether the request of the route has to be logged
+func (l *Logger) Sampled(route *domain.RouteItem) bool {
+	if route.AccessLog == nil || !route.AccessLog.Enabled {
+		return false
+	}
+	rate := route.AccessLog.SampleRate
+	return rate == 0 || rate >= 1 || l.random() < rate
+}
+
+func (l *Logger) Log(entry Entry) {
+	line, err := l.formatEntry(entry)
+	if err != nil {
+		slog.Error("Failed format access log entry", "error", err)
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.output.Write(line); err != nil {
+		slog.Error("Failed write access log", "error", err)
+	}
+}
+
+func (l *Logger) formatEntry(entry Entry) ([]byte, error) {
+	if l.format == FormatJSON {
+		line, err := json.Marshal(struct {
+			Entry
+			LatencyMs float64 `json:"latencyMs"`
+		}{entry, latencyMs(entry.Latency)})
+		return append(line, '\n'), err
+	}
+
+	/*
+		Common and Combined keep the standard fields first so the usual parsers
+		still read them, the route fields are appended as key="value" pairs.
+		127.0.0.1 - - [02/Jan/2006:15:04:05 -0700] "GET /path HTTP/1.1" 200 512 "referer" "agent" route="orders" ...
+	*/
+	var line strings.Builder
+	bytes := "-"
+	if entry.Bytes > 0 {
+		bytes = strconv.FormatInt(entry.Bytes, 10)
+	}
+	fmt.Fprintf(&line, "%s - - [%s] %s %d %s",
+		orDash(entry.ClientIP),
+		entry.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		strconv.Quote(entry.Method+" "+entry.Path+" "+entry.Proto),
+		entry.Status,
+		bytes,
+	)
+	if l.format == FormatCombined {
+		fmt.Fprintf(&line, " %s %s", quote(entry.Referer), quote(entry.UserAgent))
+	}
+	fmt.Fprintf(&line, " route=%s host=%s upstream=%s request_id=%s latency_ms=%.3f\n",
+		quote(entry.Route),
+		quote(entry.Host),
+		quote(entry.Upstream),
+		quote(entry.RequestID),
+		latencyMs(entry.Latency),
+	)
+	return []byte(line.String()), nil
+}
+
+func latencyMs(latency time.Duration) float64 {
+	return float64(latency.Microseconds()) / 1000
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+func quote(value string) string {
+	return strconv.Quote(orDash(value))
+}
@@ -0,0 +1,88 @@
+package accesslog
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+/*
+File rotated by size, the current file is renamed to path.1, the previous
+path.1 to path.2 and so on, keeping at most maxBackups old files.
+*/
+type File struct {
+	mu         sync.Mutex
+	path       string
+	maxBytes   int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+func OpenFile(path string, maxBytes int64, maxBackups int) (*File, error) {
+	f := &File{path: path, maxBytes: maxBytes, maxBackups: maxBackups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *File) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.maxBytes > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxBytes {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
+
+func (f *File) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+func (f *File) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+
+	if f.maxBackups <= 0 {
+		os.Remove(f.path)
+		return f.open()
+	}
+	os.Remove(f.backupPath(f.maxBackups))
+	for i := f.maxBackups - 1; i >= 1; i-- {
+		os.Rename(f.backupPath(i), f.backupPath(i+1))
+	}
+	// Keep writing to the current file when it can't be moved aside
+	renameErr := os.Rename(f.path, f.backupPath(1))
+	if err := f.open(); err != nil {
+		return err
+	}
+	return renameErr
+}
+
+func (f *File) backupPath(index int) string {
+	return fmt.Sprintf("%s.%d", f.path, index)
+}
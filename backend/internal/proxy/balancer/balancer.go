@@ -0,0 +1,207 @@
+package balancer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"test/portal/domain"
+	"time"
+)
+
+const (
+	// A backend failing a request is skipped for this long
+	passiveHealthCooldown = 10 * time.Second
+	defaultCookieName     = "portal_affinity"
+)
+
+type Target struct {
+	// Stable identifier of the backend, used as affinity cookie value
+	ID      string
+	URL     *url.URL
+	Backend domain.RouteBackend
+
+	unhealthyUntil atomic.Int64
+}
+
+func (t *Target) IsHealthy(now time.Time) bool {
+	return now.UnixNano() >= t.unhealthyUntil.Load()
+}
+
+// Balancer spread the requests of a route over its backends, round robin,
+// consistent hashing or pinned by session affinity, skipping backends that
+// recently failed
+type Balancer struct {
+	targets   []*Target
+	ring      *ring
+	signature string
+	next      atomic.Uint64
+	now       func() time.Time
+}
+
+func New(backends []domain.RouteBackend, now func() time.Time) (*Balancer, error) {
+	targets := make([]*Target, 0, len(backends))
+	for _, backend := range backends {
+		targetURL, err := url.Parse(backend.URL)
+		if err != nil {
+			return nil, err
+		}
+		hash := sha256.Sum256([]byte(backend.URL))
+		targets = append(targets, &Target{
+			ID:      hex.EncodeToString(hash[:8]),
+			URL:     targetURL,
+			Backend: backend,
+		})
+	}
+	return &Balancer{
+		targets:   targets,
+		ring:      newRing(targets),
+		signature: Signature(backends),
+		now:       now,
+	}, nil
+}
+
+// Signature identify the backend list with the settings of each backend (TLS
+// included), a balancer is rebuilt when it change
+func Signature(backends []domain.RouteBackend) string {
+	signature, _ := json.Marshal(backends)
+	return string(signature)
+}
+
+func (b *Balancer) Signature() string {
+	return b.signature
+}
+
+func (b *Balancer) Targets() []*Target {
+	return b.targets
+}
+
+/*
+Pick the backend of the request. Session affinity win over the load balancing
+strategy. With cookie affinity the backend named by the cookie is kept while
+healthy, the returned cookie must be sent to the client when it's not nil
+(first visit or the pinned backend went down). Requests without a hash key
+fall back to round robin.
+*/
+func (b *Balancer) Pick(r *http.Request, route *domain.RouteItem, clientIP netip.Addr) (*Target, *http.Cookie) {
+	if affinity := route.Affinity; affinity != nil {
+		switch affinity.Mode {
+		case "cookie":
+			if cookie, err := r.Cookie(cookieName(affinity)); err == nil {
+				for _, target := range b.targets {
+					if target.ID == cookie.Value && target.IsHealthy(b.now()) {
+						return target, nil
+					}
+				}
+			}
+			target := b.roundRobin()
+			return target, newAffinityCookie(affinity, cookiePath(route.Path), target)
+		case "header":
+			if value := r.Header.Get(affinity.HeaderName); value != "" {
+				return b.consistentHash(value), nil
+			}
+		}
+		return b.roundRobin(), nil
+	}
+
+	if lb := route.LoadBalancing; lb != nil && lb.Strategy == "consistent_hash" {
+		if key := hashKeyOf(r, lb, clientIP); key != "" {
+			return b.consistentHash(key), nil
+		}
+	}
+	return b.roundRobin(), nil
+}
+
+// MarkUnhealthy take the backend out of rotation for the cooldown
+func (b *Balancer) MarkUnhealthy(target *Target) {
+	target.unhealthyUntil.Store(b.now().Add(passiveHealthCooldown).UnixNano())
+}
+
+func (b *Balancer) roundRobin() *Target {
+	start := int((b.next.Add(1) - 1) % uint64(len(b.targets)))
+	return b.firstHealthyFrom(start)
+}
+
+// First healthy backend from the position, every backend being down the
+// original one is still tried rather than failing without a request
+func (b *Balancer) firstHealthyFrom(start int) *Target {
+	now := b.now()
+	for i := 0; i < len(b.targets); i++ {
+		target := b.targets[(start+i)%len(b.targets)]
+		if target.IsHealthy(now) {
+			return target
+		}
+	}
+	return b.targets[start]
+}
+
+// Owner of the key on the ring, or the next healthy backend clockwise
+func (b *Balancer) consistentHash(key string) *Target {
+	now := b.now()
+	index, found := b.ring.lookup(key, func(target int) bool { return b.targets[target].IsHealthy(now) })
+	if !found {
+		index, _ = b.ring.lookup(key, func(target int) bool { return true })
+	}
+	return b.targets[index]
+}
+
+func hashKeyOf(r *http.Request, lb *domain.RouteLoadBalancing, clientIP netip.Addr) string {
+	switch lb.HashOn {
+	case "header":
+		return r.Header.Get(lb.HashKey)
+	case "cookie":
+		if cookie, err := r.Cookie(lb.HashKey); err == nil {
+			return cookie.Value
+		}
+	case "query":
+		return r.URL.Query().Get(lb.HashKey)
+	case "client_ip":
+		if clientIP.IsValid() {
+			return clientIP.String()
+		}
+	}
+	return ""
+}
+
+func cookieName(affinity *domain.RouteAffinity) string {
+	if affinity.CookieName != "" {
+		return affinity.CookieName
+	}
+	return defaultCookieName
+}
+
+// Literal part of the route path before its first parameter or wildcard,
+// browsers only send back a cookie whose path prefix the request path
+func cookiePath(routePath string) string {
+	if i := strings.IndexAny(routePath, "{*"); i >= 0 {
+		routePath = routePath[:strings.LastIndex(routePath[:i], "/")]
+	}
+	if routePath == "" {
+		return "/"
+	}
+	return routePath
+}
+
+func newAffinityCookie(affinity *domain.RouteAffinity, path string, target *Target) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     cookieName(affinity),
+		Value:    target.ID,
+		Path:     path,
+		MaxAge:   affinity.CookieTTLSeconds,
+		Secure:   affinity.CookieSecure,
+		HttpOnly: affinity.CookieHTTPOnly,
+	}
+	switch affinity.CookieSameSite {
+	case "lax":
+		cookie.SameSite = http.SameSiteLaxMode
+	case "strict":
+		cookie.SameSite = http.SameSiteStrictMode
+	case "none":
+		cookie.SameSite = http.SameSiteNoneMode
+	}
+	return cookie
+}
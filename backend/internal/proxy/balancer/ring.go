@@ -0,0 +1,61 @@
+package balancer
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"sort"
+	"strconv"
+)
+
+// Virtual nodes of each backend on the ring, more nodes smooth the spread
+const ringReplicas = 160
+
+/*
+Consistent hash ring, each backend own many points on the ring and a key
+belong to the first point clockwise from its hash. Adding or removing a
+backend only move the keys of the points it gain or lose.
+*/
+type ring struct {
+	points []ringPoint
+}
+
+type ringPoint struct {
+	hash   uint64
+	target int
+}
+
+// The points only depend on the backend ID so every proxy replica build the same ring
+func newRing(targets []*Target) *ring {
+	points := make([]ringPoint, 0, len(targets)*ringReplicas)
+	for i, target := range targets {
+		for replica := 0; replica < ringReplicas; replica++ {
+			points = append(points, ringPoint{
+				hash:   hashKey(target.ID + "#" + strconv.Itoa(replica)),
+				target: i,
+			})
+		}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].hash < points[j].hash })
+	return &ring{points: points}
+}
+
+// Walk the ring from the key and return the first target accepted by the filter
+func (r *ring) lookup(key string, accept func(target int) bool) (int, bool) {
+	if len(r.points) == 0 {
+		return 0, false
+	}
+	hash := hashKey(key)
+	start := sort.Search(len(r.points), func(i int) bool { return r.points[i].hash >= hash })
+	for i := 0; i < len(r.points); i++ {
+		point := r.points[(start+i)%len(r.points)]
+		if accept(point.target) {
+			return point.target, true
+		}
+	}
+	return 0, false
+}
+
+func hashKey(key string) uint64 {
+	sum := sha256.Sum256([]byte(key))
+	return binary.BigEndian.Uint64(sum[:8])
+}
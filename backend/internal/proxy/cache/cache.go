@@ -0,0 +1,261 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"test/portal/domain"
+	"time"
+)
+
+// Responses above this size are not stored unless the route policy allow it
+const defaultMaxObjectSize = 1 << 20
+
+// Cache serve the responses of the routes with an enabled cache policy from
+// the store, stale entries are revalidated against the backend with
+// If-None-Match and If-Modified-Since
+type Cache struct {
+	store Store
+	now   func() time.Time
+}
+
+func New(store Store, now func() time.Time) *Cache {
+	return &Cache{
+		store: store,
+		now:   now,
+	}
+}
+
+// Purge implements domain.RouteCachePurger.
+func (c *Cache) Purge(ctx context.Context, routeName string, pathPrefix string) int {
+	return c.store.Purge(func(entry *Entry) bool {
+		if routeName != "" && entry.RouteName != routeName {
+			return false
+		}
+		return strings.HasPrefix(entry.Path, pathPrefix)
+	})
+}
+
+func (c *Cache) Handle(w http.ResponseWriter, r *http.Request, route *domain.RouteItem, next http.Handler) {
+	policy := route.Cache
+	if isBypassed(r, policy) {
+		w.Header().Set("X-Cache", "BYPASS")
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	key := cacheKey(route, r)
+	entry, found := c.store.Get(key)
+	if found && c.now().Before(entry.ExpiresAt) && !isRevalidationRequired(r, policy) {
+		c.serveEntry(w, r, entry, "HIT")
+		return
+	}
+
+	// Fetch the full response, the conditional headers of the client are
+	// answered from the stored entry afterwards. The key ignore the encoding
+	// so the response is stored in identity encoding, the transport decode
+	// a backend compressing anyway
+	upstream := r.Clone(r.Context())
+	upstream.Header.Del("If-None-Match")
+	upstream.Header.Del("If-Modified-Since")
+	upstream.Header.Del("Accept-Encoding")
+	if found && hasValidators(entry.Header) {
+		if etag := entry.Header.Get("ETag"); etag != "" {
+			upstream.Header.Set("If-None-Match", etag)
+		}
+		if lastModified := entry.Header.Get("Last-Modified"); lastModified != "" {
+			upstream.Header.Set("If-Modified-Since", lastModified)
+		}
+	}
+
+	maxObjectSize := policy.MaxObjectSizeBytes
+	if maxObjectSize == 0 {
+		maxObjectSize = defaultMaxObjectSize
+	}
+	capture := newCaptureWriter(w, maxObjectSize)
+	next.ServeHTTP(capture, upstream)
+	if capture.passthrough {
+		// Too large or streamed, the client already got it
+		c.store.Delete(key)
+		return
+	}
+
+	now := c.now()
+	if found && capture.status == http.StatusNotModified {
+		refreshed := *entry
+		refreshed.Header = entry.Header.Clone()
+		for _, name := range []string{"Cache-Control", "Expires", "ETag", "Last-Modified", "Date", "Vary"} {
+			if values := capture.header.Values(name); len(values) > 0 {
+				refreshed.Header[name] = values
+			}
+		}
+		ttl, storable := freshness(policy, refreshed.StatusCode, refreshed.Header, now)
+		if !storable {
+			c.store.Delete(key)
+			c.serveEntry(w, r, &refreshed, "REVALIDATED")
+			return
+		}
+		refreshed.StoredAt = now
+		refreshed.ExpiresAt = now.Add(ttl)
+		c.store.Set(key, &refreshed)
+		c.serveEntry(w, r, &refreshed, "REVALIDATED")
+		return
+	}
+
+	fetched := &Entry{
+		RouteName:  route.Name,
+		Path:       r.URL.Path,
+		StatusCode: capture.status,
+		Header:     capture.header.Clone(),
+		Body:       bytes.Clone(capture.body.Bytes()),
+		StoredAt:   now,
+	}
+	ttl, storable := freshness(policy, capture.status, capture.header, now)
+	if !storable || r.Method != http.MethodGet {
+		c.store.Delete(key)
+		capture.writeTo(w, "MISS")
+		return
+	}
+	fetched.ExpiresAt = now.Add(ttl)
+	c.store.Set(key, fetched)
+	c.serveEntry(w, r, fetched, "MISS")
+}
+
+func (c *Cache) serveEntry(w http.ResponseWriter, r *http.Request, entry *Entry, cacheStatus string) {
+	header := w.Header()
+	for key, values := range entry.Header {
+		header[key] = append([]string(nil), values...)
+	}
+	age := max(c.now().Sub(entry.StoredAt), 0)
+	header.Set("Age", strconv.Itoa(int(age.Seconds())))
+	header.Set("X-Cache", cacheStatus)
+
+	if entry.StatusCode == http.StatusOK && isNotModified(r, entry.Header) {
+		header.Del("Content-Length")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	header.Set("Content-Length", strconv.Itoa(len(entry.Body)))
+	w.WriteHeader(entry.StatusCode)
+	if r.Method != http.MethodHead {
+		w.Write(entry.Body)
+	}
+}
+
+// Evaluate the client conditional headers against the stored validators
+func isNotModified(r *http.Request, header http.Header) bool {
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		etag := strings.TrimPrefix(header.Get("ETag"), "W/")
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(ifNoneMatch, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	ifModifiedSince, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	lastModified, err := http.ParseTime(header.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+	return !lastModified.After(ifModifiedSince)
+}
+
+// Buffer the backend response up to the limit, a larger response or an event
+// stream is streamed to the client as is
+type captureWriter struct {
+	w           http.ResponseWriter
+	header      http.Header
+	status      int
+	body        bytes.Buffer
+	limit       int64
+	passthrough bool
+}
+
+func newCaptureWriter(w http.ResponseWriter, limit int64) *captureWriter {
+	return &captureWriter{
+		w:      w,
+		header: http.Header{},
+		limit:  limit,
+	}
+}
+
+func (c *captureWriter) Header() http.Header {
+	if c.passthrough {
+		return c.w.Header()
+	}
+	return c.header
+}
+
+func (c *captureWriter) WriteHeader(status int) {
+	// Informational responses are not part of the stored response
+	if c.status != 0 || status < http.StatusOK {
+		return
+	}
+	c.status = status
+}
+
+func (c *captureWriter) Write(b []byte) (int, error) {
+	if c.status == 0 {
+		c.WriteHeader(http.StatusOK)
+	}
+	if c.passthrough {
+		return c.w.Write(b)
+	}
+	if int64(c.body.Len()+len(b)) > c.limit {
+		c.startPassthrough()
+		return c.w.Write(b)
+	}
+	return c.body.Write(b)
+}
+
+// The reverse proxy flush after every write of a chunked response, only a
+// real stream stop the buffering
+func (c *captureWriter) Flush() {
+	if !c.passthrough {
+		if !isStream(c.header) {
+			return
+		}
+		c.startPassthrough()
+	}
+	http.NewResponseController(c.w).Flush()
+}
+
+func isStream(header http.Header) bool {
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	return mediaType == "text/event-stream"
+}
+
+func (c *captureWriter) Unwrap() http.ResponseWriter {
+	return c.w
+}
+
+func (c *captureWriter) startPassthrough() {
+	c.writeTo(c.w, "MISS")
+	c.passthrough = true
+}
+
+func (c *captureWriter) writeTo(w http.ResponseWriter, cacheStatus string) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	header := w.Header()
+	for key, values := range c.header {
+		header[key] = values
+	}
+	header.Set("X-Cache", cacheStatus)
+	w.WriteHeader(c.status)
+	w.Write(c.body.Bytes())
+}
@@ -0,0 +1,188 @@
+package cache
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"test/portal/domain"
+	"time"
+)
+
+// Status codes cacheable by default (RFC 9110 section 15.1)
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusRequestURITooLong:    true,
+	http.StatusNotImplemented:       true,
+}
+
+type cacheControl map[string]string
+
+func parseCacheControl(values []string) cacheControl {
+	directives := cacheControl{}
+	for _, value := range values {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if name != "" {
+				directives[strings.ToLower(name)] = strings.Trim(arg, `"`)
+			}
+		}
+	}
+	return directives
+}
+
+func (cc cacheControl) has(name string) bool {
+	_, found := cc[name]
+	return found
+}
+
+func (cc cacheControl) seconds(name string) (time.Duration, bool) {
+	value, found := cc[name]
+	if !found {
+		return 0, false
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		return 0, true
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// Request that must go straight to the backend
+func isBypassed(r *http.Request, policy *domain.RouteCachePolicy) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return true
+	}
+	if r.Header.Get("Authorization") != "" || r.Header.Get("Range") != "" {
+		return true
+	}
+	// An upgraded connection is hijacked, there's no response to store
+	if isUpgradeRequested(r) {
+		return true
+	}
+	return policy.RespectCacheControl && parseCacheControl(r.Header.Values("Cache-Control")).has("no-store")
+}
+
+func isUpgradeRequested(r *http.Request) bool {
+	if r.Header.Get("Upgrade") != "" {
+		return true
+	}
+	for _, value := range r.Header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Client asked for an end to end revalidation of the stored response
+func isRevalidationRequired(r *http.Request, policy *domain.RouteCachePolicy) bool {
+	if !policy.RespectCacheControl {
+		return false
+	}
+	cc := parseCacheControl(r.Header.Values("Cache-Control"))
+	maxAge, found := cc.seconds("max-age")
+	return cc.has("no-cache") || (found && maxAge == 0)
+}
+
+/*
+Freshness lifetime of the backend response, false when it must not be stored.
+With RespectCacheControl the backend directives win over the default TTL,
+no-cache responses are stored with zero lifetime so they're always revalidated.
+*/
+func freshness(policy *domain.RouteCachePolicy, statusCode int, header http.Header, now time.Time) (time.Duration, bool) {
+	if !cacheableStatus[statusCode] || header.Get("Set-Cookie") != "" {
+		return 0, false
+	}
+	if !isVaryCovered(policy, header) {
+		return 0, false
+	}
+
+	ttl := time.Duration(policy.DefaultTTLSeconds) * time.Second
+	if policy.RespectCacheControl {
+		cc := parseCacheControl(header.Values("Cache-Control"))
+		if cc.has("no-store") || cc.has("private") {
+			return 0, false
+		}
+		if sMaxAge, found := cc.seconds("s-maxage"); found {
+			ttl = sMaxAge
+		} else if maxAge, found := cc.seconds("max-age"); found {
+			ttl = maxAge
+		} else if expires, err := http.ParseTime(header.Get("Expires")); err == nil {
+			ttl = max(expires.Sub(now), 0)
+		} else if header.Get("Expires") != "" {
+			// Invalid Expires mean already expired
+			ttl = 0
+		}
+		if cc.has("no-cache") {
+			ttl = 0
+		}
+	}
+
+	// Stale entry is only useful when it can be revalidated
+	if ttl <= 0 && !hasValidators(header) {
+		return 0, false
+	}
+	return ttl, true
+}
+
+// The response can only be shared when every header it vary on is part of the key
+func isVaryCovered(policy *domain.RouteCachePolicy, header http.Header) bool {
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if name == "*" || !containsHeader(policy.VaryHeaders, name) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func hasValidators(header http.Header) bool {
+	return header.Get("ETag") != "" || header.Get("Last-Modified") != ""
+}
+
+func containsHeader(headers []string, name string) bool {
+	for _, header := range headers {
+		if strings.EqualFold(header, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Key of the request, HEAD share the entry of GET
+func cacheKey(route *domain.RouteItem, r *http.Request) string {
+	var builder strings.Builder
+	builder.WriteString(route.Name)
+	builder.WriteString("\n")
+	builder.WriteString(strings.ToLower(r.Host))
+	builder.WriteString("\n")
+	builder.WriteString(r.URL.RequestURI())
+
+	varyHeaders := make([]string, 0, len(route.Cache.VaryHeaders))
+	for _, name := range route.Cache.VaryHeaders {
+		varyHeaders = append(varyHeaders, http.CanonicalHeaderKey(name))
+	}
+	sort.Strings(varyHeaders)
+	for _, name := range varyHeaders {
+		builder.WriteString("\n")
+		builder.WriteString(name)
+		builder.WriteString(":")
+		builder.WriteString(strings.Join(r.Header.Values(name), ","))
+	}
+	return builder.String()
+}
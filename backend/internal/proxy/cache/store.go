@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type Entry struct {
+	RouteName  string
+	Path       string
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	StoredAt   time.Time
+	ExpiresAt  time.Time
+}
+
+// Approximate memory used by the entry
+func (e *Entry) Size() int64 {
+	size := int64(len(e.Body) + len(e.RouteName) + len(e.Path))
+	for key, values := range e.Header {
+		for _, value := range values {
+			size += int64(len(key) + len(value))
+		}
+	}
+	return size
+}
+
+type Store interface {
+	Get(key string) (*Entry, bool)
+	Set(key string, entry *Entry)
+	Delete(key string)
+	// Purge remove every entry accepted by the filter and return the count
+	Purge(filter func(entry *Entry) bool) int
+}
+
+// In memory store bounded by size, the least recently used entries are
+// evicted first
+type memoryStore struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	items    map[string]*list.Element
+	order    *list.List
+}
+
+type memoryItem struct {
+	key   string
+	entry *Entry
+}
+
+func NewMemoryStore(maxBytes int64) Store {
+	return &memoryStore{
+		maxBytes: maxBytes,
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Get implements Store.
+func (s *memoryStore) Get(key string) (*Entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element, found := s.items[key]
+	if !found {
+		return nil, false
+	}
+	s.order.MoveToFront(element)
+	return element.Value.(*memoryItem).entry, true
+}
+
+// Set implements Store.
+func (s *memoryStore) Set(key string, entry *Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if element, found := s.items[key]; found {
+		s.remove(element)
+	}
+	if entry.Size() > s.maxBytes {
+		return
+	}
+
+	s.items[key] = s.order.PushFront(&memoryItem{key: key, entry: entry})
+	s.size += entry.Size()
+	for s.size > s.maxBytes {
+		s.remove(s.order.Back())
+	}
+}
+
+// Delete implements Store.
+func (s *memoryStore) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if element, found := s.items[key]; found {
+		s.remove(element)
+	}
+}
+
+// Purge implements Store.
+func (s *memoryStore) Purge(filter func(entry *Entry) bool) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	purged := 0
+	for element := s.order.Front(); element != nil; {
+		next := element.Next()
+		if filter(element.Value.(*memoryItem).entry) {
+			s.remove(element)
+			purged++
+		}
+		element = next
+	}
+	return purged
+}
+
+func (s *memoryStore) remove(element *list.Element) {
+	item := element.Value.(*memoryItem)
+	s.order.Remove(element)
+	delete(s.items, item.key)
+	s.size -= item.entry.Size()
+}
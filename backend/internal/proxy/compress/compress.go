@@ -0,0 +1,248 @@
+package compress
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"test/portal/domain"
+	"test/portal/pkg/httputils"
+
+	"github.com/andybalholm/brotli"
+)
+
+var (
+	defaultAlgorithms   = []string{"br", "gzip"}
+	defaultContentTypes = []string{
+		"text/*",
+		"application/json",
+		"application/javascript",
+		"application/xml",
+		"application/problem+json",
+		"image/svg+xml",
+	}
+)
+
+/*
+Handle compress the response of the backend when the client accept one of the
+route algorithms and the backend didn't encode it already. Range requests,
+partial and bodiless responses and no-transform responses are left untouched.
+*/
+func Handle(w http.ResponseWriter, r *http.Request, policy *domain.RouteCompressionPolicy, next http.Handler) {
+	// Byte ranges refer to the identity encoding, never transform them
+	if r.Header.Get("Range") != "" {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	algorithms := policy.Algorithms
+	if len(algorithms) == 0 {
+		algorithms = defaultAlgorithms
+	}
+
+	cw := &compressWriter{
+		w:        w,
+		policy:   policy,
+		encoding: negotiate(r.Header.Get("Accept-Encoding"), algorithms),
+		isHead:   r.Method == http.MethodHead,
+	}
+	defer cw.close()
+	next.ServeHTTP(cw, r)
+}
+
+// Pick the accepted algorithm with the highest quality, ties go to the
+// route preference order. Empty when nothing is acceptable.
+func negotiate(acceptEncoding string, algorithms []string) string {
+	qualities := map[string]float64{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		quality := 1.0
+		if key, value, found := strings.Cut(strings.TrimSpace(params), "="); found && strings.TrimSpace(key) == "q" {
+			if q, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+				quality = q
+			}
+		}
+		qualities[name] = quality
+	}
+
+	best, bestQuality := "", 0.0
+	for _, algorithm := range algorithms {
+		quality, found := qualities[algorithm]
+		if !found {
+			quality, found = qualities["*"]
+		}
+		if found && quality > bestQuality {
+			best, bestQuality = algorithm, quality
+		}
+	}
+	return best
+}
+
+func isCompressibleType(policy *domain.RouteCompressionPolicy, contentType string) bool {
+	contentTypes := policy.ContentTypes
+	if len(contentTypes) == 0 {
+		contentTypes = defaultContentTypes
+	}
+	return httputils.MatchMediaType(contentTypes, contentType)
+}
+
+func hasToken(values []string, token string) bool {
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(item), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+/*
+compressWriter hold the body until the minimum size is reached (or the length
+is known from Content-Length) before deciding, so small responses are not
+inflated. A Flush from the backend decide right away to keep streams flowing.
+*/
+type compressWriter struct {
+	w        http.ResponseWriter
+	policy   *domain.RouteCompressionPolicy
+	encoding string
+	isHead   bool
+
+	status  int
+	buf     []byte
+	decided bool
+	encoder io.WriteCloser
+}
+
+func (c *compressWriter) Header() http.Header {
+	return c.w.Header()
+}
+
+func (c *compressWriter) WriteHeader(status int) {
+	if c.decided || c.status != 0 {
+		return
+	}
+	// Informational responses go straight to the client
+	if status < http.StatusOK {
+		c.w.WriteHeader(status)
+		return
+	}
+	c.status = status
+
+	contentLength, err := strconv.ParseInt(c.Header().Get("Content-Length"), 10, 64)
+	if err == nil || !c.isEligible() {
+		c.decide(err == nil && contentLength >= c.policy.MinSizeBytes)
+	}
+}
+
+func (c *compressWriter) Write(b []byte) (int, error) {
+	if c.status == 0 {
+		c.WriteHeader(http.StatusOK)
+	}
+	if !c.decided {
+		c.buf = append(c.buf, b...)
+		if int64(len(c.buf)) >= c.policy.MinSizeBytes && len(c.buf) > 0 {
+			c.decide(true)
+		}
+		return len(b), nil
+	}
+	if c.encoder != nil {
+		return c.encoder.Write(b)
+	}
+	return c.w.Write(b)
+}
+
+func (c *compressWriter) Flush() {
+	if c.status == 0 {
+		c.WriteHeader(http.StatusOK)
+	}
+	// Flushed response is a stream of unknown size, the minimum doesn't apply
+	if !c.decided {
+		c.decide(true)
+	}
+	if flusher, ok := c.encoder.(interface{ Flush() error }); ok {
+		flusher.Flush()
+	}
+	http.NewResponseController(c.w).Flush()
+}
+
+func (c *compressWriter) Unwrap() http.ResponseWriter {
+	return c.w
+}
+
+func (c *compressWriter) close() {
+	if c.status == 0 {
+		// Handler wrote nothing, let the server send its default response
+		return
+	}
+	if !c.decided {
+		c.decide(int64(len(c.buf)) >= c.policy.MinSizeBytes && len(c.buf) > 0)
+	}
+	if c.encoder != nil {
+		c.encoder.Close()
+	}
+}
+
+// Response the route could compress, whatever the client accept
+func (c *compressWriter) isEligible() bool {
+	header := c.Header()
+	switch {
+	case c.status < http.StatusOK,
+		c.status == http.StatusNoContent,
+		c.status == http.StatusPartialContent,
+		c.status == http.StatusNotModified:
+		return false
+	case header.Get("Content-Encoding") != "" && !strings.EqualFold(header.Get("Content-Encoding"), "identity"),
+		header.Get("Content-Range") != "",
+		hasToken(header.Values("Cache-Control"), "no-transform"):
+		return false
+	}
+	return isCompressibleType(c.policy, header.Get("Content-Type"))
+}
+
+func (c *compressWriter) decide(largeEnough bool) {
+	c.decided = true
+	header := c.Header()
+
+	eligible := c.isEligible()
+	if eligible && !hasToken(header.Values("Vary"), "Accept-Encoding") {
+		header.Add("Vary", "Accept-Encoding")
+	}
+
+	if eligible && largeEnough && c.encoding != "" {
+		header.Del("Content-Length")
+		header.Del("Accept-Ranges")
+		header.Set("Content-Encoding", c.encoding)
+		// Representation changed, a strong validator would be wrong now
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+		c.w.WriteHeader(c.status)
+		if c.isHead {
+			return
+		}
+		c.encoder = newEncoder(c.encoding, c.w)
+		c.encoder.Write(c.buf)
+		c.buf = nil
+		return
+	}
+
+	c.w.WriteHeader(c.status)
+	if len(c.buf) > 0 {
+		c.w.Write(c.buf)
+		c.buf = nil
+	}
+}
+
+func newEncoder(encoding string, w io.Writer) io.WriteCloser {
+	if encoding == "br" {
+		return brotli.NewWriterLevel(w, brotli.DefaultCompression)
+	}
+	encoder, _ := gzip.NewWriterLevel(w, gzip.DefaultCompression)
+	return encoder
+}
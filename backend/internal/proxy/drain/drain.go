@@ -0,0 +1,145 @@
+package drain
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"test/portal/domain"
+	"time"
+)
+
+/*
+Tracker follow the in-flight requests of each route so disabling or
+deleting a route doesn't cut them. New requests stop matching as soon as
+the route change, the requests already running (upgraded connections
+included, their request lasts as long as the connection) get the grace
+period to end before their context is cancelled.
+*/
+type Tracker struct {
+	grace time.Duration
+
+	mu     sync.Mutex
+	nextID uint64
+	// Only routes with requests in flight have an entry
+	routes map[string]*routeTraffic
+}
+
+type routeTraffic struct {
+	requests map[uint64]request
+	draining bool
+	// Grace period over, the requests still starting are cancelled at once
+	expired  bool
+	since    time.Time
+	deadline time.Time
+	timer    *time.Timer
+}
+
+type request struct {
+	cancel   context.CancelFunc
+	upgraded bool
+}
+
+func New(grace time.Duration) *Tracker {
+	return &Tracker{
+		grace:  grace,
+		routes: make(map[string]*routeTraffic),
+	}
+}
+
+// Begin track a request of the route until done is called, the returned
+// context is cancelled when the route drain expire
+func (t *Tracker) Begin(ctx context.Context, routeName string, upgraded bool) (_ context.Context, done func()) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	traffic, found := t.routes[routeName]
+	if !found {
+		traffic = &routeTraffic{requests: make(map[uint64]request)}
+		t.routes[routeName] = traffic
+	}
+	t.nextID++
+	id := t.nextID
+	traffic.requests[id] = request{cancel: cancel, upgraded: upgraded}
+	if traffic.expired {
+		cancel()
+	}
+
+	return ctx, func() {
+		cancel()
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		delete(traffic.requests, id)
+		if len(traffic.requests) > 0 {
+			return
+		}
+		if traffic.draining {
+			traffic.timer.Stop()
+			slog.Info("Route drained", "route", routeName, "duration", time.Since(traffic.since))
+		}
+		if t.routes[routeName] == traffic {
+			delete(t.routes, routeName)
+		}
+	}
+}
+
+// Drain implements domain.RouteDrainer.
+func (t *Tracker) Drain(routeName string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	traffic, found := t.routes[routeName]
+	if !found || traffic.draining {
+		return
+	}
+	traffic.draining = true
+	traffic.since = time.Now()
+	traffic.deadline = traffic.since.Add(t.grace)
+	traffic.timer = time.AfterFunc(t.grace, func() { t.expire(routeName, traffic) })
+	slog.Info("Route draining", "route", routeName, "requests", len(traffic.requests), "grace", t.grace)
+}
+
+// CancelDrain implements domain.RouteDrainer.
+func (t *Tracker) CancelDrain(routeName string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	traffic, found := t.routes[routeName]
+	if !found || !traffic.draining {
+		return
+	}
+	traffic.timer.Stop()
+	traffic.draining = false
+	traffic.expired = false
+}
+
+// DrainStatus implements domain.RouteDrainer.
+func (t *Tracker) DrainStatus(routeName string) *domain.RouteDrainStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	traffic, found := t.routes[routeName]
+	if !found || !traffic.draining {
+		return nil
+	}
+	since, deadline := traffic.since, traffic.deadline
+	status := &domain.RouteDrainStatus{Draining: true, Since: &since, Deadline: &deadline}
+	for _, request := range traffic.requests {
+		if request.upgraded {
+			status.UpgradedConnections++
+		} else {
+			status.InFlightRequests++
+		}
+	}
+	return status
+}
+
+func (t *Tracker) expire(routeName string, traffic *routeTraffic) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.routes[routeName] != traffic || !traffic.draining {
+		return
+	}
+	traffic.expired = true
+	slog.Warn("Route drain grace period over, cancelling its requests", "route", routeName, "requests", len(traffic.requests))
+	for _, request := range traffic.requests {
+		request.cancel()
+	}
+}
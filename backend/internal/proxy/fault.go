@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"test/portal/domain"
+	"test/portal/pkg/httputils"
+	"time"
+)
+
+/*
+Apply the fault injection of the route. The delay come first, then the abort
+answer with its status instead of the backend. It return false when the
+request must not be forwarded (aborted or client gone during the delay).
+Expired experiments are ignored.
+*/
+func (p *Proxy) injectFaults(w http.ResponseWriter, r *http.Request, route *domain.RouteItem) bool {
+	faults := route.Faults
+	if faults == nil || !faults.Enabled || faults.ExpiresAt == nil || !time.Now().Before(*faults.ExpiresAt) {
+		return true
+	}
+	if faults.HeaderName != "" {
+		value := r.Header.Get(faults.HeaderName)
+		if value == "" || (faults.HeaderValue != "" && value != faults.HeaderValue) {
+			return true
+		}
+	}
+
+	if delay := faults.Delay; delay != nil && p.random()*100 < delay.Percentage {
+		w.Header().Add("X-Fault-Injected", "delay")
+		timer := time.NewTimer(time.Duration(delay.DurationMs) * time.Millisecond)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			return false
+		}
+	}
+
+	if abort := faults.Abort; abort != nil && p.random()*100 < abort.Percentage {
+		w.Header().Add("X-Fault-Injected", "abort")
+		httputils.WriteErrorResponse(w, errors.New(strconv.Itoa(abort.StatusCode)+":"+http.StatusText(abort.StatusCode)))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,152 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"test/portal/domain"
+	"test/portal/internal/proxy/balancer"
+	"test/portal/internal/proxy/forwarding"
+	"test/portal/pkg/httputils"
+	"test/portal/pkg/pathutils"
+	"test/portal/pkg/traceutils"
+	"unicode"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+/*
+Forward the request to the target. A backend that can't be reached is taken
+out of rotation, bodiless requests are then retried on the next healthy
+backend so a dead pinned backend doesn't surface to the client. The last
+target tried is returned.
+*/
+func (p *Proxy) forward(w http.ResponseWriter, r *http.Request, match *domain.RouteMatch, client forwarding.Client, routeBalancer *balancer.Balancer, target *balancer.Target) *balancer.Target {
+	route := match.Route
+	for attempt := 1; ; attempt++ {
+		retry := false
+		canRetry := attempt < len(routeBalancer.Targets()) && (r.Body == nil || r.Body == http.NoBody)
+
+		ctx, span := traceutils.Start(r.Context(), "Proxy.forward",
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("portal.backend", target.URL.String()),
+				attribute.Int("portal.attempt", attempt),
+			))
+
+		transport, err := p.transports.get(target.Backend.TLS)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Invalid TLS settings for backend", "route", route.Name, "backend", target.URL.String(), "error", err)
+			traceutils.End(span, &err)
+			httputils.WriteErrorResponse(w, errors.New(domain.ErrBadGateway))
+			return target
+		}
+
+		reverseProxy := &httputil.ReverseProxy{
+			Transport: transport,
+			Rewrite: func(pr *httputil.ProxyRequest) {
+				rewritePath(pr.Out, match)
+				pr.SetURL(target.URL)
+				// The backend continue the trace from the attempt span
+				traceutils.Inject(ctx, pr.Out.Header)
+				// Counted by the next hop when the backend loop back to the portal
+				p.addVia(pr.Out, pr.In)
+				setRequestHeaders(pr.Out, match)
+				if route.DisableForwardedHeaders {
+					forwarding.RemoveHeaders(pr.Out)
+					return
+				}
+				forwarding.SetHeaders(pr.Out, pr.In, client)
+			},
+			ModifyResponse: func(response *http.Response) error {
+				span.SetAttributes(attribute.Int("http.response.status_code", response.StatusCode))
+				return nil
+			},
+			ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					httputils.WriteErrorResponse(w, errors.New(domain.ErrPayloadTooLarge))
+					return
+				}
+				slog.WarnContext(r.Context(), "Failed proxy request", "route", route.Name, "backend", target.URL.String(), "error", err)
+				if errors.Is(err, context.Canceled) {
+					httputils.WriteErrorResponse(w, errors.New(domain.ErrBadGateway))
+					return
+				}
+				if p.config.Metrics != nil {
+					p.config.Metrics.UpstreamError(route.Name, target.URL.String())
+				}
+
+				routeBalancer.MarkUnhealthy(target)
+				if canRetry && isDialError(err) {
+					retry = true
+					return
+				}
+				httputils.WriteErrorResponse(w, errors.New(domain.ErrBadGateway))
+			},
+		}
+		reverseProxy.ServeHTTP(w, r)
+		span.End()
+		if !retry {
+			return target
+		}
+
+		var affinityCookie *http.Cookie
+		target, affinityCookie = routeBalancer.Pick(r, route, client.Addr)
+		if affinityCookie != nil {
+			http.SetCookie(w, affinityCookie)
+		}
+	}
+}
+
+// Connection never established, the backend didn't see the request
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// Replace the request path by the rewrite template of the route, joined to
+// the target path afterward. The parameters are escaped already when the
+// route decode the path itself
+func rewritePath(out *http.Request, match *domain.RouteMatch) {
+	route := match.Route
+	if route.RewritePath == "" {
+		return
+	}
+	path := pathutils.Expand(route.RewritePath, match.Params) + match.Rest
+	if route.PathMatching != nil && route.PathMatching.DecodePercent {
+		setEscapedPath(out.URL, pathutils.EscapePath(path))
+		return
+	}
+	out.URL.Path = path
+	out.URL.RawPath = ""
+}
+
+func setEscapedPath(u *url.URL, escaped string) {
+	path, err := url.PathUnescape(escaped)
+	if err != nil {
+		return
+	}
+	u.Path, u.RawPath = path, escaped
+}
+
+// Set the headers of the route, a captured value can't break the header
+func setRequestHeaders(out *http.Request, match *domain.RouteMatch) {
+	for name, value := range match.Route.RequestHeaders {
+		value = pathutils.Expand(value, match.Params)
+		if strings.ContainsFunc(value, unicode.IsControl) {
+			slog.WarnContext(out.Context(), "Request header skipped, invalid value", "route", match.Route.Name, "header", name)
+			continue
+		}
+		out.Header.Set(name, value)
+	}
+}
@@ -0,0 +1,109 @@
+package forwarding
+
+import (
+	"net/netip"
+	"strings"
+)
+
+// One element of the RFC 7239 Forwarded header, added by a single proxy
+type forwardedElement struct {
+	For   string
+	Host  string
+	Proto string
+}
+
+// Parse the Forwarded header values into elements, commas and semicolons
+// inside quoted strings are part of the value
+func parseForwarded(values []string) []forwardedElement {
+	elements := make([]forwardedElement, 0)
+	for _, value := range values {
+		for _, rawElement := range splitQuoted(value, ',') {
+			element := forwardedElement{}
+			for _, pair := range splitQuoted(rawElement, ';') {
+				key, pairValue, found := strings.Cut(pair, "=")
+				if !found {
+					continue
+				}
+				pairValue = unquote(strings.TrimSpace(pairValue))
+				switch strings.ToLower(strings.TrimSpace(key)) {
+				case "for":
+					element.For = pairValue
+				case "host":
+					element.Host = pairValue
+				case "proto":
+					element.Proto = pairValue
+				}
+			}
+			elements = append(elements, element)
+		}
+	}
+	return elements
+}
+
+func formatForwarded(element forwardedElement) string {
+	pairs := make([]string, 0, 3)
+	if element.For != "" {
+		forValue := element.For
+		// IPv6 address must be bracketed and quoted
+		if addr, err := netip.ParseAddr(forValue); err == nil && addr.Is6() {
+			forValue = "[" + forValue + "]"
+		}
+		pairs = append(pairs, "for="+quote(forValue))
+	}
+	if element.Host != "" {
+		pairs = append(pairs, "host="+quote(element.Host))
+	}
+	if element.Proto != "" {
+		pairs = append(pairs, "proto="+quote(element.Proto))
+	}
+	return strings.Join(pairs, ";")
+}
+
+func splitQuoted(value string, separator byte) []string {
+	result := make([]string, 0)
+	inQuote := false
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == '\\' && inQuote:
+			i++
+		case value[i] == '"':
+			inQuote = !inQuote
+		case value[i] == separator && !inQuote:
+			result = append(result, strings.TrimSpace(value[start:i]))
+			start = i + 1
+		}
+	}
+	return append(result, strings.TrimSpace(value[start:]))
+}
+
+func unquote(value string) string {
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return value
+	}
+	value = value[1 : len(value)-1]
+	var builder strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) {
+			i++
+		}
+		builder.WriteByte(value[i])
+	}
+	return builder.String()
+}
+
+// Value is quoted unless it is a valid token
+func quote(value string) string {
+	isToken := value != ""
+	for _, c := range value {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("!#$%&'*+-.^_`|~", c)) {
+			isToken = false
+			break
+		}
+	}
+	if isToken {
+		return value
+	}
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	return `"` + replacer.Replace(value) + `"`
+}
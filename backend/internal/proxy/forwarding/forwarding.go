@@ -0,0 +1,187 @@
+package forwarding
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"test/portal/pkg/iputils"
+	"test/portal/pkg/validations"
+)
+
+// Client describe the original request as seen by the first proxy in front
+// of the client, resolved from the headers of trusted peers only
+type Client struct {
+	// Real client address
+	Addr netip.Addr
+	// Scheme and host requested by the client
+	Proto string
+	Host  string
+
+	// Connection peer and whether it is allowed to report forwarding headers
+	Peer        netip.Addr
+	TrustedPeer bool
+}
+
+/*
+Resolve the client of the request.
+The connection peer is the client unless it is one of the trusted proxies,
+in that case the RFC 7239 Forwarded header (or X-Forwarded-For when absent)
+is walked from right to left and the first hop that is not a trusted proxy
+is the client. Hops appended by untrusted peers are never used.
+*/
+func Resolve(r *http.Request, trusted []netip.Prefix) (Client, error) {
+	peer, err := iputils.ParseAddr(r.RemoteAddr)
+	if err != nil {
+		return Client{}, err
+	}
+
+	client := Client{
+		Addr:        peer,
+		Proto:       requestProto(r),
+		Host:        r.Host,
+		Peer:        peer,
+		TrustedPeer: iputils.Contains(trusted, peer),
+	}
+	if !client.TrustedPeer {
+		return client, nil
+	}
+
+	if values := r.Header.Values("Forwarded"); len(values) > 0 {
+		resolveForwarded(&client, parseForwarded(values), trusted)
+		return client, nil
+	}
+
+	resolveXForwarded(&client, r.Header, trusted)
+	return client, nil
+}
+
+func resolveForwarded(client *Client, elements []forwardedElement, trusted []netip.Prefix) {
+	for i := len(elements) - 1; i >= 0; i-- {
+		hop, err := iputils.ParseAddr(elements[i].For)
+		if err != nil {
+			// Obfuscated, unknown or malformed hop, stop at the last one we could trust
+			return
+		}
+		client.Addr = hop
+		// The element describe the connection made by the hop
+		if proto, ok := forwardedProto(elements[i].Proto); ok {
+			client.Proto = proto
+		}
+		if isForwardedHost(elements[i].Host) {
+			client.Host = elements[i].Host
+		}
+		if !iputils.Contains(trusted, hop) {
+			return
+		}
+	}
+}
+
+func resolveXForwarded(client *Client, header http.Header, trusted []netip.Prefix) {
+	hops := splitList(header.Values("X-Forwarded-For"))
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := iputils.ParseAddr(hops[i])
+		if err != nil {
+			return
+		}
+		client.Addr = hop
+		if !iputils.Contains(trusted, hop) {
+			break
+		}
+	}
+
+	// Scheme and host are set by the edge proxy, the left most value is the client one
+	if protos := splitList(header.Values("X-Forwarded-Proto")); len(protos) > 0 {
+		if proto, ok := forwardedProto(protos[0]); ok {
+			client.Proto = proto
+		}
+	}
+	if hosts := splitList(header.Values("X-Forwarded-Host")); len(hosts) > 0 && isForwardedHost(hosts[0]) {
+		client.Host = hosts[0]
+	}
+}
+
+// Reported scheme, only http and https are kept since it end up in the
+// headers sent to the backend, the redirects and the cache key
+func forwardedProto(value string) (string, bool) {
+	proto := strings.ToLower(value)
+	return proto, proto == "http" || proto == "https"
+}
+
+// Reported host, a host name or a bracketed IPv6 address with an optional
+// port
+func isForwardedHost(value string) bool {
+	host := value
+	if h, port, err := net.SplitHostPort(value); err == nil {
+		if number, err := strconv.Atoi(port); err != nil || number < 1 || number > 65535 {
+			return false
+		}
+		host = h
+	} else if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+		host = value[1 : len(value)-1]
+	} else if strings.Contains(value, ":") {
+		return false
+	}
+	if strings.Contains(host, ":") {
+		addr, err := netip.ParseAddr(host)
+		return err == nil && addr.Is6() && addr.Zone() == ""
+	}
+	return validations.IsHostName(host)
+}
+
+/*
+Set the forwarding headers of the outgoing request to the backend.
+The chains reported by trusted peers are kept and extended with the peer,
+anything sent by an untrusted peer is dropped and started again.
+*/
+func SetHeaders(out *http.Request, in *http.Request, client Client) {
+	RemoveHeaders(out)
+
+	forwardedFor := make([]string, 0)
+	forwarded := make([]string, 0)
+	if client.TrustedPeer {
+		forwardedFor = append(forwardedFor, splitList(in.Header.Values("X-Forwarded-For"))...)
+		forwarded = append(forwarded, in.Header.Values("Forwarded")...)
+	}
+
+	forwardedFor = append(forwardedFor, client.Peer.String())
+	forwarded = append(forwarded, formatForwarded(forwardedElement{
+		For:   client.Peer.String(),
+		Host:  in.Host,
+		Proto: requestProto(in),
+	}))
+
+	out.Header.Set("X-Forwarded-For", strings.Join(forwardedFor, ", "))
+	out.Header.Set("Forwarded", strings.Join(forwarded, ", "))
+	out.Header.Set("X-Forwarded-Proto", client.Proto)
+	out.Header.Set("X-Forwarded-Host", client.Host)
+}
+
+// Remove every forwarding header, used when the route opt out of forwarding
+func RemoveHeaders(out *http.Request) {
+	out.Header.Del("Forwarded")
+	out.Header.Del("X-Forwarded-For")
+	out.Header.Del("X-Forwarded-Proto")
+	out.Header.Del("X-Forwarded-Host")
+}
+
+func requestProto(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+func splitList(values []string) []string {
+	result := make([]string, 0)
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			item = strings.TrimSpace(item)
+			if item != "" {
+				result = append(result, item)
+			}
+		}
+	}
+	return result
+}
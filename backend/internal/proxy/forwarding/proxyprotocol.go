@@ -0,0 +1,189 @@
+package forwarding
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"test/portal/pkg/iputils"
+	"time"
+)
+
+var (
+	proxyProtocolV1Prefix  = []byte("PROXY ")
+	proxyProtocolSignature = []byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A}
+
+	errInvalidProxyHeader = errors.New("invalid PROXY protocol header")
+)
+
+const (
+	// Longest v1 header including CRLF
+	proxyProtocolV1MaxLength = 107
+	proxyProtocolTimeout     = 5 * time.Second
+)
+
+/*
+Listener accept the PROXY protocol v1 and v2 header sent by a load balancer
+in front of the proxy. The header is only read from trusted peers, the
+connection of any other peer is served as is so it can't spoof its address.
+*/
+type Listener struct {
+	net.Listener
+	Trusted []netip.Prefix
+}
+
+func NewListener(listener net.Listener, trusted []netip.Prefix) *Listener {
+	return &Listener{
+		Listener: listener,
+		Trusted:  trusted,
+	}
+}
+
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	peer, err := iputils.ParseAddr(conn.RemoteAddr().String())
+	if err != nil || !iputils.Contains(l.Trusted, peer) {
+		return conn, nil
+	}
+	return &proxyProtocolConn{Conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+// Header is read lazily on first use so a slow peer doesn't block Accept
+type proxyProtocolConn struct {
+	net.Conn
+	reader     *bufio.Reader
+	once       sync.Once
+	remoteAddr net.Addr
+	err        error
+}
+
+func (c *proxyProtocolConn) init() {
+	c.once.Do(func() {
+		c.Conn.SetReadDeadline(time.Now().Add(proxyProtocolTimeout))
+		defer c.Conn.SetReadDeadline(time.Time{})
+
+		c.remoteAddr, c.err = readProxyHeader(c.reader)
+		if c.err != nil {
+			c.Conn.Close()
+		}
+	})
+}
+
+func (c *proxyProtocolConn) Read(b []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+func (c *proxyProtocolConn) RemoteAddr() net.Addr {
+	c.init()
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// Read the header when present, nil address mean the connection peer is kept
+func readProxyHeader(reader *bufio.Reader) (net.Addr, error) {
+	prefix, err := reader.Peek(len(proxyProtocolV1Prefix))
+	if err != nil {
+		// Too short to hold a header, let the HTTP server deal with it
+		return nil, nil
+	}
+	if bytes.Equal(prefix, proxyProtocolV1Prefix) {
+		return readProxyHeaderV1(reader)
+	}
+
+	signature, err := reader.Peek(len(proxyProtocolSignature))
+	if err == nil && bytes.Equal(signature, proxyProtocolSignature) {
+		return readProxyHeaderV2(reader)
+	}
+	return nil, nil
+}
+
+// PROXY TCP4 192.0.2.10 198.51.100.1 56324 443\r\n
+func readProxyHeaderV1(reader *bufio.Reader) (net.Addr, error) {
+	line := make([]byte, 0, proxyProtocolV1MaxLength)
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) >= proxyProtocolV1MaxLength {
+			return nil, errInvalidProxyHeader
+		}
+		b, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+	}
+
+	fields := strings.Fields(strings.TrimSuffix(string(line), "\r\n"))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, errInvalidProxyHeader
+	}
+
+	addr, err := netip.ParseAddr(fields[2])
+	if err != nil || addr.Is4() != (fields[1] == "TCP4") {
+		return nil, errInvalidProxyHeader
+	}
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, errInvalidProxyHeader
+	}
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(addr, uint16(port))), nil
+}
+
+func readProxyHeaderV2(reader *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, err
+	}
+	version, command := header[12]>>4, header[12]&0x0F
+	family, protocol := header[13]>>4, header[13]&0x0F
+	length := int(binary.BigEndian.Uint16(header[14:16]))
+	if version != 2 || command > 1 {
+		return nil, errInvalidProxyHeader
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return nil, err
+	}
+
+	// LOCAL command (health check of the balancer) and non TCP keep the peer
+	if command == 0 || protocol != 1 {
+		return nil, nil
+	}
+
+	switch family {
+	case 1:
+		if length < 12 {
+			return nil, errInvalidProxyHeader
+		}
+		addr := netip.AddrFrom4([4]byte(payload[0:4]))
+		port := binary.BigEndian.Uint16(payload[8:10])
+		return net.TCPAddrFromAddrPort(netip.AddrPortFrom(addr, port)), nil
+	case 2:
+		if length < 36 {
+			return nil, errInvalidProxyHeader
+		}
+		addr := netip.AddrFrom16([16]byte(payload[0:16]))
+		port := binary.BigEndian.Uint16(payload[32:34])
+		return net.TCPAddrFromAddrPort(netip.AddrPortFrom(addr, port)), nil
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,43 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"test/portal/domain"
+	"test/portal/pkg/httputils"
+)
+
+// Check the request against the route limits, the body limit is enforced
+// again while streaming since the length is not always known up front
+func checkRequestLimits(route *domain.RouteItem, w http.ResponseWriter, r *http.Request) error {
+	if route.MaxRequestHeaderBytes > 0 && headerSize(r) > route.MaxRequestHeaderBytes {
+		return errors.New(domain.ErrHeaderTooLarge)
+	}
+
+	hasBody := r.ContentLength != 0 && r.Body != nil && r.Body != http.NoBody
+	if hasBody && len(route.AllowedContentTypes) > 0 && !httputils.MatchMediaType(route.AllowedContentTypes, r.Header.Get("Content-Type")) {
+		return errors.New(domain.ErrUnsupportedMediaType)
+	}
+
+	if route.MaxRequestBodyBytes > 0 {
+		if r.ContentLength > route.MaxRequestBodyBytes {
+			return errors.New(domain.ErrPayloadTooLarge)
+		}
+		if hasBody {
+			r.Body = http.MaxBytesReader(w, r.Body, route.MaxRequestBodyBytes)
+		}
+	}
+	return nil
+}
+
+// Size of the request line and header fields as sent on the wire
+func headerSize(r *http.Request) int64 {
+	size := int64(len(r.Method) + len(r.RequestURI) + len(r.Proto) + 4)
+	size += int64(len("Host: ") + len(r.Host) + 2)
+	for key, values := range r.Header {
+		for _, value := range values {
+			size += int64(len(key) + len(value) + 4)
+		}
+	}
+	return size
+}
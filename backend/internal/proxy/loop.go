@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Pseudonym of the portal in the Via header when Config.ViaName is empty
+const defaultViaName = "route-portal"
+
+func (p *Proxy) viaName() string {
+	if p.config.ViaName != "" {
+		return p.config.ViaName
+	}
+	return defaultViaName
+}
+
+// The request looped when it already went through the portal MaxLoopHops times
+func (p *Proxy) isLoop(r *http.Request) bool {
+	maxHops := p.config.MaxLoopHops
+	if maxHops <= 0 {
+		maxHops = 1
+	}
+	return countHops(r.Header, p.viaName()) >= maxHops
+}
+
+// Number of Via entries received by the pseudonym, an entry is
+// "[protocol-name/]protocol-version received-by [comment]"
+func countHops(header http.Header, name string) int {
+	hops := 0
+	for _, value := range header.Values("Via") {
+		for _, entry := range strings.Split(value, ",") {
+			fields := strings.Fields(entry)
+			if len(fields) >= 2 && strings.EqualFold(fields[1], name) {
+				hops++
+			}
+		}
+	}
+	return hops
+}
+
+// Append the portal to the Via entries of the forwarded request
+func (p *Proxy) addVia(out *http.Request, in *http.Request) {
+	version := strconv.Itoa(in.ProtoMajor)
+	if in.ProtoMajor < 2 {
+		version += "." + strconv.Itoa(in.ProtoMinor)
+	}
+	out.Header.Add("Via", version+" "+p.viaName())
+}
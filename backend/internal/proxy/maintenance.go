@@ -0,0 +1,43 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"test/portal/domain"
+	"test/portal/pkg/httputils"
+	"test/portal/pkg/iputils"
+)
+
+// Route under maintenance answer 503 unless the client is allowed to bypass it
+func isUnderMaintenance(route *domain.RouteItem, r *http.Request, clientIP netip.Addr) bool {
+	maintenance := route.Maintenance
+	if maintenance == nil || !maintenance.Enabled {
+		return false
+	}
+
+	if maintenance.BypassHeader != "" && r.Header.Get(maintenance.BypassHeader) == maintenance.BypassHeaderValue {
+		return false
+	}
+	bypass, err := iputils.ParsePrefixes(maintenance.BypassCIDRs)
+	if err == nil && iputils.Contains(bypass, clientIP) {
+		return false
+	}
+	return true
+}
+
+func writeMaintenanceResponse(w http.ResponseWriter, maintenance *domain.RouteMaintenance) {
+	w.Header().Set("Cache-Control", "no-store")
+	if maintenance.RetryAfterSeconds > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(maintenance.RetryAfterSeconds))
+	}
+
+	if maintenance.Body == "" {
+		httputils.WriteErrorResponse(w, errors.New(domain.ErrUnavailable))
+		return
+	}
+	w.Header().Set("Content-Type", maintenance.ContentType+"; charset=utf-8")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	w.Write([]byte(maintenance.Body))
+}
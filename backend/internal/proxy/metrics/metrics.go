@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+/*
+Metrics of the proxied traffic. Labels are limited to values bounded by the
+configuration: route name, backend URL as configured and the status class,
+never the request path, host or client.
+*/
+type Metrics struct {
+	requests       *prometheus.CounterVec
+	duration       *prometheus.HistogramVec
+	responseSize   *prometheus.HistogramVec
+	inFlight       *prometheus.GaugeVec
+	upstreamErrors *prometheus.CounterVec
+}
+
+func New(registerer prometheus.Registerer) *Metrics {
+	labels := []string{"route", "backend", "status_class"}
+	m := &Metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "portal_proxy_requests_total",
+			Help: "Requests served by the proxy.",
+		}, labels),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "portal_proxy_request_duration_seconds",
+			Help:    "Time to serve a proxied request, upstream included.",
+			Buckets: prometheus.DefBuckets,
+		}, labels),
+		responseSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "portal_proxy_response_size_bytes",
+			Help:    "Size of the response body sent to the client.",
+			Buckets: prometheus.ExponentialBuckets(100, 10, 7),
+		}, labels),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "portal_proxy_requests_in_flight",
+			Help: "Requests being served by the proxy.",
+		}, []string{"route"}),
+		upstreamErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "portal_proxy_upstream_errors_total",
+			Help: "Requests that failed to get a response from the backend.",
+		}, []string{"route", "backend"}),
+	}
+	registerer.MustRegister(m.requests, m.duration, m.responseSize, m.inFlight, m.upstreamErrors)
+	return m
+}
+
+// TrackInFlight count the request as in flight until the returned func is called
+func (m *Metrics) TrackInFlight(route string) func() {
+	gauge := m.inFlight.WithLabelValues(route)
+	gauge.Inc()
+	return gauge.Dec
+}
+
+// ObserveRequest record a served request, backend is empty when the response
+// didn't come from a backend (cache hit, rejected request)
+func (m *Metrics) ObserveRequest(route string, backend string, status int, size int64, latency time.Duration) {
+	statusClass := StatusClass(status)
+	m.requests.WithLabelValues(route, backend, statusClass).Inc()
+	m.duration.WithLabelValues(route, backend, statusClass).Observe(latency.Seconds())
+	m.responseSize.WithLabelValues(route, backend, statusClass).Observe(float64(size))
+}
+
+func (m *Metrics) UpstreamError(route string, backend string) {
+	m.upstreamErrors.WithLabelValues(route, backend).Inc()
+}
+
+// StatusClass group the status codes by hundred, 404 give 4xx
+func StatusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "unknown"
+	}
+	return strconv.Itoa(status/100) + "xx"
+}
@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"test/portal/domain"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type BackendHealth struct {
+	Route   string
+	Backend string
+	Healthy bool
+}
+
+type HealthSource interface {
+	BackendHealth() []BackendHealth
+}
+
+var (
+	routesDesc = prometheus.NewDesc(
+		"portal_routes",
+		"Configured routes by state.",
+		[]string{"state"}, nil,
+	)
+	backendHealthyDesc = prometheus.NewDesc(
+		"portal_proxy_backend_healthy",
+		"Passive health of the route backends, 1 when in rotation.",
+		[]string{"route", "backend"}, nil,
+	)
+)
+
+// StateCollector read the route counts and backend health at scrape time, so
+// deleted routes disappear from the gauges
+type StateCollector struct {
+	routes domain.RouteItemUsecase
+	health HealthSource
+}
+
+func NewStateCollector(routes domain.RouteItemUsecase, health HealthSource) *StateCollector {
+	return &StateCollector{routes: routes, health: health}
+}
+
+func (c *StateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- routesDesc
+	ch <- backendHealthyDesc
+}
+
+func (c *StateCollector) Collect(ch chan<- prometheus.Metric) {
+	routes, err := c.routes.GetAll(context.Background())
+	if err != nil {
+		slog.Error("Failed collect route metrics", "error", err)
+		return
+	}
+
+	enabled, disabled := 0, 0
+	names := make(map[string]bool, len(routes))
+	for _, route := range routes {
+		names[route.Name] = true
+		if route.Enabled != nil && *route.Enabled {
+			enabled++
+		} else {
+			disabled++
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(routesDesc, prometheus.GaugeValue, float64(enabled), "enabled")
+	ch <- prometheus.MustNewConstMetric(routesDesc, prometheus.GaugeValue, float64(disabled), "disabled")
+
+	for _, health := range c.health.BackendHealth() {
+		if !names[health.Route] {
+			continue
+		}
+		value := 0.0
+		if health.Healthy {
+			value = 1
+		}
+		ch <- prometheus.MustNewConstMetric(backendHealthyDesc, prometheus.GaugeValue, value, health.Route, health.Backend)
+	}
+}
@@ -0,0 +1,308 @@
+package proxy
+
+import (
+	"errors"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"test/portal/domain"
+	"test/portal/internal/proxy/accesslog"
+	"test/portal/internal/proxy/balancer"
+	"test/portal/internal/proxy/cache"
+	"test/portal/internal/proxy/compress"
+	"test/portal/internal/proxy/drain"
+	"test/portal/internal/proxy/forwarding"
+	"test/portal/internal/proxy/metrics"
+	"test/portal/pkg/httputils"
+	"test/portal/pkg/traceutils"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type Config struct {
+	// Peers allowed to report the client through Forwarded, X-Forwarded-*
+	// and PROXY protocol headers
+	TrustedProxies []netip.Prefix
+	// Shared response cache of the routes with a cache policy
+	Cache *cache.Cache
+	// Access log of the routes enabling it, nil disable access logging
+	AccessLog *accesslog.Logger
+	// Prometheus metrics of the proxied traffic, nil disable them
+	Metrics *metrics.Metrics
+	// Source of the fault injection decisions in [0, 1), rand.Float64 when nil
+	Random func() float64
+	// Directory holding the directories of the static routes
+	StaticRoot string
+	// In-flight requests by route, drained when the route is disabled or
+	// deleted. nil leave the requests run until they end
+	Drain *drain.Tracker
+	// Pseudonym of the portal in the Via header, "route-portal" when empty
+	ViaName string
+	// Requests that already went through the portal this many times are
+	// answered 508 Loop Detected, 1 when 0
+	MaxLoopHops int
+}
+
+// Proxy is the data plane, it forward the incoming traffic to the backend
+// of the route matching the request host and path
+type Proxy struct {
+	usecase domain.RouteItemUsecase
+	config  Config
+
+	// Balancer state by route name, kept across requests. The balancers of
+	// the routes gone are dropped when the route index is rebuilt
+	balancersMu         sync.Mutex
+	balancers           map[string]*balancer.Balancer
+	balancersGeneration uint64
+
+	transports *transportPool
+}
+
+func NewProxy(usecase domain.RouteItemUsecase, config Config) *Proxy {
+	return &Proxy{
+		usecase:    usecase,
+		config:     config,
+		balancers:  make(map[string]*balancer.Balancer),
+		transports: newTransportPool(),
+	}
+}
+
+func (p *Proxy) random() float64 {
+	if p.config.Random != nil {
+		return p.config.Random()
+	}
+	return rand.Float64()
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, span := traceutils.Start(traceutils.Extract(r.Context(), r.Header), "Proxy.ServeHTTP",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("http.request.method", r.Method),
+			attribute.String("server.address", r.Host),
+			attribute.String("url.path", r.URL.Path),
+		))
+	defer span.End()
+	r = r.WithContext(ctx)
+
+	match, err := p.usecase.MatchRoute(r.Context(), r.Host, r.URL)
+	if err != nil {
+		if err.Error() == domain.ErrNotFound {
+			span.SetAttributes(attribute.Int("http.response.status_code", http.StatusNotFound))
+		}
+		httputils.WriteErrorResponse(w, err)
+		return
+	}
+	route := match.Route
+	span.SetAttributes(attribute.String("portal.route", route.Name))
+	p.pruneBalancers(match)
+
+	if p.config.Metrics != nil {
+		defer p.config.Metrics.TrackInFlight(route.Name)()
+	}
+	if p.config.Drain != nil {
+		drainCtx, done := p.config.Drain.Begin(r.Context(), route.Name, isUpgrade(r))
+		defer done()
+		r = r.WithContext(drainCtx)
+	}
+
+	start := time.Now()
+	entry := accesslog.Entry{
+		Time:      start,
+		Route:     route.Name,
+		Method:    r.Method,
+		Host:      r.Host,
+		Path:      r.URL.Path,
+		Proto:     r.Proto,
+		RequestID: r.Header.Get("X-Request-ID"),
+		Referer:   r.Referer(),
+		UserAgent: r.UserAgent(),
+	}
+	recorder := httputils.NewRecorder(w)
+	p.serveRoute(recorder, r, match, &entry)
+	entry.Status = recorder.StatusCode()
+	entry.Bytes = recorder.Bytes
+	entry.Latency = time.Since(start)
+
+	span.SetAttributes(attribute.Int("http.response.status_code", entry.Status))
+	if entry.Status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(entry.Status))
+	}
+	if p.config.Metrics != nil {
+		p.config.Metrics.ObserveRequest(route.Name, entry.Upstream, entry.Status, entry.Bytes, entry.Latency)
+	}
+	if p.config.AccessLog != nil && p.config.AccessLog.Sampled(route) {
+		p.config.AccessLog.Log(entry)
+	}
+}
+
+// Serve the request of the matched route, the client and the upstream target
+// are reported in the access log entry
+func (p *Proxy) serveRoute(w http.ResponseWriter, r *http.Request, match *domain.RouteMatch, entry *accesslog.Entry) {
+	route := match.Route
+	if p.isLoop(r) {
+		slog.WarnContext(r.Context(), "Proxy loop detected", "route", route.Name, "via", r.Header.Values("Via"))
+		httputils.WriteErrorResponse(w, errors.New(domain.ErrLoopDetected))
+		return
+	}
+
+	if match.Redirect != "" {
+		redirectStatus := http.StatusPermanentRedirect
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			redirectStatus = http.StatusMovedPermanently
+		}
+		http.Redirect(w, r, match.Redirect, redirectStatus)
+		return
+	}
+	// The backend see the path the route matched
+	if route.PathMatching != nil && (route.PathMatching.MergeSlashes || route.PathMatching.DecodePercent) {
+		setEscapedPath(r.URL, match.Path)
+	}
+
+	client, err := forwarding.Resolve(r, p.config.TrustedProxies)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Unable to resolve client address", "remote_addr", r.RemoteAddr, "error", err)
+		httputils.WriteErrorResponse(w, errors.New(domain.ErrBadRequest))
+		return
+	}
+	entry.ClientIP = client.Addr.String()
+
+	if !isAllowed(route, client.Addr) {
+		httputils.WriteErrorResponse(w, errors.New(domain.ErrForbidden))
+		return
+	}
+
+	if isUnderMaintenance(route, r, client.Addr) {
+		writeMaintenanceResponse(w, route.Maintenance)
+		return
+	}
+
+	if err := checkRequestLimits(route, w, r); err != nil {
+		httputils.WriteErrorResponse(w, err)
+		return
+	}
+
+	if !p.injectFaults(w, r, route) {
+		return
+	}
+
+	var upstream http.Handler
+	if route.Static != nil {
+		upstream = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p.serveStatic(w, r, match)
+		})
+	} else {
+		routeBalancer, err := p.balancer(match)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Invalid backend for route", "route", route.Name, "error", err)
+			httputils.WriteErrorResponse(w, errors.New(domain.ErrBadGateway))
+			return
+		}
+		target, affinityCookie := routeBalancer.Pick(r, route, client.Addr)
+		if affinityCookie != nil {
+			http.SetCookie(w, affinityCookie)
+		}
+		upstream = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			entry.Upstream = p.forward(w, r, match, client, routeBalancer, target).URL.String()
+		})
+	}
+	// Compression wrap the cache so the stored responses stay in identity
+	// encoding and are compressed for each client
+	if route.Cache != nil && route.Cache.Enabled && p.config.Cache != nil {
+		next := upstream
+		upstream = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p.config.Cache.Handle(w, r, route, next)
+		})
+	}
+	if route.Compression != nil && route.Compression.Enabled {
+		next := upstream
+		upstream = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			compress.Handle(w, r, route.Compression, next)
+		})
+	}
+	upstream.ServeHTTP(w, r)
+}
+
+// Balancer of the matched route, rebuilt when its backends changed. A
+// request matched before the last prune doesn't store its balancer, the
+// route may be gone
+func (p *Proxy) balancer(match *domain.RouteMatch) (*balancer.Balancer, error) {
+	p.balancersMu.Lock()
+	defer p.balancersMu.Unlock()
+
+	route := match.Route
+	targets := route.Targets()
+	if existing, found := p.balancers[route.Name]; found && existing.Signature() == balancer.Signature(targets) {
+		return existing, nil
+	}
+	routeBalancer, err := balancer.New(targets, time.Now)
+	if err != nil {
+		return nil, err
+	}
+	if match.Generation >= p.balancersGeneration {
+		p.balancers[route.Name] = routeBalancer
+	}
+	return routeBalancer, nil
+}
+
+// Drop the balancers of the routes deleted or renamed, once per rebuild of
+// the route index. Requests matched against an older index leave them be
+func (p *Proxy) pruneBalancers(match *domain.RouteMatch) {
+	p.balancersMu.Lock()
+	defer p.balancersMu.Unlock()
+	if match.Generation <= p.balancersGeneration {
+		return
+	}
+	p.balancersGeneration = match.Generation
+
+	names := make(map[string]bool, len(match.RouteNames))
+	for _, name := range match.RouteNames {
+		names[name] = true
+	}
+	for name := range p.balancers {
+		if !names[name] {
+			delete(p.balancers, name)
+		}
+	}
+}
+
+// BackendHealth report the passive health of the backends of the routes
+// served so far
+func (p *Proxy) BackendHealth() []metrics.BackendHealth {
+	p.balancersMu.Lock()
+	defer p.balancersMu.Unlock()
+
+	now := time.Now()
+	result := make([]metrics.BackendHealth, 0, len(p.balancers))
+	for routeName, routeBalancer := range p.balancers {
+		for _, target := range routeBalancer.Targets() {
+			result = append(result, metrics.BackendHealth{
+				Route:   routeName,
+				Backend: target.URL.String(),
+				Healthy: target.IsHealthy(now),
+			})
+		}
+	}
+	return result
+}
+
+// WebSocket and other upgrades keep their request running for the whole connection
+func isUpgrade(r *http.Request) bool {
+	if r.Header.Get("Upgrade") == "" {
+		return false
+	}
+	for _, value := range r.Header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,191 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"test/portal/domain"
+	"test/portal/pkg/fileutils"
+	"test/portal/pkg/httputils"
+	"test/portal/pkg/pathutils"
+)
+
+const defaultIndexFile = "index.html"
+
+/*
+Serve the files of a static route. Files are opened through os.Root so
+neither ".." nor a symbolic link can leave the route directory, and hidden
+files (any segment starting with a dot) are never served.
+*/
+func (p *Proxy) serveStatic(w http.ResponseWriter, r *http.Request, match *domain.RouteMatch) {
+	route := match.Route
+	static := route.Static
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		httputils.WriteErrorResponse(w, errors.New(domain.ErrMethodNotAllowed))
+		return
+	}
+
+	// Checked again here, the routes file may have been edited by hand
+	dir, err := fileutils.ResolveDirUnder(p.config.StaticRoot, static.Directory)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Invalid static directory for route", "route", route.Name, "error", err)
+		httputils.WriteErrorResponse(w, errors.New(domain.ErrBadGateway))
+		return
+	}
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed open static directory", "route", route.Name, "error", err)
+		httputils.WriteErrorResponse(w, errors.New(domain.ErrBadGateway))
+		return
+	}
+	defer root.Close()
+
+	name := staticName(match)
+	indexFile := static.IndexFile
+	if indexFile == "" {
+		indexFile = defaultIndexFile
+	}
+
+	file, info, err := openStatic(root, name)
+	if err == nil && info.IsDir() {
+		file.Close()
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			// Built from the cleaned name, never from the raw request path
+			location := staticBase(match) + "/" + strings.TrimPrefix(name+"/", "./")
+			if r.URL.RawQuery != "" {
+				location += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, location, http.StatusMovedPermanently)
+			return
+		}
+
+		index, indexInfo, indexErr := openStatic(root, path.Join(name, indexFile))
+		if indexErr == nil && !indexInfo.IsDir() {
+			defer index.Close()
+			serveStaticFile(w, r, index, indexInfo, static, true)
+			return
+		}
+		if indexErr == nil {
+			index.Close()
+		}
+		if static.DirectoryListing {
+			writeDirectoryListing(w, r, root, name)
+			return
+		}
+		err = fs.ErrNotExist
+	}
+
+	if err != nil {
+		if static.SPAFallback && path.Ext(name) == "" {
+			index, indexInfo, indexErr := openStatic(root, indexFile)
+			if indexErr == nil && !indexInfo.IsDir() {
+				defer index.Close()
+				serveStaticFile(w, r, index, indexInfo, static, true)
+				return
+			}
+			if indexErr == nil {
+				index.Close()
+			}
+		}
+		httputils.WriteErrorResponse(w, errors.New(domain.ErrNotFound))
+		return
+	}
+	defer file.Close()
+	serveStaticFile(w, r, file, info, static, path.Base(name) == indexFile)
+}
+
+// Clean path of the request relative to the route directory, "." for the
+// directory itself. It's taken from the match so the path matching options
+// of the route apply, a trailing wildcard serve the same files
+func staticName(match *domain.RouteMatch) string {
+	relative := match.Rest
+	if wildcard, found := match.Params[pathutils.Wildcard]; found {
+		relative = "/" + wildcard
+	}
+	name := strings.TrimPrefix(path.Clean("/"+relative), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+// Escaped path of the route directory in the URL, the route path without
+// wildcard and its parameters replaced by the captured values
+func staticBase(match *domain.RouteMatch) string {
+	base := strings.TrimSuffix(strings.TrimSuffix(match.Route.Path, pathutils.Wildcard), "/")
+	params := make(map[string]string, len(match.Params))
+	for name, value := range match.Params {
+		params[name] = url.PathEscape(value)
+	}
+	return pathutils.Expand(base, params)
+}
+
+func openStatic(root *os.Root, name string) (*os.File, fs.FileInfo, error) {
+	for _, segment := range strings.Split(name, "/") {
+		if segment != "." && strings.HasPrefix(segment, ".") {
+			return nil, nil, fs.ErrNotExist
+		}
+	}
+	file, err := root.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return file, info, nil
+}
+
+// Index documents are revalidated on every request so a new deployment is
+// picked up, the other files are cached for MaxAgeSeconds
+func serveStaticFile(w http.ResponseWriter, r *http.Request, file *os.File, info fs.FileInfo, static *domain.RouteStatic, isDocument bool) {
+	if isDocument {
+		w.Header().Set("Cache-Control", "no-cache")
+	} else if static.MaxAgeSeconds > 0 {
+		w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(static.MaxAgeSeconds))
+	}
+	http.ServeContent(w, r, info.Name(), info.ModTime(), file)
+}
+
+func writeDirectoryListing(w http.ResponseWriter, r *http.Request, root *os.Root, name string) {
+	dir, err := root.Open(name)
+	if err != nil {
+		httputils.WriteErrorResponse(w, errors.New(domain.ErrNotFound))
+		return
+	}
+	defer dir.Close()
+	entries, err := dir.ReadDir(-1)
+	if err != nil {
+		httputils.WriteErrorResponse(w, errors.New(domain.ErrInternalServer))
+		return
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	fmt.Fprintf(w, "<!doctype html>\n<title>Index of %s</title>\n<pre>\n", html.EscapeString(r.URL.Path))
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		entryName := entry.Name()
+		if entry.IsDir() {
+			entryName += "/"
+		}
+		link := url.URL{Path: entryName}
+		fmt.Fprintf(w, "<a href=\"%s\">%s</a>\n", html.EscapeString(link.String()), html.EscapeString(entryName))
+	}
+	fmt.Fprint(w, "</pre>\n")
+}
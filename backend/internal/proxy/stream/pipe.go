@@ -0,0 +1,85 @@
+package stream
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"time"
+)
+
+var errHelloRead = errors.New("client hello read")
+
+/*
+Read the ClientHello through a handshake that is aborted once the hello
+is parsed. Nothing is written to the client, the bytes read are returned
+in front of the connection so the upstream receive the untouched stream.
+*/
+func peekServerName(conn net.Conn) (string, io.Reader, error) {
+	peeked := new(bytes.Buffer)
+	var hello *tls.ClientHelloInfo
+	err := tls.Server(readOnlyConn{Conn: conn, reader: io.TeeReader(conn, peeked)}, &tls.Config{
+		GetConfigForClient: func(info *tls.ClientHelloInfo) (*tls.Config, error) {
+			hello = info
+			return nil, errHelloRead
+		},
+	}).Handshake()
+	if hello == nil {
+		return "", nil, err
+	}
+	return hello.ServerName, io.MultiReader(peeked, conn), nil
+}
+
+type readOnlyConn struct {
+	net.Conn
+	reader io.Reader
+}
+
+func (c readOnlyConn) Read(b []byte) (int, error)  { return c.reader.Read(b) }
+func (c readOnlyConn) Write(b []byte) (int, error) { return 0, io.ErrClosedPipe }
+func (c readOnlyConn) Close() error                { return nil }
+
+/*
+Copy both directions until each one is done. Any byte flowing push the
+deadline of both connections, so a connection only time out once it has
+been idle in both directions. The end of one direction is forwarded as a
+half close.
+*/
+func pipe(conn net.Conn, client io.Reader, upstream net.Conn, idleTimeout time.Duration) (sent int64, received int64) {
+	extend := func() {
+		deadline := time.Now().Add(idleTimeout)
+		conn.SetDeadline(deadline)
+		upstream.SetDeadline(deadline)
+	}
+	extend()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sent, _ = io.Copy(activityWriter{upstream, extend}, client)
+		closeWrite(upstream)
+	}()
+	received, _ = io.Copy(activityWriter{conn, extend}, upstream)
+	closeWrite(conn)
+	<-done
+	return sent, received
+}
+
+type activityWriter struct {
+	conn   net.Conn
+	extend func()
+}
+
+func (w activityWriter) Write(b []byte) (int, error) {
+	w.extend()
+	return w.conn.Write(b)
+}
+
+func closeWrite(conn net.Conn) {
+	if halfCloser, ok := conn.(interface{ CloseWrite() error }); ok {
+		halfCloser.CloseWrite()
+		return
+	}
+	conn.Close()
+}
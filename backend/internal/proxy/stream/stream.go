@@ -0,0 +1,220 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"test/portal/domain"
+	"time"
+)
+
+type Config struct {
+	// Address the stream ports are bound on, every interface when empty
+	ListenHost string
+	// Idle timeout of the routes without their own, 5 minutes when 0
+	IdleTimeout time.Duration
+	// Timeout to connect the upstream, 10 seconds when 0
+	DialTimeout time.Duration
+	// Time allowed to receive the TLS ClientHello on SNI routed ports, 10 seconds when 0
+	HandshakeTimeout time.Duration
+}
+
+/*
+Proxy is the L4 data plane of the stream routes. It listen on the ports
+of the enabled stream routes and forward the connections byte for byte,
+TLS is never terminated: on SNI routed ports only the ClientHello is read
+to pick the route, then replayed to the upstream.
+*/
+type Proxy struct {
+	usecase domain.StreamRouteUsecase
+	config  Config
+
+	mu        sync.Mutex
+	listeners map[int]net.Listener
+}
+
+func NewProxy(usecase domain.StreamRouteUsecase, config Config) *Proxy {
+	if config.IdleTimeout == 0 {
+		config.IdleTimeout = 5 * time.Minute
+	}
+	if config.DialTimeout == 0 {
+		config.DialTimeout = 10 * time.Second
+	}
+	if config.HandshakeTimeout == 0 {
+		config.HandshakeTimeout = 10 * time.Second
+	}
+	return &Proxy{
+		usecase:   usecase,
+		config:    config,
+		listeners: make(map[int]net.Listener),
+	}
+}
+
+// Run keep the listeners in sync with the stream routes until the context is done
+func (p *Proxy) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	defer p.Close()
+	for {
+		if err := p.Sync(ctx); err != nil {
+			slog.Error("Failed sync stream listeners", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync open a listener for each port of the enabled stream routes and close
+// the ones no route use anymore. Connections already forwarded are kept
+func (p *Proxy) Sync(ctx context.Context) error {
+	routes, err := p.usecase.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+	ports := make(map[int]bool)
+	for _, route := range routes {
+		if route.Enabled != nil && *route.Enabled {
+			ports[route.ListenPort] = true
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for port, listener := range p.listeners {
+		if !ports[port] {
+			listener.Close()
+			delete(p.listeners, port)
+			slog.Info("Stop stream listener", "port", port)
+		}
+	}
+	var errs []error
+	for port := range ports {
+		if _, found := p.listeners[port]; found {
+			continue
+		}
+		listener, err := net.Listen("tcp", net.JoinHostPort(p.config.ListenHost, strconv.Itoa(port)))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		p.listeners[port] = listener
+		slog.Info("Start stream listener", "port", port)
+		go p.serve(listener, port)
+	}
+	return errors.Join(errs...)
+}
+
+// Close stop every listener
+func (p *Proxy) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for port, listener := range p.listeners {
+		listener.Close()
+		delete(p.listeners, port)
+	}
+}
+
+func (p *Proxy) serve(listener net.Listener, port int) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				slog.Error("Stream listener stopped", "port", port, "error", err)
+			}
+			return
+		}
+		go p.handle(conn, port)
+	}
+}
+
+func (p *Proxy) handle(conn net.Conn, port int) {
+	defer conn.Close()
+	start := time.Now()
+
+	routes, err := p.usecase.GetAll(context.Background())
+	if err != nil {
+		slog.Error("Failed read stream routes", "error", err)
+		return
+	}
+	candidates := make([]domain.StreamRoute, 0, 1)
+	for _, route := range routes {
+		if route.ListenPort == port && route.Enabled != nil && *route.Enabled {
+			candidates = append(candidates, route)
+		}
+	}
+
+	// A plain TCP route own the port, otherwise route by server name
+	var route *domain.StreamRoute
+	var client io.Reader = conn
+	for i := range candidates {
+		if candidates[i].SNIHost == "" {
+			route = &candidates[i]
+		}
+	}
+	if route == nil {
+		conn.SetReadDeadline(time.Now().Add(p.config.HandshakeTimeout))
+		serverName, replay, err := peekServerName(conn)
+		conn.SetReadDeadline(time.Time{})
+		if err != nil {
+			slog.Debug("Unable to read the TLS server name", "port", port, "client", conn.RemoteAddr().String(), "error", err)
+			return
+		}
+		route = matchServerName(candidates, serverName)
+		if route == nil {
+			slog.Debug("No stream route for the server name", "port", port, "server_name", serverName)
+			return
+		}
+		client = replay
+	}
+
+	upstream, err := net.DialTimeout("tcp", route.Upstream, p.config.DialTimeout)
+	if err != nil {
+		slog.Warn("Failed connect stream upstream", "stream", route.Name, "upstream", route.Upstream, "error", err)
+		return
+	}
+	defer upstream.Close()
+
+	idleTimeout := p.config.IdleTimeout
+	if route.IdleTimeoutSeconds > 0 {
+		idleTimeout = time.Duration(route.IdleTimeoutSeconds) * time.Second
+	}
+	sent, received := pipe(conn, client, upstream, idleTimeout)
+	slog.Debug("Stream connection closed",
+		"stream", route.Name,
+		"client", conn.RemoteAddr().String(),
+		"upstream", route.Upstream,
+		"bytes_sent", sent,
+		"bytes_received", received,
+		"duration", time.Since(start),
+	)
+}
+
+// Exact server name first, then a *.example.com route covering one more label
+func matchServerName(routes []domain.StreamRoute, serverName string) *domain.StreamRoute {
+	if serverName == "" {
+		return nil
+	}
+	for i := range routes {
+		if strings.EqualFold(routes[i].SNIHost, serverName) {
+			return &routes[i]
+		}
+	}
+	_, parent, found := strings.Cut(serverName, ".")
+	if !found {
+		return nil
+	}
+	for i := range routes {
+		if wildcard, ok := strings.CutPrefix(routes[i].SNIHost, "*."); ok && strings.EqualFold(wildcard, parent) {
+			return &routes[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"log/slog"
+	"net/http"
+	"sync"
+	"test/portal/domain"
+	"test/portal/pkg/tlsutils"
+)
+
+// Upstream transports shared by every backend with the same TLS settings so
+// their connections are pooled together
+type transportPool struct {
+	mu         sync.Mutex
+	base       *http.Transport
+	transports map[domain.RouteBackendTLS]*http.Transport
+}
+
+func newTransportPool() *transportPool {
+	return &transportPool{
+		base:       http.DefaultTransport.(*http.Transport).Clone(),
+		transports: make(map[domain.RouteBackendTLS]*http.Transport),
+	}
+}
+
+func (t *transportPool) get(settings *domain.RouteBackendTLS) (*http.Transport, error) {
+	if settings == nil {
+		return t.base, nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if transport, found := t.transports[*settings]; found {
+		return transport, nil
+	}
+
+	tlsConfig, err := tlsutils.BuildClientConfig(*settings)
+	if err != nil {
+		return nil, err
+	}
+	if settings.InsecureSkipVerify {
+		slog.Warn("Certificate verification is disabled for an upstream transport")
+	}
+
+	transport := t.base.Clone()
+	transport.TLSClientConfig = tlsConfig
+	t.transports[*settings] = transport
+	return transport, nil
+}
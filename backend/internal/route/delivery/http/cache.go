@@ -0,0 +1,72 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"test/portal/domain"
+	"test/portal/pkg/httputils"
+)
+
+type RouteCacheDelivery struct {
+	cache domain.RouteCachePurger
+}
+
+func NewRouteCacheDelivery(
+	ctx context.Context,
+	cache domain.RouteCachePurger) *RouteCacheDelivery {
+
+	handler := &RouteCacheDelivery{
+		cache: cache,
+	}
+
+	http.HandleFunc("/cache/", func(w http.ResponseWriter, r *http.Request) {
+		// Set headers
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+
+		path := strings.Trim(r.URL.Path, "/")
+		parts := strings.Split(path, "/")
+
+		// /cache and /cache/{routeName}
+		if len(parts) <= 2 && parts[0] == "cache" {
+			switch r.Method {
+			case http.MethodDelete:
+				handler.Purge(ctx, w, r)
+			default:
+				w.WriteHeader(http.StatusOK)
+			}
+			return
+		}
+
+		// Anything else is 404
+		http.NotFound(w, r)
+	})
+
+	return handler
+}
+
+func NewTestRouteCacheDelivery(
+	ctx context.Context,
+	cache domain.RouteCachePurger) *RouteCacheDelivery {
+
+	handler := &RouteCacheDelivery{
+		cache: cache,
+	}
+
+	return handler
+}
+
+// Purge the cached responses of a route, or of every route when the name is
+// omitted, optionally limited to the paths starting with the prefix query
+func (h *RouteCacheDelivery) Purge(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	routeName := ""
+	if param := httputils.GetPathParamByPathPosition(r, 2); param != nil {
+		routeName = *param
+	}
+	pathPrefix := r.URL.Query().Get("prefix")
+
+	purged := h.cache.Purge(ctx, routeName, pathPrefix)
+	httputils.WriteSuccessResponse(w, domain.CachePurgeResult{Purged: purged})
+}
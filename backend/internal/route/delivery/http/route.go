@@ -3,10 +3,11 @@ package http
 import (
 	"context"
 	"errors"
-	"log"
 	"net/http"
+	"net/url"
 	"strings"
 	"test/portal/domain"
+	routemetrics "test/portal/internal/route/metrics"
 	"test/portal/pkg/httputils"
 
 	"github.com/go-playground/validator/v10"
@@ -20,13 +21,25 @@ type RouteDelivery struct {
 func NewRouteDelivery(
 	ctx context.Context,
 	validate *validator.Validate,
-	usecase domain.RouteItemUsecase) *RouteDelivery {
+	usecase domain.RouteItemUsecase,
+	metrics *routemetrics.Metrics) *RouteDelivery {
 
 	handler := &RouteDelivery{
 		usecase:  usecase,
 		validate: validate,
 	}
 
+	// Handlers instrumented by operation
+	create := metrics.Instrument("Create", handler.Create)
+	update := metrics.Instrument("Update", handler.Update)
+	getAll := metrics.Instrument("GetAll", handler.GetAll)
+	getOne := metrics.Instrument("GetOne", handler.GetOne)
+	deleteRoute := metrics.Instrument("Delete", handler.Delete)
+	setMaintenance := metrics.Instrument("SetMaintenance", handler.SetMaintenance)
+	getDrainStatus := metrics.Instrument("GetDrainStatus", handler.GetDrainStatus)
+	extendExpiry := metrics.Instrument("ExtendExpiry", handler.ExtendExpiry)
+	matchRoute := metrics.Instrument("MatchRoute", handler.MatchRoute)
+
 	http.HandleFunc("/routes/", func(w http.ResponseWriter, r *http.Request) {
 		// Set headers
 		w.Header().Set("Access-Control-Allow-Origin", "*")
@@ -36,16 +49,15 @@ func NewRouteDelivery(
 		// Check for path
 		path := strings.Trim(r.URL.Path, "/")
 		parts := strings.Split(path, "/")
-		log.Println("Path parts", parts)
 		// If the path contain path param for route by name handle it to specific func handler
 
 		if len(parts) == 1 && parts[0] == "routes" {
 			// /routes
 			switch r.Method {
 			case http.MethodGet:
-				handler.GetAll(ctx, w, r)
+				getAll(ctx, w, r)
 			case http.MethodPost:
-				handler.Create(ctx, w, r)
+				create(ctx, w, r)
 			default:
 				w.WriteHeader(http.StatusOK)
 			}
@@ -56,11 +68,44 @@ func NewRouteDelivery(
 			// /routes/{name}
 			switch r.Method {
 			case http.MethodGet:
-				handler.GetOne(ctx, w, r)
+				getOne(ctx, w, r)
 			case http.MethodPut:
-				handler.Update(ctx, w, r)
+				update(ctx, w, r)
 			case http.MethodDelete:
-				handler.Delete(ctx, w, r)
+				deleteRoute(ctx, w, r)
+			default:
+				w.WriteHeader(http.StatusOK)
+			}
+			return
+		}
+
+		if len(parts) == 3 && parts[0] == "routes" && parts[2] == "maintenance" {
+			// /routes/{name}/maintenance
+			switch r.Method {
+			case http.MethodPut:
+				setMaintenance(ctx, w, r)
+			default:
+				w.WriteHeader(http.StatusOK)
+			}
+			return
+		}
+
+		if len(parts) == 3 && parts[0] == "routes" && parts[2] == "drain" {
+			// /routes/{name}/drain
+			switch r.Method {
+			case http.MethodGet:
+				getDrainStatus(ctx, w, r)
+			default:
+				w.WriteHeader(http.StatusOK)
+			}
+			return
+		}
+
+		if len(parts) == 3 && parts[0] == "routes" && parts[2] == "expiry" {
+			// /routes/{name}/expiry
+			switch r.Method {
+			case http.MethodPut:
+				extendExpiry(ctx, w, r)
 			default:
 				w.WriteHeader(http.StatusOK)
 			}
@@ -71,6 +116,21 @@ func NewRouteDelivery(
 		http.NotFound(w, r)
 	})
 
+	// Route match tester, /match?host={host}&path={path}
+	http.HandleFunc("/match", func(w http.ResponseWriter, r *http.Request) {
+		// Set headers
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+
+		switch r.Method {
+		case http.MethodGet:
+			matchRoute(ctx, w, r)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	})
+
 	return handler
 }
 
@@ -88,16 +148,19 @@ func NewTestRouteDelivery(
 }
 
 func (h *RouteDelivery) Create(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(ctx, r, "RouteDelivery.Create")
+	defer span.End()
+
 	route := &domain.RouteItem{}
 	err := httputils.ValidateAndUnmarshal(r, h.validate, route)
 	if err != nil {
-		httputils.WriteErrorResponse(w, err)
+		writeError(span, w, err)
 		return
 	}
 
 	createdRoute, err := h.usecase.Create(ctx, *route)
 	if err != nil {
-		httputils.WriteErrorResponse(w, err)
+		writeError(span, w, err)
 		return
 	}
 
@@ -105,28 +168,31 @@ func (h *RouteDelivery) Create(ctx context.Context, w http.ResponseWriter, r *ht
 }
 
 func (h *RouteDelivery) Update(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(ctx, r, "RouteDelivery.Update")
+	defer span.End()
+
 	// Expect the path param on the third index position on the URL
 	routeName := httputils.GetPathParamByPathPosition(r, 2)
 	if routeName == nil {
-		httputils.WriteErrorResponse(w, errors.New(domain.ErrBadRequest))
+		writeError(span, w, errors.New(domain.ErrBadRequest))
 		return
 	}
 
 	route := &domain.RouteItem{}
 	err := httputils.ValidateAndUnmarshal(r, h.validate, route)
 	if err != nil {
-		httputils.WriteErrorResponse(w, err)
+		writeError(span, w, err)
 		return
 	}
 
 	if *routeName != route.Name {
-		httputils.WriteErrorResponse(w, errors.New(domain.ErrBadRequest+" :Unable to change the name for the route"))
+		writeError(span, w, errors.New(domain.ErrBadRequest+" :Unable to change the name for the route"))
 		return
 	}
 
 	createdRoute, err := h.usecase.Update(ctx, *route)
 	if err != nil {
-		httputils.WriteErrorResponse(w, err)
+		writeError(span, w, err)
 		return
 	}
 
@@ -134,9 +200,12 @@ func (h *RouteDelivery) Update(ctx context.Context, w http.ResponseWriter, r *ht
 }
 
 func (h *RouteDelivery) GetAll(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(ctx, r, "RouteDelivery.GetAll")
+	defer span.End()
+
 	routes, err := h.usecase.GetAll(ctx)
 	if err != nil {
-		httputils.WriteErrorResponse(w, errors.New(domain.ErrInternalServer))
+		writeError(span, w, errors.New(domain.ErrInternalServer))
 		return
 	}
 
@@ -144,34 +213,144 @@ func (h *RouteDelivery) GetAll(ctx context.Context, w http.ResponseWriter, r *ht
 }
 
 func (h *RouteDelivery) GetOne(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(ctx, r, "RouteDelivery.GetOne")
+	defer span.End()
+
 	// Expect the path param on the third index position on the URL
 	routeName := httputils.GetPathParamByPathPosition(r, 2)
 	if routeName == nil {
-		httputils.WriteErrorResponse(w, errors.New(domain.ErrBadRequest))
+		writeError(span, w, errors.New(domain.ErrBadRequest))
 		return
 	}
 
 	route, err := h.usecase.GetOne(ctx, *routeName)
 	if err != nil {
-		httputils.WriteErrorResponse(w, err)
+		writeError(span, w, err)
 	}
 
 	httputils.WriteSuccessResponse(w, route)
 }
 
 func (h *RouteDelivery) Delete(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(ctx, r, "RouteDelivery.Delete")
+	defer span.End()
+
 	// Expect the path param on the third index position on the URL
 	routeName := httputils.GetPathParamByPathPosition(r, 2)
 	if routeName == nil {
-		httputils.WriteErrorResponse(w, errors.New(domain.ErrBadRequest))
+		writeError(span, w, errors.New(domain.ErrBadRequest))
 		return
 	}
 
 	err := h.usecase.Delete(ctx, *routeName)
 	if err != nil {
-		httputils.WriteErrorResponse(w, err)
+		writeError(span, w, err)
 		return
 	}
 
 	httputils.WriteSuccessResponse(w, nil)
 }
+
+// SetMaintenance toggle the maintenance mode of a route without sending the whole route
+func (h *RouteDelivery) SetMaintenance(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(ctx, r, "RouteDelivery.SetMaintenance")
+	defer span.End()
+
+	// Expect the path param on the third index position on the URL
+	routeName := httputils.GetPathParamByPathPosition(r, 2)
+	if routeName == nil {
+		writeError(span, w, errors.New(domain.ErrBadRequest))
+		return
+	}
+
+	maintenance := &domain.RouteMaintenance{}
+	err := httputils.ValidateAndUnmarshal(r, h.validate, maintenance)
+	if err != nil {
+		writeError(span, w, err)
+		return
+	}
+
+	updatedRoute, err := h.usecase.SetMaintenance(ctx, *routeName, *maintenance)
+	if err != nil {
+		writeError(span, w, err)
+		return
+	}
+
+	httputils.WriteSuccessResponse(w, updatedRoute)
+}
+
+// GetDrainStatus report the requests a disabled or deleted route still serve
+func (h *RouteDelivery) GetDrainStatus(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(ctx, r, "RouteDelivery.GetDrainStatus")
+	defer span.End()
+
+	// Expect the path param on the third index position on the URL
+	routeName := httputils.GetPathParamByPathPosition(r, 2)
+	if routeName == nil {
+		writeError(span, w, errors.New(domain.ErrBadRequest))
+		return
+	}
+
+	status, err := h.usecase.GetDrainStatus(ctx, *routeName)
+	if err != nil {
+		writeError(span, w, err)
+		return
+	}
+
+	httputils.WriteSuccessResponse(w, status)
+}
+
+// ExtendExpiry move the expiry of a temporary route
+func (h *RouteDelivery) ExtendExpiry(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(ctx, r, "RouteDelivery.ExtendExpiry")
+	defer span.End()
+
+	// Expect the path param on the third index position on the URL
+	routeName := httputils.GetPathParamByPathPosition(r, 2)
+	if routeName == nil {
+		writeError(span, w, errors.New(domain.ErrBadRequest))
+		return
+	}
+
+	extension := &domain.RouteExpiryExtension{}
+	err := httputils.ValidateAndUnmarshal(r, h.validate, extension)
+	if err != nil {
+		writeError(span, w, err)
+		return
+	}
+
+	updatedRoute, err := h.usecase.ExtendExpiry(ctx, *routeName, *extension)
+	if err != nil {
+		writeError(span, w, err)
+		return
+	}
+
+	httputils.WriteSuccessResponse(w, updatedRoute)
+}
+
+// MatchRoute report the route the proxy would serve a request with, the
+// path is sent as the client would, percent-encoded and with its query
+func (h *RouteDelivery) MatchRoute(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(ctx, r, "RouteDelivery.MatchRoute")
+	defer span.End()
+
+	host := r.URL.Query().Get("host")
+	path := r.URL.Query().Get("path")
+	if host == "" || !strings.HasPrefix(path, "/") {
+		writeError(span, w, errors.New(domain.ErrBadRequest+" :The host and a path starting with / are required"))
+		return
+	}
+	requestURL, err := url.ParseRequestURI(path)
+	if err != nil {
+		writeError(span, w, errors.New(domain.ErrBadRequest+" :Invalid path"))
+		return
+	}
+
+	match, err := h.usecase.MatchRoute(ctx, host, requestURL)
+	if err != nil {
+		writeError(span, w, err)
+		return
+	}
+
+	httputils.WriteSuccessResponse(w, match)
+}
@@ -0,0 +1,198 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"test/portal/domain"
+	routemetrics "test/portal/internal/route/metrics"
+	"test/portal/pkg/httputils"
+
+	"github.com/go-playground/validator/v10"
+)
+
+type StreamRouteDelivery struct {
+	usecase  domain.StreamRouteUsecase
+	validate *validator.Validate
+}
+
+func NewStreamRouteDelivery(
+	ctx context.Context,
+	validate *validator.Validate,
+	usecase domain.StreamRouteUsecase,
+	metrics *routemetrics.Metrics) *StreamRouteDelivery {
+
+	handler := &StreamRouteDelivery{
+		usecase:  usecase,
+		validate: validate,
+	}
+
+	// Handlers instrumented by operation
+	create := metrics.Instrument("CreateStream", handler.Create)
+	update := metrics.Instrument("UpdateStream", handler.Update)
+	getAll := metrics.Instrument("GetAllStreams", handler.GetAll)
+	getOne := metrics.Instrument("GetOneStream", handler.GetOne)
+	deleteRoute := metrics.Instrument("DeleteStream", handler.Delete)
+
+	http.HandleFunc("/streams/", func(w http.ResponseWriter, r *http.Request) {
+		// Set headers
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+
+		path := strings.Trim(r.URL.Path, "/")
+		parts := strings.Split(path, "/")
+
+		if len(parts) == 1 && parts[0] == "streams" {
+			// /streams
+			switch r.Method {
+			case http.MethodGet:
+				getAll(ctx, w, r)
+			case http.MethodPost:
+				create(ctx, w, r)
+			default:
+				w.WriteHeader(http.StatusOK)
+			}
+			return
+		}
+
+		if len(parts) == 2 && parts[0] == "streams" {
+			// /streams/{name}
+			switch r.Method {
+			case http.MethodGet:
+				getOne(ctx, w, r)
+			case http.MethodPut:
+				update(ctx, w, r)
+			case http.MethodDelete:
+				deleteRoute(ctx, w, r)
+			default:
+				w.WriteHeader(http.StatusOK)
+			}
+			return
+		}
+
+		// Anything else is 404
+		http.NotFound(w, r)
+	})
+
+	return handler
+}
+
+func NewTestStreamRouteDelivery(
+	ctx context.Context,
+	validate *validator.Validate,
+	usecase domain.StreamRouteUsecase) *StreamRouteDelivery {
+
+	handler := &StreamRouteDelivery{
+		usecase:  usecase,
+		validate: validate,
+	}
+
+	return handler
+}
+
+func (h *StreamRouteDelivery) Create(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(ctx, r, "StreamRouteDelivery.Create")
+	defer span.End()
+
+	route := &domain.StreamRoute{}
+	err := httputils.ValidateAndUnmarshal(r, h.validate, route)
+	if err != nil {
+		writeError(span, w, err)
+		return
+	}
+
+	createdRoute, err := h.usecase.Create(ctx, *route)
+	if err != nil {
+		writeError(span, w, err)
+		return
+	}
+
+	httputils.WriteSuccessResponse(w, createdRoute)
+}
+
+func (h *StreamRouteDelivery) Update(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(ctx, r, "StreamRouteDelivery.Update")
+	defer span.End()
+
+	// Expect the path param on the third index position on the URL
+	routeName := httputils.GetPathParamByPathPosition(r, 2)
+	if routeName == nil {
+		writeError(span, w, errors.New(domain.ErrBadRequest))
+		return
+	}
+
+	route := &domain.StreamRoute{}
+	err := httputils.ValidateAndUnmarshal(r, h.validate, route)
+	if err != nil {
+		writeError(span, w, err)
+		return
+	}
+
+	if *routeName != route.Name {
+		writeError(span, w, errors.New(domain.ErrBadRequest+" :Unable to change the name for the stream route"))
+		return
+	}
+
+	updatedRoute, err := h.usecase.Update(ctx, *route)
+	if err != nil {
+		writeError(span, w, err)
+		return
+	}
+
+	httputils.WriteSuccessResponse(w, updatedRoute)
+}
+
+func (h *StreamRouteDelivery) GetAll(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(ctx, r, "StreamRouteDelivery.GetAll")
+	defer span.End()
+
+	routes, err := h.usecase.GetAll(ctx)
+	if err != nil {
+		writeError(span, w, errors.New(domain.ErrInternalServer))
+		return
+	}
+
+	httputils.WriteSuccessResponse(w, routes)
+}
+
+func (h *StreamRouteDelivery) GetOne(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(ctx, r, "StreamRouteDelivery.GetOne")
+	defer span.End()
+
+	// Expect the path param on the third index position on the URL
+	routeName := httputils.GetPathParamByPathPosition(r, 2)
+	if routeName == nil {
+		writeError(span, w, errors.New(domain.ErrBadRequest))
+		return
+	}
+
+	route, err := h.usecase.GetOne(ctx, *routeName)
+	if err != nil {
+		writeError(span, w, err)
+		return
+	}
+
+	httputils.WriteSuccessResponse(w, route)
+}
+
+func (h *StreamRouteDelivery) Delete(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(ctx, r, "StreamRouteDelivery.Delete")
+	defer span.End()
+
+	// Expect the path param on the third index position on the URL
+	routeName := httputils.GetPathParamByPathPosition(r, 2)
+	if routeName == nil {
+		writeError(span, w, errors.New(domain.ErrBadRequest))
+		return
+	}
+
+	err := h.usecase.Delete(ctx, *routeName)
+	if err != nil {
+		writeError(span, w, err)
+		return
+	}
+
+	httputils.WriteSuccessResponse(w, nil)
+}
@@ -0,0 +1,28 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"test/portal/pkg/httputils"
+	"test/portal/pkg/traceutils"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Span of a handler, continuing the trace of the caller when it sent one.
+// The request ID is carried over so the logs of the handler include it
+func startSpan(ctx context.Context, r *http.Request, name string) (context.Context, trace.Span) {
+	if requestID := httputils.RequestIDFrom(r.Context()); requestID != "" {
+		ctx = httputils.WithRequestID(ctx, requestID)
+	}
+	return traceutils.Start(traceutils.Extract(ctx, r.Header), name,
+		trace.WithSpanKind(trace.SpanKindServer))
+}
+
+// Write the error response and mark the handler span failed
+func writeError(span trace.Span, w http.ResponseWriter, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+	httputils.WriteErrorResponse(w, err)
+}
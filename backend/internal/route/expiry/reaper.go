@@ -0,0 +1,39 @@
+package expiry
+
+import (
+	"context"
+	"log/slog"
+	"test/portal/domain"
+	"time"
+)
+
+// Reaper disable or delete the expired routes in the background, following
+// the expiry policy of each route
+type Reaper struct {
+	usecase domain.RouteItemUsecase
+}
+
+func NewReaper(usecase domain.RouteItemUsecase) *Reaper {
+	return &Reaper{usecase: usecase}
+}
+
+// Run reap the expired routes every interval until the context is done
+func (r *Reaper) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := r.Tick(ctx); err != nil {
+			slog.Error("Failed reap expired routes", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Tick reap the routes expired by now, it return their names
+func (r *Reaper) Tick(ctx context.Context) ([]string, error) {
+	return r.usecase.ReapExpired(ctx)
+}
@@ -0,0 +1,190 @@
+package match
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+	"test/portal/domain"
+	"test/portal/internal/route/schedule"
+	"test/portal/pkg/pathutils"
+	"time"
+)
+
+/*
+Index of the routes by host then path, built once from the stored routes and
+never modified after so it's read without lock. The routes of a host are kept
+in one radix tree per path normalization: edges are runs of literal segments
+(lower case, case-sensitive routes are compared again on match) or a single
+parameter, and the routes hang on the node their path end at. A lookup walk
+the request segments and only compare the routes met on the way.
+*/
+type Index struct {
+	routes    []domain.RouteItem
+	templates []*pathutils.Template
+	hosts     map[string]map[normalization]*node
+}
+
+type node struct {
+	// Literal segments from the parent, empty for the root and parameters
+	prefix   []string
+	children map[string]*node
+	param    *node
+	// Routes whose path end at the node, by position in the index
+	routes []int
+}
+
+// NewIndex index the routes, the ones with an invalid path are left out.
+// The paths are parsed once and kept with the index, dropped along with it
+func NewIndex(routes []domain.RouteItem) *Index {
+	index := &Index{
+		routes:    routes,
+		templates: make([]*pathutils.Template, len(routes)),
+		hosts:     make(map[string]map[normalization]*node),
+	}
+	for i := range routes {
+		template := pathTemplate(routes[i].Path)
+		if template == nil {
+			continue
+		}
+		index.templates[i] = template
+
+		options := domain.RoutePathMatching{}
+		if routes[i].PathMatching != nil {
+			options = *routes[i].PathMatching
+		}
+		host := strings.ToLower(routes[i].Host)
+		trees := index.hosts[host]
+		if trees == nil {
+			trees = make(map[normalization]*node, 1)
+			index.hosts[host] = trees
+		}
+		root := trees[keyOf(options)]
+		if root == nil {
+			root = &node{}
+			trees[keyOf(options)] = root
+		}
+		root.insert(template.Segments(), i)
+	}
+	return index
+}
+
+/*
+Match find the route serving the host and request URL like Route does, the
+route states are computed at now. The returned route is shared by the index
+and must not be modified.
+*/
+func (index *Index) Match(host string, requestURL *url.URL, now time.Time) *domain.RouteMatch {
+	trees := index.hosts[normalizeHost(host)]
+	if trees == nil {
+		return nil
+	}
+	m := newMatcher(requestURL)
+	var candidates []int
+	for key, root := range trees {
+		path := m.path(key)
+		if !path.valid {
+			continue
+		}
+		candidates = root.collect(lowerSegments(path.path), candidates)
+	}
+
+	// In the order of the routes so ties end like with Route
+	slices.Sort(candidates)
+	for _, i := range candidates {
+		route := &index.routes[i]
+		if schedule.EffectiveState(*route, now) != domain.RouteStateActive {
+			continue
+		}
+		m.consider(route, index.templates[i])
+	}
+	return m.matched
+}
+
+func (n *node) insert(segments []pathutils.Segment, route int) {
+	if len(segments) == 0 {
+		n.routes = append(n.routes, route)
+		return
+	}
+	if segments[0].Param != "" {
+		if n.param == nil {
+			n.param = &node{}
+		}
+		n.param.insert(segments[1:], route)
+		return
+	}
+
+	run := make([]string, 0, len(segments))
+	for _, segment := range segments {
+		if segment.Param != "" {
+			break
+		}
+		run = append(run, asciiLower(segment.Literal))
+	}
+	child := n.children[run[0]]
+	if child == nil {
+		if n.children == nil {
+			n.children = make(map[string]*node, 1)
+		}
+		child = &node{prefix: run}
+		n.children[run[0]] = child
+		child.insert(segments[len(run):], route)
+		return
+	}
+
+	common := 1
+	for common < len(run) && common < len(child.prefix) && run[common] == child.prefix[common] {
+		common++
+	}
+	// Split the edge where the paths part
+	if common < len(child.prefix) {
+		tail := &node{prefix: child.prefix[common:], children: child.children, param: child.param, routes: child.routes}
+		child.prefix = child.prefix[:common:common]
+		child.children = map[string]*node{tail.prefix[0]: tail}
+		child.param, child.routes = nil, nil
+	}
+	child.insert(segments[common:], route)
+}
+
+// Append the routes of the nodes on the way of the segments, a route path
+// match on segment boundary so every node passed may serve the request
+func (n *node) collect(segments []string, routes []int) []int {
+	routes = append(routes, n.routes...)
+	if len(segments) == 0 {
+		return routes
+	}
+	if child := n.children[segments[0]]; child != nil && len(segments) >= len(child.prefix) && slices.Equal(segments[:len(child.prefix)], child.prefix) {
+		routes = child.collect(segments[len(child.prefix):], routes)
+	}
+	if n.param != nil && segments[0] != "" {
+		routes = n.param.collect(segments[1:], routes)
+	}
+	return routes
+}
+
+// Segments of the request path in ASCII lower case, none when the path
+// doesn't start with / and only the root path may match
+func lowerSegments(path string) []string {
+	if !strings.HasPrefix(path, "/") {
+		return nil
+	}
+	segments := strings.Split(path[1:], "/")
+	for i, segment := range segments {
+		segments[i] = asciiLower(segment)
+	}
+	return segments
+}
+
+func asciiLower(s string) string {
+	for i := 0; i < len(s); i++ {
+		if 'A' <= s[i] && s[i] <= 'Z' {
+			lowered := []byte(s)
+			for j := i; j < len(lowered); j++ {
+				if 'A' <= lowered[j] && lowered[j] <= 'Z' {
+					lowered[j] += 'a' - 'A'
+				}
+			}
+			return string(lowered)
+		}
+	}
+	return s
+}
@@ -0,0 +1,162 @@
+package match
+
+import (
+	"net"
+	"net/url"
+	"strings"
+	"test/portal/domain"
+	"test/portal/pkg/pathutils"
+)
+
+// Request path normalized for a route, shared by the routes normalizing the
+// same way
+type normalization struct {
+	mergeSlashes  bool
+	decodePercent bool
+}
+
+type normalizedPath struct {
+	// Compared to the route path, percent-decoded as far as the route decode
+	path string
+	// Forwarded to the backend
+	escaped string
+	valid   bool
+}
+
+/*
+Route find the enabled route serving the host and request URL, routes
+outside of their schedule or expired are skipped. Each route normalize the
+request path with its own path matching options before comparing it.
+When several routes share the host the most specific path wins: the
+longest, then literal segments over parameters. Route scan all the routes,
+an Index find the same route without scanning.
+*/
+func Route(routes []domain.RouteItem, host string, requestURL *url.URL) *domain.RouteMatch {
+	host = normalizeHost(host)
+	m := newMatcher(requestURL)
+	for i := range routes {
+		route := &routes[i]
+		if route.Enabled == nil || !*route.Enabled || (route.EffectiveState != "" && route.EffectiveState != domain.RouteStateActive) {
+			continue
+		}
+		if !strings.EqualFold(route.Host, host) {
+			continue
+		}
+		if template := pathTemplate(route.Path); template != nil {
+			m.consider(route, template)
+		}
+	}
+	return m.matched
+}
+
+// Most specific of the routes considered for a request
+type matcher struct {
+	requestURL *url.URL
+	paths      map[normalization]normalizedPath
+
+	matched         *domain.RouteMatch
+	matchedTemplate *pathutils.Template
+}
+
+func newMatcher(requestURL *url.URL) *matcher {
+	return &matcher{requestURL: requestURL, paths: make(map[normalization]normalizedPath, 1)}
+}
+
+// Request path normalized the way of the key
+func (m *matcher) path(key normalization) normalizedPath {
+	path, found := m.paths[key]
+	if !found {
+		path = normalize(m.requestURL, key)
+		m.paths[key] = path
+	}
+	return path
+}
+
+// Consider an active route of the host, it replace the matched route when
+// more specific. On a tie the route considered first is kept
+func (m *matcher) consider(route *domain.RouteItem, template *pathutils.Template) {
+	options := domain.RoutePathMatching{}
+	if route.PathMatching != nil {
+		options = *route.PathMatching
+	}
+	path := m.path(keyOf(options))
+	if !path.valid {
+		return
+	}
+
+	params, rest, ok := template.Match(path.path, options.CaseInsensitive)
+	if !ok {
+		return
+	}
+	redirect := ""
+	if template.SlashMismatch(rest) {
+		switch options.TrailingSlash {
+		case domain.TrailingSlashStrict:
+			return
+		case domain.TrailingSlashRedirect:
+			redirect = redirectLocation(path.escaped, template.TrailingSlash(), m.requestURL.RawQuery)
+		}
+	}
+
+	if m.matched == nil || template.Compare(m.matchedTemplate) > 0 {
+		m.matched = &domain.RouteMatch{Route: route, Params: params, Path: path.escaped, Redirect: redirect, Rest: rest}
+		m.matchedTemplate = template
+	}
+}
+
+func keyOf(options domain.RoutePathMatching) normalization {
+	return normalization{mergeSlashes: options.MergeSlashes, decodePercent: options.DecodePercent}
+}
+
+func normalize(requestURL *url.URL, key normalization) normalizedPath {
+	normalized := normalizedPath{path: requestURL.Path, escaped: requestURL.EscapedPath(), valid: true}
+	if key.decodePercent {
+		path, err := pathutils.SafeDecode(normalized.escaped)
+		if err != nil {
+			return normalizedPath{}
+		}
+		normalized.path, normalized.escaped = path, pathutils.EscapePath(path)
+	}
+	// Only the slashes of the escaped path are merged, not the encoded ones
+	if key.mergeSlashes {
+		normalized.escaped = pathutils.MergeSlashes(normalized.escaped)
+		if key.decodePercent {
+			normalized.path = pathutils.MergeSlashes(normalized.path)
+		} else if path, err := url.PathUnescape(normalized.escaped); err == nil {
+			normalized.path = path
+		} else {
+			return normalizedPath{}
+		}
+	}
+	return normalized
+}
+
+// Path in the form of the route path, never starting with // or /\ which
+// browsers would take for another host
+func redirectLocation(escaped string, trailingSlash bool, rawQuery string) string {
+	location := strings.TrimSuffix(escaped, "/")
+	if trailingSlash {
+		location += "/"
+	}
+	location = "/" + strings.TrimLeft(location, "/\\")
+	if rawQuery != "" {
+		location += "?" + rawQuery
+	}
+	return location
+}
+
+// Template of the route path, nil when the stored path is invalid
+func pathTemplate(path string) *pathutils.Template {
+	template, err := pathutils.Parse(path)
+	if err != nil {
+		return nil
+	}
+	return template
+}
+
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"test/portal/pkg/httputils"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics of the management API handlers and of the route repository,
+// labelled by operation name (Create, Update, GetAll, GetOne, Delete, ...)
+type Metrics struct {
+	apiRequests    *prometheus.CounterVec
+	apiDuration    *prometheus.HistogramVec
+	apiErrors      *prometheus.CounterVec
+	repoOperations *prometheus.CounterVec
+	repoDuration   *prometheus.HistogramVec
+	repoErrors     *prometheus.CounterVec
+	fileDuration   *prometheus.HistogramVec
+	fileSize       *prometheus.HistogramVec
+}
+
+func New(registerer prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		apiRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "portal_api_requests_total",
+			Help: "Requests handled by the management API.",
+		}, []string{"operation", "status_class"}),
+		apiDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "portal_api_request_duration_seconds",
+			Help:    "Time to handle a management API request.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"operation"}),
+		apiErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "portal_api_errors_total",
+			Help: "Management API requests answered with an error status.",
+		}, []string{"operation"}),
+		repoOperations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "portal_repository_operations_total",
+			Help: "Operations run on the route repository.",
+		}, []string{"operation"}),
+		repoDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "portal_repository_operation_duration_seconds",
+			Help:    "Time to run a route repository operation.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"operation"}),
+		repoErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "portal_repository_errors_total",
+			Help: "Route repository operations that returned an error.",
+		}, []string{"operation"}),
+		fileDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "portal_repository_file_duration_seconds",
+			Help:    "Time to read or write the routes file.",
+			Buckets: prometheus.ExponentialBuckets(0.0001, 4, 8),
+		}, []string{"io"}),
+		fileSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "portal_repository_file_size_bytes",
+			Help:    "Size of the routes file read or written.",
+			Buckets: prometheus.ExponentialBuckets(1024, 4, 8),
+		}, []string{"io"}),
+	}
+	registerer.MustRegister(m.apiRequests, m.apiDuration, m.apiErrors,
+		m.repoOperations, m.repoDuration, m.repoErrors, m.fileDuration, m.fileSize)
+	return m
+}
+
+// Instrument wrap a delivery handler, responses with a 4xx or 5xx status
+// count as errors
+func (m *Metrics) Instrument(operation string, handler func(ctx context.Context, w http.ResponseWriter, r *http.Request)) func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := httputils.NewRecorder(w)
+		handler(ctx, recorder, r)
+
+		status := recorder.StatusCode()
+		m.apiRequests.WithLabelValues(operation, strconv.Itoa(status/100)+"xx").Inc()
+		m.apiDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+		if status >= http.StatusBadRequest {
+			m.apiErrors.WithLabelValues(operation).Inc()
+		}
+	}
+}
+
+// ObserveOperation record a repository operation started at start
+func (m *Metrics) ObserveOperation(operation string, start time.Time, err error) {
+	m.repoOperations.WithLabelValues(operation).Inc()
+	m.repoDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		m.repoErrors.WithLabelValues(operation).Inc()
+	}
+}
+
+// ObserveFile record a read or write of the storage file, io is "read" or "write"
+func (m *Metrics) ObserveFile(io string, start time.Time, size int) {
+	m.fileDuration.WithLabelValues(io).Observe(time.Since(start).Seconds())
+	m.fileSize.WithLabelValues(io).Observe(float64(size))
+}
@@ -3,43 +3,64 @@ package yaml
 import (
 	"context"
 	"errors"
-	"log"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
 	"test/portal/domain"
+	routemetrics "test/portal/internal/route/metrics"
 	"test/portal/pkg/sliceutils"
+	"test/portal/pkg/traceutils"
 	"test/portal/pkg/yamlutils"
+	"time"
 )
 
+// Writes by file path, the modification time alone miss the writes within
+// the timestamp granularity of the file system
+var generations sync.Map
+
 type routeYamlRepository struct {
 	yamlPath string
+	// Optional, nil when the repository isn't instrumented
+	metrics *routemetrics.Metrics
 }
 
 // Create implements domain.RouteItemRepository.
-func (r *routeYamlRepository) Create(ctx context.Context, route domain.RouteItem) (*domain.RouteItem, error) {
+func (r *routeYamlRepository) Create(ctx context.Context, route domain.RouteItem) (_ *domain.RouteItem, err error) {
+	_, span := traceutils.Start(ctx, "routeYamlRepository.Create")
+	defer traceutils.End(span, &err)
+	defer r.observe("Create", time.Now(), &err)
+
 	existRoutes := make([]domain.RouteItem, 0)
-	err := yamlutils.LoadYamlData(r.yamlPath, &existRoutes)
+	err = r.load(&existRoutes)
 	if err != nil {
 		return nil, err
 	}
 	existRoutes = append(existRoutes, route)
-	err = yamlutils.SaveYamlData(r.yamlPath, existRoutes)
+	err = r.save(existRoutes)
 	if err != nil {
-		log.Println(err)
+		slog.ErrorContext(ctx, "Failed save routes", "route", route.Name, "error", err)
 		return nil, err
 	}
 	return &route, nil
 }
 
 // Delete implements domain.RouteItemRepository.
-func (r *routeYamlRepository) Delete(ctx context.Context, name string) error {
+func (r *routeYamlRepository) Delete(ctx context.Context, name string) (err error) {
+	_, span := traceutils.Start(ctx, "routeYamlRepository.Delete")
+	defer traceutils.End(span, &err)
+	defer r.observe("Delete", time.Now(), &err)
+
 	existRoutes := make([]domain.RouteItem, 0)
-	err := yamlutils.LoadYamlData(r.yamlPath, &existRoutes)
+	err = r.load(&existRoutes)
 	if err != nil {
 		return err
 	}
 
 	existRoutes = sliceutils.Filter(existRoutes, func(ri domain.RouteItem) bool { return ri.Name != name })
 
-	err = yamlutils.SaveYamlData(r.yamlPath, existRoutes)
+	err = r.save(existRoutes)
 	if err != nil {
 		return err
 	}
@@ -47,9 +68,13 @@ func (r *routeYamlRepository) Delete(ctx context.Context, name string) error {
 }
 
 // GetAll implements domain.RouteItemRepository.
-func (r *routeYamlRepository) GetAll(ctx context.Context) ([]domain.RouteItem, error) {
+func (r *routeYamlRepository) GetAll(ctx context.Context) (_ []domain.RouteItem, err error) {
+	_, span := traceutils.Start(ctx, "routeYamlRepository.GetAll")
+	defer traceutils.End(span, &err)
+	defer r.observe("GetAll", time.Now(), &err)
+
 	existRoutes := make([]domain.RouteItem, 0)
-	err := yamlutils.LoadYamlData(r.yamlPath, &existRoutes)
+	err = r.load(&existRoutes)
 	if err != nil {
 		return nil, err
 	}
@@ -57,9 +82,13 @@ func (r *routeYamlRepository) GetAll(ctx context.Context) ([]domain.RouteItem, e
 }
 
 // GetOne implements domain.RouteItemRepository.
-func (r *routeYamlRepository) GetOne(ctx context.Context, name string) (*domain.RouteItem, error) {
+func (r *routeYamlRepository) GetOne(ctx context.Context, name string) (_ *domain.RouteItem, err error) {
+	_, span := traceutils.Start(ctx, "routeYamlRepository.GetOne")
+	defer traceutils.End(span, &err)
+	defer r.observe("GetOne", time.Now(), &err)
+
 	existRoutes := make([]domain.RouteItem, 0)
-	err := yamlutils.LoadYamlData(r.yamlPath, &existRoutes)
+	err = r.load(&existRoutes)
 	if err != nil {
 		return nil, err
 	}
@@ -73,24 +102,80 @@ func (r *routeYamlRepository) GetOne(ctx context.Context, name string) (*domain.
 }
 
 // Update implements domain.RouteItemRepository.
-func (r *routeYamlRepository) Update(ctx context.Context, route domain.RouteItem) (*domain.RouteItem, error) {
+func (r *routeYamlRepository) Update(ctx context.Context, route domain.RouteItem) (_ *domain.RouteItem, err error) {
+	_, span := traceutils.Start(ctx, "routeYamlRepository.Update")
+	defer traceutils.End(span, &err)
+	defer r.observe("Update", time.Now(), &err)
+
 	existRoutes := make([]domain.RouteItem, 0)
-	err := yamlutils.LoadYamlData(r.yamlPath, &existRoutes)
+	err = r.load(&existRoutes)
 	if err != nil {
 		return nil, err
 	}
 	existRoutes = sliceutils.Filter(existRoutes, func(ri domain.RouteItem) bool { return ri.Name != route.Name })
 	existRoutes = append(existRoutes, route)
 
-	err = yamlutils.SaveYamlData(r.yamlPath, existRoutes)
+	err = r.save(existRoutes)
 	if err != nil {
 		return nil, err
 	}
 	return &route, nil
 }
 
+// Version implements domain.RouteItemRepository. It's checked on every
+// proxied request so it's neither traced nor observed
+func (r *routeYamlRepository) Version(ctx context.Context) (string, error) {
+	generation := r.generation().Load()
+	info, err := os.Stat(r.yamlPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Sprintf("%d", generation), nil
+		}
+		return "", err
+	}
+	return fmt.Sprintf("%d-%d-%d", generation, info.ModTime().UnixNano(), info.Size()), nil
+}
+
+func (r *routeYamlRepository) generation() *atomic.Int64 {
+	generation, _ := generations.LoadOrStore(r.yamlPath, new(atomic.Int64))
+	return generation.(*atomic.Int64)
+}
+
+func (r *routeYamlRepository) load(routes *[]domain.RouteItem) error {
+	start := time.Now()
+	size, err := yamlutils.LoadYamlData(r.yamlPath, routes)
+	if r.metrics != nil && err == nil {
+		r.metrics.ObserveFile("read", start, size)
+	}
+	return err
+}
+
+func (r *routeYamlRepository) save(routes []domain.RouteItem) error {
+	start := time.Now()
+	size, err := yamlutils.SaveYamlData(r.yamlPath, routes)
+	r.generation().Add(1)
+	if r.metrics != nil && err == nil {
+		r.metrics.ObserveFile("write", start, size)
+	}
+	return err
+}
+
+func (r *routeYamlRepository) observe(operation string, start time.Time, err *error) {
+	if r.metrics != nil {
+		r.metrics.ObserveOperation(operation, start, *err)
+	}
+}
+
 func NewRouteYamlRepository() domain.RouteItemRepository {
 	return &routeYamlRepository{
 		yamlPath: "./.data/routes.yaml",
 	}
 }
+
+// NewInstrumentedRouteYamlRepository record the operations and file accesses in the metrics
+func NewInstrumentedRouteYamlRepository(metrics *routemetrics.Metrics) domain.RouteItemRepository {
+	return &routeYamlRepository{
+		yamlPath: "./.data/routes.yaml",
+		metrics:  metrics,
+	}
+}
@@ -0,0 +1,131 @@
+package yaml
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"test/portal/domain"
+	routemetrics "test/portal/internal/route/metrics"
+	"test/portal/pkg/sliceutils"
+	"test/portal/pkg/traceutils"
+	"test/portal/pkg/yamlutils"
+	"time"
+)
+
+// Stream routes are kept in their own file next to the routes
+type streamRouteYamlRepository struct {
+	yamlPath string
+	// Optional, nil when the repository isn't instrumented
+	metrics *routemetrics.Metrics
+}
+
+// Create implements domain.StreamRouteRepository.
+func (r *streamRouteYamlRepository) Create(ctx context.Context, route domain.StreamRoute) (_ *domain.StreamRoute, err error) {
+	_, span := traceutils.Start(ctx, "streamRouteYamlRepository.Create")
+	defer traceutils.End(span, &err)
+	defer r.observe("CreateStream", time.Now(), &err)
+
+	existRoutes := make([]domain.StreamRoute, 0)
+	_, err = yamlutils.LoadYamlData(r.yamlPath, &existRoutes)
+	if err != nil {
+		return nil, err
+	}
+	existRoutes = append(existRoutes, route)
+	_, err = yamlutils.SaveYamlData(r.yamlPath, existRoutes)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed save stream routes", "stream", route.Name, "error", err)
+		return nil, err
+	}
+	return &route, nil
+}
+
+// Delete implements domain.StreamRouteRepository.
+func (r *streamRouteYamlRepository) Delete(ctx context.Context, name string) (err error) {
+	_, span := traceutils.Start(ctx, "streamRouteYamlRepository.Delete")
+	defer traceutils.End(span, &err)
+	defer r.observe("DeleteStream", time.Now(), &err)
+
+	existRoutes := make([]domain.StreamRoute, 0)
+	_, err = yamlutils.LoadYamlData(r.yamlPath, &existRoutes)
+	if err != nil {
+		return err
+	}
+	existRoutes = sliceutils.Filter(existRoutes, func(sr domain.StreamRoute) bool { return sr.Name != name })
+	_, err = yamlutils.SaveYamlData(r.yamlPath, existRoutes)
+	return err
+}
+
+// GetAll implements domain.StreamRouteRepository.
+func (r *streamRouteYamlRepository) GetAll(ctx context.Context) (_ []domain.StreamRoute, err error) {
+	_, span := traceutils.Start(ctx, "streamRouteYamlRepository.GetAll")
+	defer traceutils.End(span, &err)
+	defer r.observe("GetAllStreams", time.Now(), &err)
+
+	existRoutes := make([]domain.StreamRoute, 0)
+	_, err = yamlutils.LoadYamlData(r.yamlPath, &existRoutes)
+	if err != nil {
+		return nil, err
+	}
+	return existRoutes, nil
+}
+
+// GetOne implements domain.StreamRouteRepository.
+func (r *streamRouteYamlRepository) GetOne(ctx context.Context, name string) (_ *domain.StreamRoute, err error) {
+	_, span := traceutils.Start(ctx, "streamRouteYamlRepository.GetOne")
+	defer traceutils.End(span, &err)
+	defer r.observe("GetOneStream", time.Now(), &err)
+
+	existRoutes := make([]domain.StreamRoute, 0)
+	_, err = yamlutils.LoadYamlData(r.yamlPath, &existRoutes)
+	if err != nil {
+		return nil, err
+	}
+	existRoutes = sliceutils.Filter(existRoutes, func(sr domain.StreamRoute) bool { return sr.Name == name })
+	if len(existRoutes) == 0 {
+		return nil, errors.New(domain.ErrNotFound)
+	}
+
+	route := existRoutes[0]
+	return &route, nil
+}
+
+// Update implements domain.StreamRouteRepository.
+func (r *streamRouteYamlRepository) Update(ctx context.Context, route domain.StreamRoute) (_ *domain.StreamRoute, err error) {
+	_, span := traceutils.Start(ctx, "streamRouteYamlRepository.Update")
+	defer traceutils.End(span, &err)
+	defer r.observe("UpdateStream", time.Now(), &err)
+
+	existRoutes := make([]domain.StreamRoute, 0)
+	_, err = yamlutils.LoadYamlData(r.yamlPath, &existRoutes)
+	if err != nil {
+		return nil, err
+	}
+	existRoutes = sliceutils.Filter(existRoutes, func(sr domain.StreamRoute) bool { return sr.Name != route.Name })
+	existRoutes = append(existRoutes, route)
+
+	_, err = yamlutils.SaveYamlData(r.yamlPath, existRoutes)
+	if err != nil {
+		return nil, err
+	}
+	return &route, nil
+}
+
+func (r *streamRouteYamlRepository) observe(operation string, start time.Time, err *error) {
+	if r.metrics != nil {
+		r.metrics.ObserveOperation(operation, start, *err)
+	}
+}
+
+func NewStreamRouteYamlRepository() domain.StreamRouteRepository {
+	return &streamRouteYamlRepository{
+		yamlPath: "./.data/streams.yaml",
+	}
+}
+
+// NewInstrumentedStreamRouteYamlRepository record the operations in the metrics
+func NewInstrumentedStreamRouteYamlRepository(metrics *routemetrics.Metrics) domain.StreamRouteRepository {
+	return &streamRouteYamlRepository{
+		yamlPath: "./.data/streams.yaml",
+		metrics:  metrics,
+	}
+}
@@ -0,0 +1,179 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"test/portal/domain"
+	"time"
+)
+
+var dayNames = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+
+// Loaded time zones, time.LoadLocation read the zone database on each call
+var locations sync.Map
+
+// Validate check the fields the struct validator can't
+func Validate(schedule *domain.RouteSchedule) error {
+	if schedule.ActiveFrom != nil && schedule.ActiveUntil != nil && !schedule.ActiveUntil.After(*schedule.ActiveFrom) {
+		return errors.New("activeUntil must be after activeFrom")
+	}
+	if _, err := location(schedule.TimeZone); err != nil {
+		return err
+	}
+	for _, window := range schedule.Windows {
+		if _, err := parseWindow(window); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsActive tell whether the schedule allow the route at now, an invalid
+// schedule is never active
+func IsActive(schedule *domain.RouteSchedule, now time.Time) bool {
+	if schedule == nil {
+		return true
+	}
+	if schedule.ActiveFrom != nil && now.Before(*schedule.ActiveFrom) {
+		return false
+	}
+	if schedule.ActiveUntil != nil && !now.Before(*schedule.ActiveUntil) {
+		return false
+	}
+	if len(schedule.Windows) == 0 {
+		return true
+	}
+
+	loc, err := location(schedule.TimeZone)
+	if err != nil {
+		return false
+	}
+	now = now.In(loc)
+	for _, window := range schedule.Windows {
+		parsed, err := parseWindow(window)
+		if err == nil && parsed.contains(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// EffectiveState of the route at now
+func EffectiveState(route domain.RouteItem, now time.Time) string {
+	if route.Enabled == nil || !*route.Enabled {
+		return domain.RouteStateDisabled
+	}
+	if route.ExpiresAt != nil && !now.Before(*route.ExpiresAt) {
+		return domain.RouteStateExpired
+	}
+	if !IsActive(route.Schedule, now) {
+		return domain.RouteStateInactive
+	}
+	return domain.RouteStateActive
+}
+
+type window struct {
+	days [7]bool
+	// Minutes since midnight
+	start int
+	end   int
+}
+
+/*
+Same day window when end > start, otherwise it close the next day:
+22:00-06:00 on fri cover friday night until saturday 06:00, 09:00-09:00
+last 24 hours.
+*/
+func (w window) contains(now time.Time) bool {
+	minute := now.Hour()*60 + now.Minute()
+	today := int(now.Weekday())
+	if w.end > w.start {
+		return w.days[today] && minute >= w.start && minute < w.end
+	}
+	yesterday := (today + 6) % 7
+	return (w.days[today] && minute >= w.start) || (w.days[yesterday] && minute < w.end)
+}
+
+func parseWindow(scheduleWindow domain.RouteScheduleWindow) (window, error) {
+	var parsed window
+	var err error
+	if parsed.days, err = parseDays(scheduleWindow.Days); err != nil {
+		return parsed, err
+	}
+	if parsed.start, err = parseClock(scheduleWindow.Start); err != nil {
+		return parsed, err
+	}
+	if parsed.end, err = parseClock(scheduleWindow.End); err != nil {
+		return parsed, err
+	}
+	if parsed.start == 24*60 {
+		return parsed, fmt.Errorf("invalid window start %q", scheduleWindow.Start)
+	}
+	return parsed, nil
+}
+
+// Cron day of week field, lists of days or ranges
+func parseDays(field string) ([7]bool, error) {
+	var days [7]bool
+	for _, item := range strings.Split(strings.ToLower(strings.TrimSpace(field)), ",") {
+		if item == "*" {
+			return [7]bool{true, true, true, true, true, true, true}, nil
+		}
+		from, to, isRange := strings.Cut(item, "-")
+		first, err := parseDay(from)
+		if err != nil {
+			return days, fmt.Errorf("invalid days %q", field)
+		}
+		last := first
+		if isRange {
+			if last, err = parseDay(to); err != nil || last < first {
+				return days, fmt.Errorf("invalid days %q", field)
+			}
+		}
+		for day := first; day <= last; day++ {
+			days[day%7] = true
+		}
+	}
+	return days, nil
+}
+
+func parseDay(value string) (int, error) {
+	if day, found := dayNames[strings.TrimSpace(value)]; found {
+		return day, nil
+	}
+	day, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || day < 0 || day > 7 {
+		return 0, errors.New("invalid day")
+	}
+	return day, nil
+}
+
+// HH:MM in minutes, 24:00 is accepted as the end of the day
+func parseClock(value string) (int, error) {
+	clock, err := time.Parse("15:04", value)
+	if err != nil {
+		if value == "24:00" {
+			return 24 * 60, nil
+		}
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return clock.Hour()*60 + clock.Minute(), nil
+}
+
+func location(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	if loc, found := locations.Load(name); found {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q", name)
+	}
+	locations.Store(name, loc)
+	return loc, nil
+}
@@ -0,0 +1,79 @@
+package schedule
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"test/portal/domain"
+	"time"
+)
+
+/*
+Scheduler follow the effective state of the routes, the usecase compute it
+with its clock on each read. The routes leaving their schedule or expiring
+are drained like a disabled route and the drain is cancelled when they
+become active again.
+*/
+type Scheduler struct {
+	usecase domain.RouteItemUsecase
+	// Optional, nil when the proxy doesn't drain the routes
+	drainer domain.RouteDrainer
+
+	mu     sync.Mutex
+	states map[string]string
+}
+
+func NewScheduler(usecase domain.RouteItemUsecase, drainer domain.RouteDrainer) *Scheduler {
+	return &Scheduler{
+		usecase: usecase,
+		drainer: drainer,
+		states:  make(map[string]string),
+	}
+}
+
+// Run check the routes every interval until the context is done
+func (s *Scheduler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.Tick(ctx); err != nil {
+			slog.Error("Failed check route schedules", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Tick apply the state changes since the previous tick
+func (s *Scheduler) Tick(ctx context.Context) error {
+	routes, err := s.usecase.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	states := make(map[string]string, len(routes))
+	for _, route := range routes {
+		states[route.Name] = route.EffectiveState
+		previous, known := s.states[route.Name]
+		if !known || previous == route.EffectiveState {
+			continue
+		}
+		slog.Info("Route effective state changed", "route", route.Name, "from", previous, "to", route.EffectiveState)
+		if s.drainer == nil {
+			continue
+		}
+		switch {
+		case previous == domain.RouteStateActive:
+			s.drainer.Drain(route.Name)
+		case route.EffectiveState == domain.RouteStateActive:
+			s.drainer.CancelDrain(route.Name)
+		}
+	}
+	s.states = states
+	return nil
+}
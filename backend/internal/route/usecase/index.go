@@ -0,0 +1,60 @@
+package usecase
+
+import (
+	"context"
+	"log/slog"
+	"test/portal/internal/route/match"
+	"time"
+)
+
+// Index of the stored routes at a repository version
+type routeIndex struct {
+	version    string
+	generation uint64
+	names      []string
+	index      *match.Index
+}
+
+/*
+Index of the routes matching the requests. Requests load the current index
+without lock while the repository version is unchanged. Once it changed they
+wait for the rebuild, the first one rebuild and swap the index, so a route
+just disabled or deleted never match a new request.
+*/
+func (u *routeUsecase) routeIndex(ctx context.Context) (*routeIndex, error) {
+	version, err := u.repo.Version(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if current := u.index.Load(); current != nil && current.version == version {
+		return current, nil
+	}
+
+	u.indexLock.Lock()
+	defer u.indexLock.Unlock()
+
+	// Rebuilt meanwhile, or by the request holding the lock before
+	version, err = u.repo.Version(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if current := u.index.Load(); current != nil && current.version == version {
+		return current, nil
+	}
+	// Read after the version, a write in between only cause another rebuild
+	routes, err := u.repo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	current := &routeIndex{version: version, generation: 1, names: make([]string, len(routes)), index: match.NewIndex(routes)}
+	if previous := u.index.Load(); previous != nil {
+		current.generation = previous.generation + 1
+	}
+	for i := range routes {
+		current.names[i] = routes[i].Name
+	}
+	u.index.Store(current)
+	slog.DebugContext(ctx, "Rebuilt route index", "routes", len(routes), "duration", time.Since(start))
+	return current, nil
+}
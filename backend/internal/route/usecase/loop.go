@@ -0,0 +1,113 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"test/portal/domain"
+	"test/portal/pkg/iputils"
+	"time"
+)
+
+// Bound the resolution of the backend hosts while validating a route
+const lookupTimeout = 2 * time.Second
+
+func lookupIP(ctx context.Context, host string) ([]netip.Addr, error) {
+	return net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+}
+
+/*
+Backends must not send the requests back to the portal. A backend whose host
+is the host of a route (the route itself included) goes through the proxy
+again, as does a backend resolving to one of the listen addresses. Hosts
+that can't be resolved are accepted, the Via header still catch the loop at
+runtime.
+*/
+func (u *routeUsecase) validateLoop(ctx context.Context, route domain.RouteItem, routes []domain.RouteItem) error {
+	targets := route.Targets()
+	if len(targets) == 0 {
+		return nil
+	}
+
+	routeHosts := map[string]string{normalizeHost(route.Host): route.Name}
+	for _, exist := range routes {
+		if exist.Name != route.Name {
+			routeHosts[normalizeHost(exist.Host)] = exist.Name
+		}
+	}
+
+	for _, backend := range targets {
+		backendURL, err := url.Parse(backend.URL)
+		if err != nil {
+			return errors.New(domain.ErrBadRequest + " :Invalid backend " + backend.URL)
+		}
+		if name, found := routeHosts[normalizeHost(backendURL.Hostname())]; found {
+			return errors.New(domain.ErrBadRequest + " :Backend " + backend.URL + " loops back to the portal through the route " + name)
+		}
+		if listenAddr, found := u.resolvesToListener(ctx, backendURL); found {
+			return errors.New(domain.ErrBadRequest + " :Backend " + backend.URL + " loops back to the portal listening on " + listenAddr)
+		}
+	}
+	return nil
+}
+
+// Listen address of the portal the backend connect to, a listener without
+// host accept the connections to any local address
+func (u *routeUsecase) resolvesToListener(ctx context.Context, backendURL *url.URL) (string, bool) {
+	if len(u.listenAddrs) == 0 {
+		return "", false
+	}
+	port := backendURL.Port()
+	if port == "" {
+		port = "80"
+		if backendURL.Scheme == "https" {
+			port = "443"
+		}
+	}
+
+	backendAddrs := u.resolve(ctx, backendURL.Hostname())
+	for _, listenAddr := range u.listenAddrs {
+		listenHost, listenPort, err := net.SplitHostPort(listenAddr)
+		if err != nil || listenPort != port {
+			continue
+		}
+		anyLocal := listenHost == ""
+		var listenAddrs []netip.Addr
+		if !anyLocal {
+			listenAddrs = u.resolve(ctx, listenHost)
+			anyLocal = len(listenAddrs) == 1 && listenAddrs[0].IsUnspecified()
+		}
+		for _, backendAddr := range backendAddrs {
+			if (anyLocal && iputils.IsLocal(backendAddr)) || slices.Contains(listenAddrs, backendAddr) {
+				return listenAddr, true
+			}
+		}
+	}
+	return "", false
+}
+
+func (u *routeUsecase) resolve(ctx context.Context, host string) []netip.Addr {
+	if addr, err := iputils.ParseAddr(host); err == nil {
+		return []netip.Addr{addr}
+	}
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+	addrs, err := u.lookupIP(ctx, host)
+	if err != nil {
+		slog.WarnContext(ctx, "Unable to resolve host while checking for loops", "host", host, "error", err)
+		return nil
+	}
+	for i := range addrs {
+		addrs[i] = addrs[i].Unmap().WithZone("")
+	}
+	return addrs
+}
+
+func normalizeHost(host string) string {
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
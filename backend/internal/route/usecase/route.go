@@ -3,15 +3,80 @@ package usecase
 import (
 	"context"
 	"errors"
+	"log/slog"
+	"net/netip"
+	"net/url"
+	"sync"
+	"sync/atomic"
 	"test/portal/domain"
+	"test/portal/internal/route/schedule"
+	"test/portal/pkg/traceutils"
+	"time"
 )
 
 type routeUsecase struct {
-	repo domain.RouteItemRepository
+	repo          domain.RouteItemRepository
+	drainer       domain.RouteDrainer
+	now           func() time.Time
+	expiryWarning time.Duration
+	listenAddrs   []string
+	lookupIP      func(ctx context.Context, host string) ([]netip.Addr, error)
+	// Swapped as a whole when the routes change, see routeIndex
+	index     atomic.Pointer[routeIndex]
+	indexLock sync.Mutex
+}
+
+type Config struct {
+	// Optional, nil when the proxy doesn't drain the routes
+	Drainer domain.RouteDrainer
+	// Clock of the schedules and expiries, time.Now when nil
+	Now func() time.Time
+	// Routes expiring within this duration carry a warning, 24 hours when 0
+	ExpiryWarning time.Duration
+	// Addresses the portal listen on (host:port), backends resolving to one
+	// of them are rejected
+	ListenAddrs []string
+	// Resolver of the backend hosts, net.DefaultResolver when nil
+	LookupIP func(ctx context.Context, host string) ([]netip.Addr, error)
 }
 
 // Create implements domain.RouteItemUsecase.
-func (u *routeUsecase) Create(ctx context.Context, route domain.RouteItem) (*domain.RouteItem, error) {
+func (u *routeUsecase) Create(ctx context.Context, route domain.RouteItem) (_ *domain.RouteItem, err error) {
+	ctx, span := traceutils.Start(ctx, "routeUsecase.Create")
+	defer traceutils.End(span, &err)
+
+	if err := validatePath(route); err != nil {
+		return nil, err
+	}
+	if err := validateBackendURLs(route); err != nil {
+		return nil, err
+	}
+	if err := validateBackendTLS(route); err != nil {
+		return nil, err
+	}
+	if err := validateFaultInjection(route, u.now()); err != nil {
+		return nil, err
+	}
+	if err := validateStatic(route); err != nil {
+		return nil, err
+	}
+	if err := validateSchedule(route); err != nil {
+		return nil, err
+	}
+	if err := validateExpiry(route, u.now()); err != nil {
+		return nil, err
+	}
+	routes, err := u.repo.GetAll(ctx)
+	if err != nil {
+		return nil, errors.New(domain.ErrInternalServer)
+	}
+	if err := validatePathConflict(route, routes); err != nil {
+		return nil, err
+	}
+	if err := u.validateLoop(ctx, route, routes); err != nil {
+		return nil, err
+	}
+
 	existRoute, err := u.repo.GetOne(ctx, route.Name)
 	if err != nil {
 		if err.Error() != domain.ErrNotFound {
@@ -22,17 +87,23 @@ func (u *routeUsecase) Create(ctx context.Context, route domain.RouteItem) (*dom
 		return nil, errors.New(domain.ErrBadRequest)
 	}
 
+	route.Drain, route.Expiry, route.EffectiveState = nil, nil, ""
 	createdRoute, err := u.repo.Create(ctx, route)
 	if err != nil {
 		return nil, errors.New(domain.ErrInternalServer)
 	}
+	u.updateDrain(createdRoute)
+	u.fill(createdRoute)
 
 	return createdRoute, nil
 }
 
 // Delete implements domain.RouteItemUsecase.
-func (u *routeUsecase) Delete(ctx context.Context, name string) error {
-	_, err := u.repo.GetOne(ctx, name)
+func (u *routeUsecase) Delete(ctx context.Context, name string) (err error) {
+	ctx, span := traceutils.Start(ctx, "routeUsecase.Delete")
+	defer traceutils.End(span, &err)
+
+	_, err = u.repo.GetOne(ctx, name)
 	if err != nil {
 		return err
 	}
@@ -40,47 +111,285 @@ func (u *routeUsecase) Delete(ctx context.Context, name string) error {
 	if err != nil {
 		return errors.New(domain.ErrInternalServer)
 	}
+	if u.drainer != nil {
+		u.drainer.Drain(name)
+	}
 	return nil
 }
 
 // GetAll implements domain.RouteItemUsecase.
-func (u *routeUsecase) GetAll(ctx context.Context) ([]domain.RouteItem, error) {
+func (u *routeUsecase) GetAll(ctx context.Context) (_ []domain.RouteItem, err error) {
+	ctx, span := traceutils.Start(ctx, "routeUsecase.GetAll")
+	defer traceutils.End(span, &err)
+
 	routes, err := u.repo.GetAll(ctx)
 	if err != nil {
 		return nil, errors.New(domain.ErrInternalServer)
 	}
+	for i := range routes {
+		u.fill(&routes[i])
+	}
 
 	return routes, nil
 }
 
 // GetOne implements domain.RouteItemUsecase.
-func (u *routeUsecase) GetOne(ctx context.Context, name string) (*domain.RouteItem, error) {
+func (u *routeUsecase) GetOne(ctx context.Context, name string) (_ *domain.RouteItem, err error) {
+	ctx, span := traceutils.Start(ctx, "routeUsecase.GetOne")
+	defer traceutils.End(span, &err)
+
 	route, err := u.repo.GetOne(ctx, name)
 	if err != nil {
 		return nil, errors.New(domain.ErrInternalServer)
 	}
+	u.fill(route)
 
 	return route, nil
 }
 
 // Update implements domain.RouteItemUsecase.
-func (u *routeUsecase) Update(ctx context.Context, route domain.RouteItem) (*domain.RouteItem, error) {
-	_, err := u.repo.GetOne(ctx, route.Name)
+func (u *routeUsecase) Update(ctx context.Context, route domain.RouteItem) (_ *domain.RouteItem, err error) {
+	ctx, span := traceutils.Start(ctx, "routeUsecase.Update")
+	defer traceutils.End(span, &err)
+
+	if err := validatePath(route); err != nil {
+		return nil, err
+	}
+	if err := validateBackendURLs(route); err != nil {
+		return nil, err
+	}
+	if err := validateBackendTLS(route); err != nil {
+		return nil, err
+	}
+	if err := validateFaultInjection(route, u.now()); err != nil {
+		return nil, err
+	}
+	if err := validateStatic(route); err != nil {
+		return nil, err
+	}
+	if err := validateSchedule(route); err != nil {
+		return nil, err
+	}
+	if err := validateExpiry(route, u.now()); err != nil {
+		return nil, err
+	}
+	routes, err := u.repo.GetAll(ctx)
+	if err != nil {
+		return nil, errors.New(domain.ErrInternalServer)
+	}
+	if err := validatePathConflict(route, routes); err != nil {
+		return nil, err
+	}
+	if err := u.validateLoop(ctx, route, routes); err != nil {
+		return nil, err
+	}
+
+	_, err = u.repo.GetOne(ctx, route.Name)
 	if err != nil {
 		return nil, err
 	}
 
+	route.Drain, route.Expiry, route.EffectiveState = nil, nil, ""
 	updatedRoute, err := u.repo.Update(ctx, route)
 	if err != nil {
 		return nil, err
 	}
+	u.updateDrain(updatedRoute)
+	u.fill(updatedRoute)
 
 	return updatedRoute, nil
 
 }
 
+// SetMaintenance implements domain.RouteItemUsecase.
+func (u *routeUsecase) SetMaintenance(ctx context.Context, name string, maintenance domain.RouteMaintenance) (_ *domain.RouteItem, err error) {
+	ctx, span := traceutils.Start(ctx, "routeUsecase.SetMaintenance")
+	defer traceutils.End(span, &err)
+
+	route, err := u.repo.GetOne(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	route.Maintenance = &maintenance
+	updatedRoute, err := u.repo.Update(ctx, *route)
+	if err != nil {
+		return nil, errors.New(domain.ErrInternalServer)
+	}
+	u.fill(updatedRoute)
+
+	return updatedRoute, nil
+}
+
+// MatchRoute implements domain.RouteItemUsecase.
+func (u *routeUsecase) MatchRoute(ctx context.Context, host string, requestURL *url.URL) (_ *domain.RouteMatch, err error) {
+	ctx, span := traceutils.Start(ctx, "routeUsecase.MatchRoute")
+	defer traceutils.End(span, &err)
+
+	current, err := u.routeIndex(ctx)
+	if err != nil {
+		return nil, errors.New(domain.ErrInternalServer)
+	}
+	matched := current.index.Match(host, requestURL, u.now())
+	if matched == nil {
+		return nil, errors.New(domain.ErrNotFound)
+	}
+	matched.Generation, matched.RouteNames = current.generation, current.names
+
+	// The indexed route is shared by the requests
+	route := *matched.Route
+	u.fill(&route)
+	matched.Route = &route
+	return matched, nil
+}
+
+// GetDrainStatus implements domain.RouteItemUsecase.
+func (u *routeUsecase) GetDrainStatus(ctx context.Context, name string) (_ *domain.RouteDrainStatus, err error) {
+	ctx, span := traceutils.Start(ctx, "routeUsecase.GetDrainStatus")
+	defer traceutils.End(span, &err)
+
+	if u.drainer != nil {
+		if status := u.drainer.DrainStatus(name); status != nil {
+			return status, nil
+		}
+	}
+	_, err = u.repo.GetOne(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.RouteDrainStatus{Draining: false}, nil
+}
+
+// ExtendExpiry implements domain.RouteItemUsecase.
+func (u *routeUsecase) ExtendExpiry(ctx context.Context, name string, extension domain.RouteExpiryExtension) (_ *domain.RouteItem, err error) {
+	ctx, span := traceutils.Start(ctx, "routeUsecase.ExtendExpiry")
+	defer traceutils.End(span, &err)
+
+	route, err := u.repo.GetOne(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	now := u.now()
+	expiresAt := extension.ExpiresAt
+	if expiresAt == nil {
+		base := now
+		if route.ExpiresAt != nil && route.ExpiresAt.After(now) {
+			base = *route.ExpiresAt
+		}
+		extended := base.Add(time.Duration(extension.ExtendSeconds) * time.Second)
+		expiresAt = &extended
+	}
+	if !expiresAt.After(now) {
+		return nil, errors.New(domain.ErrBadRequest + " :The expiry must be in the future")
+	}
+
+	// The enabled state is left as is, a route disabled by the reaper stay disabled
+	route.ExpiresAt = expiresAt
+	updatedRoute, err := u.repo.Update(ctx, *route)
+	if err != nil {
+		return nil, errors.New(domain.ErrInternalServer)
+	}
+	u.fill(updatedRoute)
+
+	return updatedRoute, nil
+}
+
+// ReapExpired implements domain.RouteItemUsecase.
+func (u *routeUsecase) ReapExpired(ctx context.Context) (_ []string, err error) {
+	ctx, span := traceutils.Start(ctx, "routeUsecase.ReapExpired")
+	defer traceutils.End(span, &err)
+
+	routes, err := u.repo.GetAll(ctx)
+	if err != nil {
+		return nil, errors.New(domain.ErrInternalServer)
+	}
+
+	now := u.now()
+	reaped := make([]string, 0)
+	for _, route := range routes {
+		if route.ExpiresAt == nil || now.Before(*route.ExpiresAt) {
+			continue
+		}
+		if route.ExpiryPolicy == domain.RouteExpiryDelete {
+			if err := u.repo.Delete(ctx, route.Name); err != nil {
+				return reaped, errors.New(domain.ErrInternalServer)
+			}
+		} else {
+			if route.Enabled == nil || !*route.Enabled {
+				continue
+			}
+			isEnabled := false
+			route.Enabled = &isEnabled
+			if _, err := u.repo.Update(ctx, route); err != nil {
+				return reaped, errors.New(domain.ErrInternalServer)
+			}
+		}
+		if u.drainer != nil {
+			u.drainer.Drain(route.Name)
+		}
+		slog.InfoContext(ctx, "Expired route reaped", "route", route.Name, "policy", route.ExpiryPolicy, "expires_at", *route.ExpiresAt)
+		reaped = append(reaped, route.Name)
+	}
+
+	return reaped, nil
+}
+
+// Disabling a route drain its requests, enabling it again stop the drain.
+// Called before fill so the drain status is reported
+func (u *routeUsecase) updateDrain(route *domain.RouteItem) {
+	if u.drainer == nil {
+		return
+	}
+	if schedule.EffectiveState(*route, u.now()) == domain.RouteStateActive {
+		u.drainer.CancelDrain(route.Name)
+	} else {
+		u.drainer.Drain(route.Name)
+	}
+}
+
+// Fill the fields computed at read time, only routes not active can be draining
+func (u *routeUsecase) fill(route *domain.RouteItem) {
+	now := u.now()
+	route.EffectiveState = schedule.EffectiveState(*route, now)
+	route.Drain = nil
+	if u.drainer != nil && route.EffectiveState != domain.RouteStateActive {
+		route.Drain = u.drainer.DrainStatus(route.Name)
+	}
+
+	route.Expiry = nil
+	if route.ExpiresAt != nil {
+		remaining := route.ExpiresAt.Sub(now)
+		route.Expiry = &domain.RouteExpiryStatus{Expired: remaining <= 0}
+		if remaining > 0 {
+			route.Expiry.ExpiresInSeconds = int64(remaining.Seconds())
+			if remaining <= u.expiryWarning {
+				route.Expiry.Warning = "Route expires in " + remaining.Round(time.Minute).String()
+			}
+		}
+	}
+}
+
 func NewRouteUsecase(repo domain.RouteItemRepository) domain.RouteItemUsecase {
+	return NewConfiguredRouteUsecase(repo, Config{})
+}
+
+func NewConfiguredRouteUsecase(repo domain.RouteItemRepository, config Config) domain.RouteItemUsecase {
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+	if config.ExpiryWarning == 0 {
+		config.ExpiryWarning = 24 * time.Hour
+	}
+	if config.LookupIP == nil {
+		config.LookupIP = lookupIP
+	}
 	return &routeUsecase{
-		repo: repo,
+		repo:          repo,
+		drainer:       config.Drainer,
+		now:           config.Now,
+		expiryWarning: config.ExpiryWarning,
+		listenAddrs:   config.ListenAddrs,
+		lookupIP:      config.LookupIP,
 	}
 }
@@ -0,0 +1,149 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"test/portal/domain"
+	"test/portal/pkg/traceutils"
+)
+
+type streamRouteUsecase struct {
+	repo        domain.StreamRouteRepository
+	listenAddrs []string
+}
+
+type StreamConfig struct {
+	// Addresses the portal listen on (host:port), stream routes can't take
+	// their ports
+	ListenAddrs []string
+}
+
+// Create implements domain.StreamRouteUsecase.
+func (u *streamRouteUsecase) Create(ctx context.Context, route domain.StreamRoute) (_ *domain.StreamRoute, err error) {
+	ctx, span := traceutils.Start(ctx, "streamRouteUsecase.Create")
+	defer traceutils.End(span, &err)
+
+	existRoute, err := u.repo.GetOne(ctx, route.Name)
+	if err != nil {
+		if err.Error() != domain.ErrNotFound {
+			return nil, err
+		}
+	}
+	if existRoute != nil {
+		return nil, errors.New(domain.ErrBadRequest)
+	}
+	if err := u.checkListenConflict(ctx, route); err != nil {
+		return nil, err
+	}
+
+	createdRoute, err := u.repo.Create(ctx, route)
+	if err != nil {
+		return nil, errors.New(domain.ErrInternalServer)
+	}
+
+	return createdRoute, nil
+}
+
+// Delete implements domain.StreamRouteUsecase.
+func (u *streamRouteUsecase) Delete(ctx context.Context, name string) (err error) {
+	ctx, span := traceutils.Start(ctx, "streamRouteUsecase.Delete")
+	defer traceutils.End(span, &err)
+
+	_, err = u.repo.GetOne(ctx, name)
+	if err != nil {
+		return err
+	}
+	err = u.repo.Delete(ctx, name)
+	if err != nil {
+		return errors.New(domain.ErrInternalServer)
+	}
+	return nil
+}
+
+// GetAll implements domain.StreamRouteUsecase.
+func (u *streamRouteUsecase) GetAll(ctx context.Context) (_ []domain.StreamRoute, err error) {
+	ctx, span := traceutils.Start(ctx, "streamRouteUsecase.GetAll")
+	defer traceutils.End(span, &err)
+
+	routes, err := u.repo.GetAll(ctx)
+	if err != nil {
+		return nil, errors.New(domain.ErrInternalServer)
+	}
+
+	return routes, nil
+}
+
+// GetOne implements domain.StreamRouteUsecase.
+func (u *streamRouteUsecase) GetOne(ctx context.Context, name string) (_ *domain.StreamRoute, err error) {
+	ctx, span := traceutils.Start(ctx, "streamRouteUsecase.GetOne")
+	defer traceutils.End(span, &err)
+
+	return u.repo.GetOne(ctx, name)
+}
+
+// Update implements domain.StreamRouteUsecase.
+func (u *streamRouteUsecase) Update(ctx context.Context, route domain.StreamRoute) (_ *domain.StreamRoute, err error) {
+	ctx, span := traceutils.Start(ctx, "streamRouteUsecase.Update")
+	defer traceutils.End(span, &err)
+
+	_, err = u.repo.GetOne(ctx, route.Name)
+	if err != nil {
+		return nil, err
+	}
+	if err := u.checkListenConflict(ctx, route); err != nil {
+		return nil, err
+	}
+
+	updatedRoute, err := u.repo.Update(ctx, route)
+	if err != nil {
+		return nil, err
+	}
+
+	return updatedRoute, nil
+}
+
+/*
+A plain TCP route own its port, SNI routes can share a port as long as
+their server names differ. The ports of the proxy and the management API are
+never available. Disabled routes are checked too so enabling a
+route later can't create a conflict.
+*/
+func (u *streamRouteUsecase) checkListenConflict(ctx context.Context, route domain.StreamRoute) error {
+	port := strconv.Itoa(route.ListenPort)
+	for _, addr := range u.listenAddrs {
+		if _, listenPort, err := net.SplitHostPort(addr); err == nil && listenPort == port {
+			return errors.New(domain.ErrBadRequest + " :Port " + port + " is used by the portal on " + addr)
+		}
+	}
+
+	existRoutes, err := u.repo.GetAll(ctx)
+	if err != nil {
+		return errors.New(domain.ErrInternalServer)
+	}
+	for _, exist := range existRoutes {
+		if exist.Name == route.Name || exist.ListenPort != route.ListenPort {
+			continue
+		}
+		if exist.SNIHost == "" || route.SNIHost == "" {
+			return errors.New(domain.ErrBadRequest + " :Port " + port + " is already used by the stream route " + exist.Name)
+		}
+		if strings.EqualFold(exist.SNIHost, route.SNIHost) {
+			return errors.New(domain.ErrBadRequest + " :Server name " + route.SNIHost + " on port " + port + " is already used by the stream route " + exist.Name)
+		}
+	}
+	return nil
+}
+
+func NewStreamRouteUsecase(repo domain.StreamRouteRepository) domain.StreamRouteUsecase {
+	return NewConfiguredStreamRouteUsecase(repo, StreamConfig{})
+}
+
+func NewConfiguredStreamRouteUsecase(repo domain.StreamRouteRepository, config StreamConfig) domain.StreamRouteUsecase {
+	return &streamRouteUsecase{
+		repo:        repo,
+		listenAddrs: config.ListenAddrs,
+	}
+}
@@ -0,0 +1,158 @@
+package usecase
+
+import (
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"test/portal/domain"
+	"test/portal/internal/route/schedule"
+	"test/portal/pkg/fileutils"
+	"test/portal/pkg/pathutils"
+	"test/portal/pkg/tlsutils"
+	"time"
+	"unicode"
+)
+
+// Directory the static routes must be served from, set at startup
+var StaticRoot = "./static"
+
+// Check the backend TLS settings the struct validator can't, the referenced
+// files must be readable and hold a valid CA bundle and key pair
+func validateBackendTLS(route domain.RouteItem) error {
+	for _, backend := range route.Targets() {
+		if backend.TLS == nil {
+			continue
+		}
+		if !strings.HasPrefix(backend.URL, "https://") {
+			return errors.New(domain.ErrBadRequest + " :TLS settings require an https backend " + backend.URL)
+		}
+		if _, err := tlsutils.BuildClientConfig(*backend.TLS); err != nil {
+			return errors.New(domain.ErrBadRequest + " :Invalid TLS settings for " + backend.URL + ", " + err.Error())
+		}
+		if backend.TLS.InsecureSkipVerify {
+			slog.Warn("Certificate verification is disabled for backend", "backend", backend.URL, "route", route.Name)
+		}
+	}
+	return nil
+}
+
+// A backend is identified by its URL (affinity cookies, health), listed twice
+// the second entry would never be told apart
+func validateBackendURLs(route domain.RouteItem) error {
+	seen := make(map[string]bool, len(route.Backends))
+	for _, backend := range route.Backends {
+		if seen[backend.URL] {
+			return errors.New(domain.ErrBadRequest + " :Duplicate backend " + backend.URL)
+		}
+		seen[backend.URL] = true
+	}
+	return nil
+}
+
+// Enabled fault injection must expire in the future, the struct validator
+// only ensure the expiry is set
+func validateFaultInjection(route domain.RouteItem, now time.Time) error {
+	faults := route.Faults
+	if faults == nil || !faults.Enabled {
+		return nil
+	}
+	if faults.ExpiresAt == nil || !faults.ExpiresAt.After(now) {
+		return errors.New(domain.ErrBadRequest + " :Fault injection require an expiresAt in the future")
+	}
+	return nil
+}
+
+// Static directory must exist under StaticRoot
+func validateStatic(route domain.RouteItem) error {
+	if route.Static == nil {
+		return nil
+	}
+	if _, err := fileutils.ResolveDirUnder(StaticRoot, route.Static.Directory); err != nil {
+		return errors.New(domain.ErrBadRequest + " :Invalid static directory " + route.Static.Directory + ", " + err.Error())
+	}
+	return nil
+}
+
+// Time zone, windows and bounds of the schedule must be valid
+func validateSchedule(route domain.RouteItem) error {
+	if route.Schedule == nil {
+		return nil
+	}
+	if err := schedule.Validate(route.Schedule); err != nil {
+		return errors.New(domain.ErrBadRequest + " :Invalid schedule, " + err.Error())
+	}
+	return nil
+}
+
+// An enabled route can't be created or updated already expired
+func validateExpiry(route domain.RouteItem, now time.Time) error {
+	if route.ExpiresAt == nil || route.Enabled == nil || !*route.Enabled {
+		return nil
+	}
+	if !route.ExpiresAt.After(now) {
+		return errors.New(domain.ErrBadRequest + " :The expiry of an enabled route must be in the future")
+	}
+	return nil
+}
+
+// Path must parse as a template and the rewrite and header templates may
+// only reference its parameters. Static routes serve a directory, only a
+// trailing wildcard is allowed
+func validatePath(route domain.RouteItem) error {
+	template, err := pathutils.Parse(route.Path)
+	if err != nil {
+		return errors.New(domain.ErrBadRequest + " :Invalid path " + route.Path + ", " + err.Error())
+	}
+	params := template.Params()
+	if route.Static != nil && len(params) > 0 && !(len(params) == 1 && params[0] == pathutils.Wildcard) {
+		return errors.New(domain.ErrBadRequest + " :Static routes can't have path parameters")
+	}
+
+	templates := []string{route.RewritePath}
+	for name, value := range route.RequestHeaders {
+		if strings.ContainsFunc(value, unicode.IsControl) {
+			return errors.New(domain.ErrBadRequest + " :Invalid value for the request header " + name)
+		}
+		templates = append(templates, value)
+	}
+	for _, value := range templates {
+		for _, reference := range pathutils.References(value) {
+			if !slices.Contains(params, reference) {
+				return errors.New(domain.ErrBadRequest + " :Unknown path parameter {" + reference + "} in " + value)
+			}
+		}
+	}
+	return nil
+}
+
+// Templates of the same shape on a host would match the same requests, the
+// route serving them would depend on the storage order. A case-insensitive
+// route share the shapes differing only by their case
+func validatePathConflict(route domain.RouteItem, routes []domain.RouteItem) error {
+	template, err := pathutils.Parse(route.Path)
+	if err != nil {
+		return nil
+	}
+	for _, exist := range routes {
+		if exist.Name == route.Name || normalizeHost(exist.Host) != normalizeHost(route.Host) {
+			continue
+		}
+		existTemplate, err := pathutils.Parse(exist.Path)
+		if err != nil || (!template.IsTemplate() && !existTemplate.IsTemplate()) {
+			continue
+		}
+		shape, existShape := template.Shape(), existTemplate.Shape()
+		if isCaseInsensitive(route) || isCaseInsensitive(exist) {
+			shape, existShape = strings.ToLower(shape), strings.ToLower(existShape)
+		}
+		if shape == existShape {
+			return errors.New(domain.ErrBadRequest + " :Path " + route.Path + " conflicts with " + exist.Path + " of the route " + exist.Name)
+		}
+	}
+	return nil
+}
+
+func isCaseInsensitive(route domain.RouteItem) bool {
+	return route.PathMatching != nil && route.PathMatching.CaseInsensitive
+}
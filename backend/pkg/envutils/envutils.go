@@ -0,0 +1,43 @@
+package envutils
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+func GetString(key string, fallback string) string {
+	value, ok := os.LookupEnv(key)
+	if !ok || strings.TrimSpace(value) == "" {
+		return fallback
+	}
+	return strings.TrimSpace(value)
+}
+
+// GetList read comma separated values, empty entries are skipped
+func GetList(key string) []string {
+	result := make([]string, 0)
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		value = strings.TrimSpace(value)
+		if value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+func GetBool(key string, fallback bool) bool {
+	value, err := strconv.ParseBool(GetString(key, strconv.FormatBool(fallback)))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+func GetInt64(key string, fallback int64) int64 {
+	value, err := strconv.ParseInt(GetString(key, ""), 10, 64)
+	if err != nil {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,51 @@
+package fileutils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/*
+ResolveDirUnder return the real path of dir, relative to root or absolute,
+when it's an existing directory inside root. Symbolic links are resolved
+first so a link can't point outside the root.
+*/
+func ResolveDirUnder(root string, dir string) (string, error) {
+	if root == "" {
+		return "", errors.New("no root directory configured")
+	}
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+	realRoot, err = filepath.Abs(realRoot)
+	if err != nil {
+		return "", err
+	}
+
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(realRoot, dir)
+	}
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+	realDir, err = filepath.Abs(realDir)
+	if err != nil {
+		return "", err
+	}
+
+	if realDir != realRoot && !strings.HasPrefix(realDir, realRoot+string(filepath.Separator)) {
+		return "", errors.New("directory is outside of the root " + realRoot)
+	}
+	info, err := os.Stat(realDir)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", errors.New("not a directory " + realDir)
+	}
+	return realDir, nil
+}
@@ -3,7 +3,8 @@ package httputils
 import (
 	"encoding/json"
 	"errors"
-	"log"
+	"log/slog"
+	"mime"
 	"net/http"
 	"strconv"
 	"strings"
@@ -12,19 +13,25 @@ import (
 	"github.com/go-playground/validator/v10"
 )
 
+// Upper bound of the JSON payload decoded by ValidateAndUnmarshal
+var MaxBodyBytes int64 = 1 << 20
+
 type response struct {
 	Data    any    `json:"data"`
 	Message string `json:"message"`
 	Status  int    `json:"status"`
+	// Set by the RequestID middleware on the response header
+	RequestID string `json:"requestId,omitempty"`
 }
 
 func WriteSuccessResponse(w http.ResponseWriter, payload any) {
 	w.Header().Add("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	responseData := response{
-		Data:    payload,
-		Message: "Success",
-		Status:  http.StatusOK,
+		Data:      payload,
+		Message:   "Success",
+		Status:    http.StatusOK,
+		RequestID: w.Header().Get(RequestIDHeader),
 	}
 	err := json.NewEncoder(w).Encode(responseData)
 	if err != nil {
@@ -41,9 +48,10 @@ func WriteErrorResponse(w http.ResponseWriter, processErr error) {
 		return
 	}
 	errResponse := response{
-		Data:    nil,
-		Message: processErr.Error(),
-		Status:  status,
+		Data:      nil,
+		Message:   processErr.Error(),
+		Status:    status,
+		RequestID: w.Header().Get(RequestIDHeader),
 	}
 
 	w.Header().Add("Content-Type", "application/json")
@@ -56,14 +64,19 @@ func WriteErrorResponse(w http.ResponseWriter, processErr error) {
 }
 
 func ValidateAndUnmarshal[T any](r *http.Request, validate *validator.Validate, data *T) error {
-	err := json.NewDecoder(r.Body).Decode(data)
+	body := http.MaxBytesReader(nil, r.Body, MaxBodyBytes)
+	err := json.NewDecoder(body).Decode(data)
 	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return errors.New(domain.ErrPayloadTooLarge)
+		}
 		return errors.New(domain.ErrBadRequest)
 	}
 
 	err = validate.Struct(data)
 	if err != nil {
-		log.Println("Validate error", err)
+		slog.Debug("Validate error", "error", err)
 		return errors.New(domain.ErrBadRequest + ";;" + err.Error())
 	}
 	return nil
@@ -71,10 +84,27 @@ func ValidateAndUnmarshal[T any](r *http.Request, validate *validator.Validate,
 
 func GetPathParamByPathPosition(r *http.Request, position int) *string {
 	urlParts := strings.Split(r.URL.Path, "/")
-	if len(urlParts) < position {
+	if len(urlParts) <= position {
 		return nil
 	}
-	paramValue := &urlParts[position]
-	log.Println("Find param value", *paramValue)
-	return paramValue
+	return &urlParts[position]
+}
+
+// MatchMediaType report whether the media type of the Content-Type value is
+// in the list, entries can use a subtype wildcard like text/*
+func MatchMediaType(mediaTypes []string, contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range mediaTypes {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		if allowed == "*/*" || allowed == mediaType {
+			return true
+		}
+		if strings.HasSuffix(allowed, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(allowed, "*")) {
+			return true
+		}
+	}
+	return false
 }
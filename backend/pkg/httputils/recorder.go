@@ -0,0 +1,49 @@
+package httputils
+
+import "net/http"
+
+// Recorder capture the status and the size of the response sent to the client
+type Recorder struct {
+	http.ResponseWriter
+	// 0 until the handler write the header or the body
+	Status int
+	Bytes  int64
+}
+
+func NewRecorder(w http.ResponseWriter) *Recorder {
+	return &Recorder{ResponseWriter: w}
+}
+
+// StatusCode return the status sent, 200 when the handler wrote nothing
+func (r *Recorder) StatusCode() int {
+	if r.Status == 0 {
+		return http.StatusOK
+	}
+	return r.Status
+}
+
+func (r *Recorder) WriteHeader(status int) {
+	// Informational responses are followed by the final one
+	if r.Status == 0 && (status >= 200 || status == http.StatusSwitchingProtocols) {
+		r.Status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *Recorder) Write(b []byte) (int, error) {
+	if r.Status == 0 {
+		r.Status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.Bytes += int64(n)
+	return n, err
+}
+
+func (r *Recorder) Flush() {
+	http.NewResponseController(r.ResponseWriter).Flush()
+}
+
+// Let http.ResponseController reach the connection for upgrades
+func (r *Recorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
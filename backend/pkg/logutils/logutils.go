@@ -0,0 +1,74 @@
+package logutils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"test/portal/pkg/httputils"
+)
+
+// Attribute keys whose value is never written, compared case insensitively
+var sensitiveKeys = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"cookie":              true,
+	"set-cookie":          true,
+	"x-api-key":           true,
+	"password":            true,
+	"secret":              true,
+	"token":               true,
+	"bypassheadervalue":   true,
+	"clientkeyfile":       true,
+}
+
+const redacted = "[REDACTED]"
+
+/*
+NewLogger build the application logger. Level is debug, info, warn or error,
+format is text or json. Sensitive attributes are redacted by key and the
+request ID of the context is added to the records logged with a context.
+*/
+func NewLogger(output io.Writer, level string, format string) (*slog.Logger, error) {
+	var slogLevel slog.Level
+	if err := slogLevel.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("unknown log level %q", level)
+	}
+
+	options := &slog.HandlerOptions{Level: slogLevel, ReplaceAttr: Redact}
+	switch strings.ToLower(format) {
+	case "text":
+		return slog.New(contextHandler{slog.NewTextHandler(output, options)}), nil
+	case "json":
+		return slog.New(contextHandler{slog.NewJSONHandler(output, options)}), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q", format)
+}
+
+// Redact replace the value of the sensitive attributes, usable as ReplaceAttr
+func Redact(groups []string, attr slog.Attr) slog.Attr {
+	if sensitiveKeys[strings.ToLower(attr.Key)] {
+		return slog.String(attr.Key, redacted)
+	}
+	return attr
+}
+
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if requestID := httputils.RequestIDFrom(ctx); requestID != "" {
+		record.AddAttrs(slog.String("request_id", requestID))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,365 @@
+package pathutils
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Name of the parameter holding the segments matched by a trailing wildcard
+const Wildcard = "*"
+
+var (
+	literalRegex = regexp.MustCompile(`^[a-zA-Z0-9\-_]*$`)
+	paramRegex   = regexp.MustCompile(`^\{([a-zA-Z_][a-zA-Z0-9_]*)\}$`)
+	// {name} or {*} references of a rewrite or header template
+	referenceRegex = regexp.MustCompile(`\{([a-zA-Z_][a-zA-Z0-9_]*|\*)\}`)
+)
+
+/*
+Template of a route path. Segments are literal or {name} parameters matching
+any one segment, the last segment may be a * wildcard matching the remaining
+segments, none included. Like literal paths a template match on segment
+boundary: /users/{id} serve /users/42 and /users/42/orders.
+*/
+type Template struct {
+	segments []Segment
+	wildcard bool
+	// The path ended with a slash, /api/ rather than /api
+	trailingSlash bool
+}
+
+// Segment of a template, literal or parameter
+type Segment struct {
+	Literal string
+	// Parameter name, empty for a literal segment
+	Param string
+}
+
+// Parse a route path, a literal path is a template without parameter
+func Parse(path string) (*Template, error) {
+	if !strings.HasPrefix(path, "/") {
+		return nil, errors.New("path must start with /")
+	}
+	template := &Template{}
+	trimmed := strings.TrimSuffix(path[1:], "/")
+	if trimmed == "" {
+		return template, nil
+	}
+	template.trailingSlash = trimmed != path[1:]
+
+	parts := strings.Split(trimmed, "/")
+	seen := make(map[string]bool)
+	for i, part := range parts {
+		if part == Wildcard {
+			if i != len(parts)-1 {
+				return nil, errors.New("wildcard must be the last segment")
+			}
+			template.wildcard = true
+			continue
+		}
+		if match := paramRegex.FindStringSubmatch(part); match != nil {
+			if seen[match[1]] {
+				return nil, fmt.Errorf("duplicate parameter %q", match[1])
+			}
+			seen[match[1]] = true
+			template.segments = append(template.segments, Segment{Param: match[1]})
+			continue
+		}
+		if !literalRegex.MatchString(part) {
+			return nil, fmt.Errorf("invalid segment %q", part)
+		}
+		template.segments = append(template.segments, Segment{Literal: part})
+	}
+	return template, nil
+}
+
+// IsTemplate report whether the path has parameters or a wildcard
+func (t *Template) IsTemplate() bool {
+	if t.wildcard {
+		return true
+	}
+	for _, segment := range t.segments {
+		if segment.Param != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Segments of the template, the wildcard left out
+func (t *Template) Segments() []Segment {
+	return t.segments
+}
+
+// Params name the captured parameters, the wildcard included
+func (t *Template) Params() []string {
+	params := make([]string, 0, len(t.segments)+1)
+	for _, segment := range t.segments {
+		if segment.Param != "" {
+			params = append(params, segment.Param)
+		}
+	}
+	if t.wildcard {
+		params = append(params, Wildcard)
+	}
+	return params
+}
+
+/*
+Match the request path, it return the captured parameters and the rest of
+the path after the template (empty with a wildcard, which capture it).
+Parameters never capture an empty, . or .. segment so a rewrite can't climb
+out of its target path. foldCase compare the literal segments ignoring the
+ASCII case only, K (Kelvin sign) never match k.
+*/
+func (t *Template) Match(path string, foldCase bool) (map[string]string, string, bool) {
+	var params map[string]string
+	rest := path
+	for _, segment := range t.segments {
+		if !strings.HasPrefix(rest, "/") {
+			return nil, "", false
+		}
+		value, remaining, found := strings.Cut(rest[1:], "/")
+		if found {
+			remaining = "/" + remaining
+		}
+		if segment.Param == "" {
+			if value != segment.Literal && !(foldCase && asciiEqualFold(value, segment.Literal)) {
+				return nil, "", false
+			}
+		} else {
+			if !isCapturable(value) {
+				return nil, "", false
+			}
+			if params == nil {
+				params = make(map[string]string, len(t.segments))
+			}
+			params[segment.Param] = value
+		}
+		rest = remaining
+	}
+
+	if t.wildcard {
+		value := strings.TrimPrefix(rest, "/")
+		for _, part := range strings.Split(value, "/") {
+			if part == "." || part == ".." {
+				return nil, "", false
+			}
+		}
+		if params == nil {
+			params = make(map[string]string, 1)
+		}
+		params[Wildcard] = value
+		rest = ""
+	}
+	return params, rest, true
+}
+
+func isCapturable(value string) bool {
+	return value != "" && value != "." && value != ".."
+}
+
+func asciiEqualFold(a string, b string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := 0; i < len(a); i++ {
+		if lower(a[i]) != lower(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func lower(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+// SlashMismatch report whether a request ending at the template (rest empty
+// or /) differ from the path of the route by its trailing slash. Wildcard
+// templates and the root path accept both forms
+func (t *Template) SlashMismatch(rest string) bool {
+	if t.wildcard || len(t.segments) == 0 || (rest != "" && rest != "/") {
+		return false
+	}
+	return (rest == "/") != t.trailingSlash
+}
+
+// TrailingSlash report whether the route path end with a slash
+func (t *Template) TrailingSlash() bool {
+	return t.trailingSlash
+}
+
+// Shape of the template, parameter names left out. Templates of the same
+// shape match the same requests
+func (t *Template) Shape() string {
+	var shape strings.Builder
+	for _, segment := range t.segments {
+		shape.WriteString("/")
+		if segment.Param != "" {
+			shape.WriteString("{}")
+		} else {
+			shape.WriteString(segment.Literal)
+		}
+	}
+	if shape.Len() == 0 {
+		return "/"
+	}
+	return shape.String()
+}
+
+/*
+Compare the specificity of two templates matching the same request, it
+return a positive number when t is more specific. The template with more
+segments wins, then the first literal segment against a parameter, then the
+template without wildcard.
+*/
+func (t *Template) Compare(other *Template) int {
+	if len(t.segments) != len(other.segments) {
+		return len(t.segments) - len(other.segments)
+	}
+	for i := range t.segments {
+		isLiteral, otherIsLiteral := t.segments[i].Param == "", other.segments[i].Param == ""
+		if isLiteral != otherIsLiteral {
+			if isLiteral {
+				return 1
+			}
+			return -1
+		}
+	}
+	if t.wildcard != other.wildcard {
+		if other.wildcard {
+			return 1
+		}
+		return -1
+	}
+	return 0
+}
+
+// References name the parameters used by a rewrite or header template
+func References(template string) []string {
+	matches := referenceRegex.FindAllStringSubmatch(template, -1)
+	names := make([]string, 0, len(matches))
+	for _, match := range matches {
+		names = append(names, match[1])
+	}
+	return names
+}
+
+// Expand replace the {name} references of the template by the parameters,
+// unknown references are left as is
+func Expand(template string, params map[string]string) string {
+	return referenceRegex.ReplaceAllStringFunc(template, func(reference string) string {
+		if value, found := params[reference[1:len(reference)-1]]; found {
+			return value
+		}
+		return reference
+	})
+}
+
+// MergeSlashes replace the runs of slashes of the path by a single one
+func MergeSlashes(path string) string {
+	if !strings.Contains(path, "//") {
+		return path
+	}
+	var merged strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '/' && i > 0 && path[i-1] == '/' {
+			continue
+		}
+		merged.WriteByte(path[i])
+	}
+	return merged.String()
+}
+
+/*
+SafeDecode decode the percent-encoded bytes of an escaped path, except the
+ones changing its structure once decoded: %2F, %5C and %25 stay encoded (in
+upper case) so the path is never decoded twice. Encoded control characters,
+invalid UTF-8 and . or .. segments, encoded or not, are rejected.
+*/
+func SafeDecode(escaped string) (string, error) {
+	var decoded strings.Builder
+	for i := 0; i < len(escaped); i++ {
+		c := escaped[i]
+		if c != '%' {
+			if isControl(c) {
+				return "", errors.New("control character in path")
+			}
+			decoded.WriteByte(c)
+			continue
+		}
+		if i+2 >= len(escaped) || !isHex(escaped[i+1]) || !isHex(escaped[i+2]) {
+			return "", errors.New("invalid percent-encoding in path")
+		}
+		b := unhex(escaped[i+1])<<4 | unhex(escaped[i+2])
+		switch {
+		case b == '/' || b == '\\' || b == '%':
+			decoded.WriteString(strings.ToUpper(escaped[i : i+3]))
+		case isControl(b):
+			return "", errors.New("control character in path")
+		default:
+			decoded.WriteByte(b)
+		}
+		i += 2
+	}
+
+	path := decoded.String()
+	if !utf8.ValidString(path) {
+		return "", errors.New("invalid UTF-8 in path")
+	}
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "." || segment == ".." {
+			return "", errors.New("dot segment in path")
+		}
+	}
+	return path, nil
+}
+
+// EscapePath escape a path decoded by SafeDecode, the bytes left encoded are
+// kept as is
+func EscapePath(path string) string {
+	var escaped strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if c == '%' || isPathByte(c) {
+			escaped.WriteByte(c)
+			continue
+		}
+		escaped.WriteString(fmt.Sprintf("%%%02X", c))
+	}
+	return escaped.String()
+}
+
+// Unreserved characters, sub-delims, : @ and /
+func isPathByte(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return strings.IndexByte("-._~!$&'()*+,;=:@/", c) >= 0
+}
+
+func isControl(c byte) bool {
+	return c < 0x20 || c == 0x7f
+}
+
+func isHex(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
@@ -0,0 +1,56 @@
+package tlsutils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"test/portal/domain"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// BuildClientConfig create the client TLS configuration used to reach a backend
+func BuildClientConfig(settings domain.RouteBackendTLS) (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         settings.ServerName,
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: settings.InsecureSkipVerify,
+	}
+
+	if settings.MinVersion != "" {
+		version, found := tlsVersions[settings.MinVersion]
+		if !found {
+			return nil, fmt.Errorf("unsupported TLS version %s", settings.MinVersion)
+		}
+		config.MinVersion = version
+	}
+
+	if settings.CAFile != "" {
+		bundle, err := os.ReadFile(settings.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(bundle) {
+			return nil, errors.New("no certificate found in CA bundle " + settings.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if settings.ClientCertFile != "" {
+		certificate, err := tls.LoadX509KeyPair(settings.ClientCertFile, settings.ClientKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+
+	return config, nil
+}
@@ -2,6 +2,8 @@ package validations
 
 import (
 	"regexp"
+	"test/portal/pkg/iputils"
+	"test/portal/pkg/pathutils"
 
 	"github.com/go-playground/validator/v10"
 )
@@ -14,14 +16,12 @@ func IsValidName(fl validator.FieldLevel) bool {
 
 /*
 Validation for path that must start with /
-no trailing slash
-segments contain only letters, digits, underscores, or dashes
-no empty segments (i.e., no //)
+segments contain only letters, digits, underscores, or dashes, or are a
+{name} parameter. The last segment may be a * wildcard
 */
-
 func IsValidPath(fl validator.FieldLevel) bool {
-	pathRegex := regexp.MustCompile(`^\/[a-zA-Z0-9\-\/_]*$`)
-	return pathRegex.MatchString(fl.Field().String())
+	_, err := pathutils.Parse(fl.Field().String())
+	return err == nil
 }
 
 /*
@@ -35,8 +35,13 @@ RFC 1123-compliant regex (without lookaheads)
 (...)+         → final label without a trailing dot
 */
 func IsValidHostName(fl validator.FieldLevel) bool {
+	return IsHostName(fl.Field().String())
+}
+
+// IsHostName apply the IsValidHostName rules to a value outside of a struct
+func IsHostName(host string) bool {
 	hostRegex := regexp.MustCompile(`(?i)^([a-z0-9]([a-z0-9\-]{0,61}[a-z0-9])?\.)*([a-z0-9]([a-z0-9\-]{0,61}[a-z0-9])?)$`)
-	return hostRegex.MatchString(fl.Field().String())
+	return hostRegex.MatchString(host)
 }
 
 // Regular expression to match:
@@ -49,3 +54,23 @@ func IsValidBackendUrl(fl validator.FieldLevel) bool {
 	re := regexp.MustCompile(backendURLRegex)
 	return re.MatchString(fl.Field().String())
 }
+
+// Validation for an IP range in CIDR notation (10.8.0.0/16, fd00::/8)
+// a bare IP address is accepted as a single host range
+func IsValidCIDR(fl validator.FieldLevel) bool {
+	_, err := iputils.ParsePrefix(fl.Field().String())
+	return err == nil
+}
+
+// Validation for an HTTP header field name (RFC 9110 token)
+func IsValidHeaderName(fl validator.FieldLevel) bool {
+	headerRegex := regexp.MustCompile("^[a-zA-Z0-9!#$%&'*+\\-.^_`|~]+$")
+	return headerRegex.MatchString(fl.Field().String())
+}
+
+// Validation for a TLS server name, a host name optionally starting with *.
+// to match one level of subdomain
+func IsValidSNIHost(fl validator.FieldLevel) bool {
+	hostRegex := regexp.MustCompile(`(?i)^(\*\.)?([a-z0-9]([a-z0-9\-]{0,61}[a-z0-9])?\.)*([a-z0-9]([a-z0-9\-]{0,61}[a-z0-9])?)$`)
+	return hostRegex.MatchString(fl.Field().String())
+}
@@ -1,40 +1,58 @@
 package yamlutils
 
 import (
-	"log"
+	"log/slog"
 	"os"
+	"path/filepath"
 
 	"gopkg.in/yaml.v3"
 )
 
-func LoadYamlData[T any](path string, data T) error {
+// LoadYamlData return the size of the file read, a missing file is empty
+func LoadYamlData[T any](path string, data T) (int, error) {
 	file, err := os.ReadFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil
+			return 0, nil
 		}
-		return err
+		return 0, err
 	}
 	err = yaml.Unmarshal(file, data)
 
 	if err != nil {
-		log.Println(err)
-		return err
+		slog.Error("Failed parse yaml data", "path", path, "error", err)
+		return len(file), err
 	}
 
-	return nil
+	return len(file), nil
 }
 
-func SaveYamlData[T any](path string, data []T) error {
+// SaveYamlData return the size of the file written. The data is written aside
+// then renamed over the file, a concurrent load never read it half written
+func SaveYamlData[T any](path string, data []T) (int, error) {
 	yamlData, err := yaml.Marshal(data)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	log.Println("Writing data", data)
-	log.Println("Path", path)
-	err = os.WriteFile(path, yamlData, 0644)
+	// Only the size is logged, the payload may carry sensitive settings
+	slog.Debug("Writing yaml data", "path", path, "items", len(data), "bytes", len(yamlData))
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
 	if err != nil {
-		return err
+		return 0, err
 	}
-	return nil
+	defer os.Remove(file.Name())
+	_, err = file.Write(yamlData)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(file.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(yamlData), nil
 }
@@ -0,0 +1,179 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"test/portal/domain"
+	"test/portal/internal/proxy"
+	"test/portal/internal/proxy/accesslog"
+	"test/portal/internal/route/repository/yaml"
+	"test/portal/internal/route/usecase"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type AccessLogTestSuite struct {
+	suite.Suite
+	repo    domain.RouteItemRepository
+	usecase domain.RouteItemUsecase
+	ctx     context.Context
+	backend *httptest.Server
+	output  *bytes.Buffer
+}
+
+func (suite *AccessLogTestSuite) SetupTest() {
+	// Clean or recreate yaml file
+	os.Remove("./.data/routes.yaml")
+	file, err := os.Create("./.data/routes.yaml")
+	if err != nil {
+		log.Fatal("Failed to create test yaml file:", err)
+	}
+	file.Close()
+
+	suite.repo = yaml.NewRouteYamlRepository()
+	suite.usecase = usecase.NewRouteUsecase(suite.repo)
+	suite.ctx = context.Background()
+	suite.output = &bytes.Buffer{}
+
+	suite.backend = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	}))
+}
+
+func (suite *AccessLogTestSuite) TearDownTest() {
+	suite.backend.Close()
+}
+
+func (suite *AccessLogTestSuite) createRoute(name string, path string, accessLog *domain.RouteAccessLog) {
+	isEnabled := true
+	_, err := suite.repo.Create(suite.ctx, domain.RouteItem{
+		Name:      name,
+		Host:      "orders.example.com",
+		Path:      path,
+		Backend:   suite.backend.URL,
+		Enabled:   &isEnabled,
+		AccessLog: accessLog,
+	})
+	assert.NoError(suite.T(), err)
+}
+
+func (suite *AccessLogTestSuite) get(format accesslog.Format, random float64, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path+"?token=secret", nil)
+	req.Host = "orders.example.com"
+	req.RemoteAddr = "192.0.2.10:4000"
+	req.Header.Set("X-Request-ID", "req-42")
+	req.Header.Set("User-Agent", "curl/8.0")
+	req.Header.Set("Referer", "https://shop.example.com/")
+	response := httptest.NewRecorder()
+	proxy.NewProxy(suite.usecase, proxy.Config{
+		AccessLog: accesslog.New(suite.output, format, func() float64 { return random }),
+	}).ServeHTTP(response, req)
+	return response
+}
+
+func (suite *AccessLogTestSuite) TestJSONFormat() {
+	suite.createRoute("orders-route", "/orders", &domain.RouteAccessLog{Enabled: true})
+
+	response := suite.get(accesslog.FormatJSON, 0, "/orders/42")
+	assert.Equal(suite.T(), http.StatusCreated, response.Code)
+
+	var line map[string]interface{}
+	assert.NoError(suite.T(), json.Unmarshal(suite.output.Bytes(), &line))
+	assert.Equal(suite.T(), "orders-route", line["route"])
+	assert.Equal(suite.T(), "orders.example.com", line["host"])
+	assert.Equal(suite.T(), "/orders/42", line["path"])
+	assert.Equal(suite.T(), "192.0.2.10", line["clientIp"])
+	assert.Equal(suite.T(), float64(http.StatusCreated), line["status"])
+	assert.Equal(suite.T(), float64(len("created")), line["bytes"])
+	assert.Equal(suite.T(), suite.backend.URL, line["upstream"])
+	assert.Equal(suite.T(), "req-42", line["requestId"])
+	assert.Contains(suite.T(), line, "latencyMs")
+	assert.NotContains(suite.T(), suite.output.String(), "secret")
+}
+
+func (suite *AccessLogTestSuite) TestCommonAndCombinedFormat() {
+	suite.createRoute("orders-route", "/orders", &domain.RouteAccessLog{Enabled: true})
+
+	suite.get(accesslog.FormatCommon, 0, "/orders")
+	line := suite.output.String()
+	assert.True(suite.T(), strings.HasPrefix(line, "192.0.2.10 - - ["))
+	assert.Contains(suite.T(), line, `] "GET /orders HTTP/1.1" 201 7 route="orders-route" host="orders.example.com" upstream="`+suite.backend.URL+`" request_id="req-42" latency_ms=`)
+	assert.NotContains(suite.T(), line, "curl/8.0")
+	assert.True(suite.T(), strings.HasSuffix(line, "\n"))
+
+	suite.output.Reset()
+	suite.get(accesslog.FormatCombined, 0, "/orders")
+	assert.Contains(suite.T(), suite.output.String(), `" 201 7 "https://shop.example.com/" "curl/8.0" route="orders-route"`)
+}
+
+func (suite *AccessLogTestSuite) TestRejectedRequestIsLogged() {
+	suite.createRoute("orders-route", "/orders", &domain.RouteAccessLog{Enabled: true})
+	route, _ := suite.repo.GetOne(suite.ctx, "orders-route")
+	route.DenyCIDRs = []string{"192.0.2.0/24"}
+	_, err := suite.repo.Update(suite.ctx, *route)
+	assert.NoError(suite.T(), err)
+
+	suite.get(accesslog.FormatJSON, 0, "/orders")
+	var line map[string]interface{}
+	assert.NoError(suite.T(), json.Unmarshal(suite.output.Bytes(), &line))
+	assert.Equal(suite.T(), float64(http.StatusForbidden), line["status"])
+	assert.NotContains(suite.T(), line, "upstream")
+}
+
+func (suite *AccessLogTestSuite) TestEnableAndSampling() {
+	suite.createRoute("silent-route", "/silent", nil)
+	suite.createRoute("disabled-route", "/disabled", &domain.RouteAccessLog{Enabled: false})
+	suite.createRoute("sampled-route", "/sampled", &domain.RouteAccessLog{Enabled: true, SampleRate: 0.25})
+
+	suite.get(accesslog.FormatJSON, 0, "/silent")
+	suite.get(accesslog.FormatJSON, 0, "/disabled")
+	suite.get(accesslog.FormatJSON, 0.5, "/sampled")
+	assert.Empty(suite.T(), suite.output.String())
+
+	suite.get(accesslog.FormatJSON, 0.1, "/sampled")
+	assert.Equal(suite.T(), 1, strings.Count(suite.output.String(), "\n"))
+	assert.Contains(suite.T(), suite.output.String(), `"route":"sampled-route"`)
+}
+
+func (suite *AccessLogTestSuite) TestInvalidSampleRate() {
+	assert.Error(suite.T(), newTestValidator().Struct(domain.RouteAccessLog{Enabled: true, SampleRate: 1.5}))
+	assert.NoError(suite.T(), newTestValidator().Struct(domain.RouteAccessLog{Enabled: true, SampleRate: 0.5}))
+
+	_, err := accesslog.ParseFormat("xml")
+	assert.Error(suite.T(), err)
+}
+
+func (suite *AccessLogTestSuite) TestFileRotation() {
+	path := filepath.Join(suite.T().TempDir(), "access.log")
+	file, err := accesslog.OpenFile(path, 20, 2)
+	assert.NoError(suite.T(), err)
+	defer file.Close()
+
+	for _, line := range []string{"first line 0001\n", "second line 002\n", "third line 0003\n", "fourth line 004\n"} {
+		_, err := file.Write([]byte(line))
+		assert.NoError(suite.T(), err)
+	}
+
+	current, _ := os.ReadFile(path)
+	backup, _ := os.ReadFile(path + ".1")
+	oldest, _ := os.ReadFile(path + ".2")
+	assert.Equal(suite.T(), "fourth line 004\n", string(current))
+	assert.Equal(suite.T(), "third line 0003\n", string(backup))
+	assert.Equal(suite.T(), "second line 002\n", string(oldest))
+	_, err = os.Stat(path + ".3")
+	assert.True(suite.T(), os.IsNotExist(err))
+}
+
+func TestAccessLogTestSuite(t *testing.T) {
+	suite.Run(t, new(AccessLogTestSuite))
+}
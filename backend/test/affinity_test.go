@@ -0,0 +1,260 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"test/portal/domain"
+	"test/portal/internal/proxy"
+	"test/portal/internal/route/repository/yaml"
+	"test/portal/internal/route/usecase"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type AffinityTestSuite struct {
+	suite.Suite
+	repo     domain.RouteItemRepository
+	usecase  domain.RouteItemUsecase
+	ctx      context.Context
+	backends []*httptest.Server
+	proxy    *proxy.Proxy
+}
+
+func (suite *AffinityTestSuite) SetupTest() {
+	// Clean or recreate yaml file
+	os.Remove("./.data/routes.yaml")
+	file, err := os.Create("./.data/routes.yaml")
+	if err != nil {
+		log.Fatal("Failed to create test yaml file:", err)
+	}
+	file.Close()
+
+	suite.repo = yaml.NewRouteYamlRepository()
+	suite.usecase = usecase.NewRouteUsecase(suite.repo)
+	suite.ctx = context.Background()
+	suite.proxy = proxy.NewProxy(suite.usecase, proxy.Config{})
+
+	// Each backend answer with its own name
+	suite.backends = make([]*httptest.Server, 0)
+	for i := 0; i < 3; i++ {
+		name := fmt.Sprintf("backend-%d", i)
+		suite.backends = append(suite.backends, httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		})))
+	}
+}
+
+func (suite *AffinityTestSuite) TearDownTest() {
+	for _, backend := range suite.backends {
+		backend.Close()
+	}
+}
+
+func (suite *AffinityTestSuite) createRoute(affinity *domain.RouteAffinity) {
+	suite.createRouteWithPath("/app", affinity)
+}
+
+func (suite *AffinityTestSuite) createRouteWithPath(path string, affinity *domain.RouteAffinity) {
+	backends := make([]domain.RouteBackend, 0)
+	for _, backend := range suite.backends {
+		backends = append(backends, domain.RouteBackend{URL: backend.URL})
+	}
+	isEnabled := true
+	_, err := suite.repo.Create(suite.ctx, domain.RouteItem{
+		Name:     "legacy-route",
+		Host:     "legacy.example.com",
+		Path:     path,
+		Backends: backends,
+		Enabled:  &isEnabled,
+		Affinity: affinity,
+	})
+	assert.NoError(suite.T(), err)
+}
+
+func (suite *AffinityTestSuite) get(cookies []*http.Cookie, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/app/session", nil)
+	req.Host = "legacy.example.com"
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	response := httptest.NewRecorder()
+	suite.proxy.ServeHTTP(response, req)
+	return response
+}
+
+func (suite *AffinityTestSuite) TestRoundRobinWithoutAffinity() {
+	suite.createRoute(nil)
+
+	seen := map[string]int{}
+	for i := 0; i < 6; i++ {
+		response := suite.get(nil, nil)
+		assert.Equal(suite.T(), http.StatusOK, response.Code)
+		assert.Empty(suite.T(), response.Header().Get("Set-Cookie"))
+		seen[response.Body.String()]++
+	}
+	assert.Equal(suite.T(), map[string]int{"backend-0": 2, "backend-1": 2, "backend-2": 2}, seen)
+}
+
+func (suite *AffinityTestSuite) TestCookieAffinity() {
+	suite.createRoute(&domain.RouteAffinity{
+		Mode:             "cookie",
+		CookieName:       "legacy_sticky",
+		CookieTTLSeconds: 3600,
+		CookieSecure:     true,
+		CookieHTTPOnly:   true,
+		CookieSameSite:   "lax",
+	})
+
+	first := suite.get(nil, nil)
+	cookies := first.Result().Cookies()
+	if !assert.Len(suite.T(), cookies, 1) {
+		return
+	}
+	cookie := cookies[0]
+	assert.Equal(suite.T(), "legacy_sticky", cookie.Name)
+	assert.Equal(suite.T(), "/app", cookie.Path)
+	assert.Equal(suite.T(), 3600, cookie.MaxAge)
+	assert.True(suite.T(), cookie.Secure)
+	assert.True(suite.T(), cookie.HttpOnly)
+	assert.Equal(suite.T(), http.SameSiteLaxMode, cookie.SameSite)
+
+	// Pinned client keep hitting the same backend without a new cookie
+	for i := 0; i < 5; i++ {
+		response := suite.get([]*http.Cookie{cookie}, nil)
+		assert.Equal(suite.T(), first.Body.String(), response.Body.String())
+		assert.Empty(suite.T(), response.Header().Get("Set-Cookie"))
+	}
+}
+
+func (suite *AffinityTestSuite) TestCookieAffinityTemplatedPath() {
+	suite.createRouteWithPath("/app/{tenant}/*", &domain.RouteAffinity{Mode: "cookie"})
+
+	// The cookie path stop before the parameter so browsers send it back
+	first := suite.get(nil, nil)
+	cookies := first.Result().Cookies()
+	if !assert.Len(suite.T(), cookies, 1) {
+		return
+	}
+	assert.Equal(suite.T(), "/app", cookies[0].Path)
+	for i := 0; i < 3; i++ {
+		assert.Equal(suite.T(), first.Body.String(), suite.get(cookies, nil).Body.String())
+	}
+}
+
+func (suite *AffinityTestSuite) TestCookieAffinityFallbackWhenBackendDown() {
+	suite.createRoute(&domain.RouteAffinity{Mode: "cookie"})
+
+	first := suite.get(nil, nil)
+	cookie := first.Result().Cookies()[0]
+	for i, backend := range suite.backends {
+		if first.Body.String() == fmt.Sprintf("backend-%d", i) {
+			backend.Close()
+		}
+	}
+
+	// The request is retried on a healthy backend and the client re-pinned
+	response := suite.get([]*http.Cookie{cookie}, nil)
+	assert.Equal(suite.T(), http.StatusOK, response.Code)
+	assert.NotEqual(suite.T(), first.Body.String(), response.Body.String())
+	cookies := response.Result().Cookies()
+	if !assert.NotEmpty(suite.T(), cookies) {
+		return
+	}
+	newCookie := cookies[len(cookies)-1]
+	assert.NotEqual(suite.T(), cookie.Value, newCookie.Value)
+
+	for i := 0; i < 3; i++ {
+		pinned := suite.get([]*http.Cookie{newCookie}, nil)
+		assert.Equal(suite.T(), response.Body.String(), pinned.Body.String())
+	}
+}
+
+func (suite *AffinityTestSuite) TestHeaderAffinity() {
+	suite.createRoute(&domain.RouteAffinity{Mode: "header", HeaderName: "X-Session-ID"})
+
+	for _, session := range []string{"alice", "bob", "carol", "dave"} {
+		first := suite.get(nil, map[string]string{"X-Session-ID": session})
+		for i := 0; i < 3; i++ {
+			response := suite.get(nil, map[string]string{"X-Session-ID": session})
+			assert.Equal(suite.T(), first.Body.String(), response.Body.String())
+		}
+	}
+}
+
+func (suite *AffinityTestSuite) TestHeaderAffinityFallbackWhenBackendDown() {
+	suite.createRoute(&domain.RouteAffinity{Mode: "header", HeaderName: "X-Session-ID"})
+
+	first := suite.get(nil, map[string]string{"X-Session-ID": "alice"})
+	for i, backend := range suite.backends {
+		if first.Body.String() == fmt.Sprintf("backend-%d", i) {
+			backend.Close()
+		}
+	}
+
+	response := suite.get(nil, map[string]string{"X-Session-ID": "alice"})
+	assert.Equal(suite.T(), http.StatusOK, response.Code)
+	assert.NotEqual(suite.T(), first.Body.String(), response.Body.String())
+	assert.Equal(suite.T(), response.Body.String(), suite.get(nil, map[string]string{"X-Session-ID": "alice"}).Body.String())
+}
+
+func (suite *AffinityTestSuite) TestValidation() {
+	validate := newTestValidator()
+	isEnabled := true
+	route := domain.RouteItem{
+		Name:     "legacy-route",
+		Host:     "legacy.example.com",
+		Path:     "/app",
+		Backend:  "http://localhost:8080",
+		Backends: []domain.RouteBackend{{URL: "http://localhost:8081"}},
+		Enabled:  &isEnabled,
+	}
+	// Backend and Backends are exclusive
+	assert.Error(suite.T(), validate.Struct(route))
+
+	route.Backend = ""
+	assert.NoError(suite.T(), validate.Struct(route))
+
+	route.Affinity = &domain.RouteAffinity{Mode: "header"}
+	assert.Error(suite.T(), validate.Struct(route))
+
+	route.Affinity = &domain.RouteAffinity{Mode: "ip"}
+	assert.Error(suite.T(), validate.Struct(route))
+}
+
+func (suite *AffinityTestSuite) TestDuplicateBackends() {
+	isEnabled := true
+	route := domain.RouteItem{
+		Name: "legacy-route",
+		Host: "legacy.example.com",
+		Path: "/app",
+		Backends: []domain.RouteBackend{
+			{URL: suite.backends[0].URL},
+			{URL: suite.backends[1].URL},
+			{URL: suite.backends[0].URL},
+		},
+		Enabled: &isEnabled,
+	}
+	_, err := suite.usecase.Create(suite.ctx, route)
+	assert.ErrorContains(suite.T(), err, "Duplicate backend "+suite.backends[0].URL)
+
+	route.Backends = route.Backends[:2]
+	_, err = suite.usecase.Create(suite.ctx, route)
+	assert.NoError(suite.T(), err)
+
+	route.Backends = append(route.Backends, domain.RouteBackend{URL: suite.backends[1].URL})
+	_, err = suite.usecase.Update(suite.ctx, route)
+	assert.ErrorContains(suite.T(), err, "Duplicate backend "+suite.backends[1].URL)
+}
+
+func TestAffinityTestSuite(t *testing.T) {
+	suite.Run(t, new(AffinityTestSuite))
+}
@@ -0,0 +1,122 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"test/portal/domain"
+	routedelivery "test/portal/internal/route/delivery/http"
+	routemetrics "test/portal/internal/route/metrics"
+	"test/portal/internal/route/repository/yaml"
+	"test/portal/internal/route/usecase"
+	"test/portal/pkg/httputils"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type APIMetricsTestSuite struct {
+	suite.Suite
+	ctx      context.Context
+	registry *prometheus.Registry
+	metrics  *routemetrics.Metrics
+	delivery *routedelivery.RouteDelivery
+}
+
+func (suite *APIMetricsTestSuite) SetupTest() {
+	// Clean or recreate yaml file
+	os.Remove("./.data/routes.yaml")
+	file, err := os.Create("./.data/routes.yaml")
+	if err != nil {
+		log.Fatal("Failed to create test yaml file:", err)
+	}
+	file.Close()
+
+	suite.ctx = context.Background()
+	suite.registry = prometheus.NewRegistry()
+	suite.metrics = routemetrics.New(suite.registry)
+	repo := yaml.NewInstrumentedRouteYamlRepository(suite.metrics)
+	suite.delivery = routedelivery.NewTestRouteDelivery(suite.ctx, newTestValidator(), usecase.NewRouteUsecase(repo))
+}
+
+func (suite *APIMetricsTestSuite) request(method string, path string, payload any, operation string, handler func(context.Context, http.ResponseWriter, *http.Request)) int {
+	config := httputils.HTTPTestConfig{
+		Method: method,
+		Path:   path,
+		HandlerFunc: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			suite.metrics.Instrument(operation, handler)(suite.ctx, w, r)
+		}),
+	}
+	if payload != nil {
+		body, err := json.Marshal(payload)
+		assert.NoError(suite.T(), err)
+		config.Payload = bytes.NewBuffer(body)
+	}
+	return httputils.HTTPTestRequest(suite.T(), config).Code
+}
+
+func (suite *APIMetricsTestSuite) value(name string, labels map[string]string) float64 {
+	metric := gatherMetric(suite.T(), suite.registry, name, labels)
+	if metric.GetHistogram() != nil {
+		return float64(metric.GetHistogram().GetSampleCount())
+	}
+	return metric.GetCounter().GetValue()
+}
+
+func (suite *APIMetricsTestSuite) TestHandlerMetrics() {
+	isEnabled := true
+	route := domain.RouteItem{
+		Name:    "orders-route",
+		Host:    "orders.example.com",
+		Path:    "/orders",
+		Backend: "http://orders.internal",
+		Enabled: &isEnabled,
+	}
+	assert.Equal(suite.T(), http.StatusOK, suite.request(http.MethodPost, "/routes", route, "Create", suite.delivery.Create))
+	assert.Equal(suite.T(), http.StatusBadRequest, suite.request(http.MethodPost, "/routes", domain.RouteItem{Name: "x"}, "Create", suite.delivery.Create))
+	assert.Equal(suite.T(), http.StatusOK, suite.request(http.MethodGet, "/routes", nil, "GetAll", suite.delivery.GetAll))
+	assert.Equal(suite.T(), http.StatusOK, suite.request(http.MethodDelete, "/routes/orders-route", nil, "Delete", suite.delivery.Delete))
+
+	assert.Equal(suite.T(), 1.0, suite.value("portal_api_requests_total", map[string]string{"operation": "Create", "status_class": "2xx"}))
+	assert.Equal(suite.T(), 1.0, suite.value("portal_api_requests_total", map[string]string{"operation": "Create", "status_class": "4xx"}))
+	assert.Equal(suite.T(), 1.0, suite.value("portal_api_errors_total", map[string]string{"operation": "Create"}))
+	assert.Equal(suite.T(), 2.0, suite.value("portal_api_request_duration_seconds", map[string]string{"operation": "Create"}))
+	assert.Equal(suite.T(), 1.0, suite.value("portal_api_requests_total", map[string]string{"operation": "GetAll", "status_class": "2xx"}))
+	assert.Nil(suite.T(), gatherMetric(suite.T(), suite.registry, "portal_api_errors_total", map[string]string{"operation": "GetAll"}))
+}
+
+func (suite *APIMetricsTestSuite) TestRepositoryMetrics() {
+	isEnabled := true
+	repo := yaml.NewInstrumentedRouteYamlRepository(suite.metrics)
+	_, err := repo.Create(suite.ctx, domain.RouteItem{
+		Name:    "orders-route",
+		Host:    "orders.example.com",
+		Path:    "/orders",
+		Backend: "http://orders.internal",
+		Enabled: &isEnabled,
+	})
+	assert.NoError(suite.T(), err)
+	_, err = repo.GetOne(suite.ctx, "missing-route")
+	assert.Error(suite.T(), err)
+
+	assert.Equal(suite.T(), 1.0, suite.value("portal_repository_operations_total", map[string]string{"operation": "Create"}))
+	assert.Equal(suite.T(), 1.0, suite.value("portal_repository_errors_total", map[string]string{"operation": "GetOne"}))
+	assert.Nil(suite.T(), gatherMetric(suite.T(), suite.registry, "portal_repository_errors_total", map[string]string{"operation": "Create"}))
+
+	// Create read then write the file, GetOne read it
+	assert.Equal(suite.T(), 2.0, suite.value("portal_repository_file_duration_seconds", map[string]string{"io": "read"}))
+	assert.Equal(suite.T(), 1.0, suite.value("portal_repository_file_duration_seconds", map[string]string{"io": "write"}))
+	written := gatherMetric(suite.T(), suite.registry, "portal_repository_file_size_bytes", map[string]string{"io": "write"})
+	stat, err := os.Stat("./.data/routes.yaml")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), float64(stat.Size()), written.GetHistogram().GetSampleSum())
+}
+
+func TestAPIMetricsTestSuite(t *testing.T) {
+	suite.Run(t, new(APIMetricsTestSuite))
+}
@@ -0,0 +1,311 @@
+package test
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"test/portal/domain"
+	"test/portal/internal/proxy"
+	"test/portal/internal/proxy/cache"
+	routedelivery "test/portal/internal/route/delivery/http"
+	"test/portal/internal/route/repository/yaml"
+	"test/portal/internal/route/usecase"
+	"test/portal/pkg/httputils"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type CacheTestSuite struct {
+	suite.Suite
+	repo     domain.RouteItemRepository
+	usecase  domain.RouteItemUsecase
+	ctx      context.Context
+	backend  *httptest.Server
+	hits     atomic.Int64
+	now      time.Time
+	cache    *cache.Cache
+	proxy    *proxy.Proxy
+	policy   *domain.RouteCachePolicy
+	revision string
+}
+
+func (suite *CacheTestSuite) SetupTest() {
+	// Clean or recreate yaml file
+	os.Remove("./.data/routes.yaml")
+	file, err := os.Create("./.data/routes.yaml")
+	if err != nil {
+		log.Fatal("Failed to create test yaml file:", err)
+	}
+	file.Close()
+
+	suite.repo = yaml.NewRouteYamlRepository()
+	suite.usecase = usecase.NewRouteUsecase(suite.repo)
+	suite.ctx = context.Background()
+	suite.hits.Store(0)
+	suite.revision = "v1"
+	suite.now = time.Date(2025, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	suite.backend = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit := suite.hits.Add(1)
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/etag"):
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("ETag", `"`+suite.revision+`"`)
+			if r.Header.Get("If-None-Match") == `"`+suite.revision+`"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		case strings.HasPrefix(r.URL.Path, "/private"):
+			w.Header().Set("Cache-Control", "private, max-age=60")
+		case strings.HasPrefix(r.URL.Path, "/large"):
+			w.Write([]byte(strings.Repeat("x", 2048)))
+			return
+		case strings.HasPrefix(r.URL.Path, "/chunked"), strings.HasPrefix(r.URL.Path, "/events"):
+			// Flushed parts without Content-Length, sent chunked
+			w.Header().Set("Cache-Control", "max-age=60")
+			if strings.HasPrefix(r.URL.Path, "/events") {
+				w.Header().Set("Content-Type", "text/event-stream")
+			}
+			for _, part := range []string{"part-1,", "part-2,", fmt.Sprintf("%d", hit)} {
+				w.Write([]byte(part))
+				w.(http.Flusher).Flush()
+			}
+			return
+		case strings.HasPrefix(r.URL.Path, "/gzip"):
+			// Compressed when asked, without Vary
+			w.Header().Set("Cache-Control", "max-age=60")
+			if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+				w.Write([]byte("plain"))
+				return
+			}
+			w.Header().Set("Content-Encoding", "gzip")
+			writer := gzip.NewWriter(w)
+			writer.Write([]byte("plain"))
+			writer.Close()
+			return
+		case strings.HasPrefix(r.URL.Path, "/vary"):
+			w.Header().Set("Vary", "Accept-Language")
+			w.Write([]byte(r.Header.Get("Accept-Language")))
+			return
+		default:
+			w.Header().Set("Cache-Control", "max-age=60")
+		}
+		w.Write([]byte(fmt.Sprintf("%s-%d", suite.revision, hit)))
+	}))
+
+	suite.cache = cache.New(cache.NewMemoryStore(1<<20), func() time.Time { return suite.now })
+	suite.proxy = proxy.NewProxy(suite.usecase, proxy.Config{Cache: suite.cache})
+	suite.policy = &domain.RouteCachePolicy{
+		Enabled:             true,
+		DefaultTTLSeconds:   10,
+		RespectCacheControl: true,
+		VaryHeaders:         []string{"Accept-Language"},
+		MaxObjectSizeBytes:  1024,
+	}
+}
+
+func (suite *CacheTestSuite) TearDownTest() {
+	suite.backend.Close()
+}
+
+func (suite *CacheTestSuite) createRoute(name string, path string) {
+	isEnabled := true
+	_, err := suite.repo.Create(suite.ctx, domain.RouteItem{
+		Name:    name,
+		Host:    "cache.example.com",
+		Path:    path,
+		Backend: suite.backend.URL,
+		Enabled: &isEnabled,
+		Cache:   suite.policy,
+	})
+	assert.NoError(suite.T(), err)
+}
+
+func (suite *CacheTestSuite) get(path string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Host = "cache.example.com"
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	response := httptest.NewRecorder()
+	suite.proxy.ServeHTTP(response, req)
+	return response
+}
+
+func (suite *CacheTestSuite) TestServeFromCache() {
+	suite.createRoute("cache-route", "/")
+
+	first := suite.get("/items", nil)
+	assert.Equal(suite.T(), http.StatusOK, first.Code)
+	assert.Equal(suite.T(), "MISS", first.Header().Get("X-Cache"))
+	assert.Equal(suite.T(), "v1-1", first.Body.String())
+
+	suite.now = suite.now.Add(30 * time.Second)
+	second := suite.get("/items", nil)
+	assert.Equal(suite.T(), "HIT", second.Header().Get("X-Cache"))
+	assert.Equal(suite.T(), "v1-1", second.Body.String())
+	assert.Equal(suite.T(), "30", second.Header().Get("Age"))
+	assert.Equal(suite.T(), int64(1), suite.hits.Load())
+
+	// Backend max-age is over
+	suite.now = suite.now.Add(31 * time.Second)
+	third := suite.get("/items", nil)
+	assert.Equal(suite.T(), "MISS", third.Header().Get("X-Cache"))
+	assert.Equal(suite.T(), "v1-2", third.Body.String())
+}
+
+func (suite *CacheTestSuite) TestChunkedResponse() {
+	suite.createRoute("cache-route", "/")
+
+	first := suite.get("/chunked", nil)
+	assert.Equal(suite.T(), "MISS", first.Header().Get("X-Cache"))
+	assert.Equal(suite.T(), "part-1,part-2,1", first.Body.String())
+
+	second := suite.get("/chunked", nil)
+	assert.Equal(suite.T(), "HIT", second.Header().Get("X-Cache"))
+	assert.Equal(suite.T(), "part-1,part-2,1", second.Body.String())
+
+	// Event streams are passed through and never stored
+	assert.Equal(suite.T(), "part-1,part-2,2", suite.get("/events", nil).Body.String())
+	third := suite.get("/events", nil)
+	assert.Equal(suite.T(), "MISS", third.Header().Get("X-Cache"))
+	assert.Equal(suite.T(), "part-1,part-2,3", third.Body.String())
+}
+
+func (suite *CacheTestSuite) TestBackendCompressingWithoutVary() {
+	suite.createRoute("gzip-route", "/gzip")
+
+	first := suite.get("/gzip", map[string]string{"Accept-Encoding": "gzip"})
+	assert.Equal(suite.T(), "MISS", first.Header().Get("X-Cache"))
+	assert.Empty(suite.T(), first.Header().Get("Content-Encoding"))
+	assert.Equal(suite.T(), "plain", first.Body.String())
+
+	// Stored decoded, served to the clients not accepting gzip
+	second := suite.get("/gzip", nil)
+	assert.Equal(suite.T(), "HIT", second.Header().Get("X-Cache"))
+	assert.Empty(suite.T(), second.Header().Get("Content-Encoding"))
+	assert.Equal(suite.T(), "plain", second.Body.String())
+}
+
+func (suite *CacheTestSuite) TestUpgradeBypass() {
+	suite.createRoute("default-route", "/")
+
+	response := suite.get("/socket", map[string]string{"Connection": "Upgrade", "Upgrade": "websocket"})
+	assert.Equal(suite.T(), "BYPASS", response.Header().Get("X-Cache"))
+	response = suite.get("/socket", map[string]string{"Upgrade": "websocket"})
+	assert.Equal(suite.T(), "BYPASS", response.Header().Get("X-Cache"))
+}
+
+func (suite *CacheTestSuite) TestDefaultTTLWithoutCacheControl() {
+	suite.policy.RespectCacheControl = false
+	suite.createRoute("cache-route", "/")
+
+	suite.get("/private", nil)
+	assert.Equal(suite.T(), "HIT", suite.get("/private", nil).Header().Get("X-Cache"))
+
+	suite.now = suite.now.Add(11 * time.Second)
+	assert.Equal(suite.T(), "MISS", suite.get("/private", nil).Header().Get("X-Cache"))
+	assert.Equal(suite.T(), int64(2), suite.hits.Load())
+}
+
+func (suite *CacheTestSuite) TestRevalidateWithETag() {
+	suite.createRoute("cache-route", "/")
+
+	first := suite.get("/etag", nil)
+	assert.Equal(suite.T(), "MISS", first.Header().Get("X-Cache"))
+	assert.Equal(suite.T(), "v1-1", first.Body.String())
+
+	// no-cache response is revalidated, the backend answer 304
+	second := suite.get("/etag", nil)
+	assert.Equal(suite.T(), http.StatusOK, second.Code)
+	assert.Equal(suite.T(), "REVALIDATED", second.Header().Get("X-Cache"))
+	assert.Equal(suite.T(), "v1-1", second.Body.String())
+
+	// Content changed on the backend
+	suite.revision = "v2"
+	third := suite.get("/etag", nil)
+	assert.Equal(suite.T(), "MISS", third.Header().Get("X-Cache"))
+	assert.Equal(suite.T(), "v2-3", third.Body.String())
+}
+
+func (suite *CacheTestSuite) TestClientConditionalRequest() {
+	suite.createRoute("cache-route", "/")
+	suite.get("/etag", nil)
+
+	response := suite.get("/etag", map[string]string{"If-None-Match": `"v1"`})
+	assert.Equal(suite.T(), http.StatusNotModified, response.Code)
+	assert.Empty(suite.T(), response.Body.String())
+}
+
+func (suite *CacheTestSuite) TestNotStoredResponses() {
+	suite.createRoute("cache-route", "/")
+
+	suite.get("/private", nil)
+	assert.Equal(suite.T(), "MISS", suite.get("/private", nil).Header().Get("X-Cache"))
+
+	large := suite.get("/large", nil)
+	assert.Equal(suite.T(), 2048, large.Body.Len())
+	assert.Equal(suite.T(), "MISS", suite.get("/large", nil).Header().Get("X-Cache"))
+
+	assert.Equal(suite.T(), "BYPASS", suite.get("/items", map[string]string{"Authorization": "Bearer token"}).Header().Get("X-Cache"))
+	assert.Equal(suite.T(), int64(5), suite.hits.Load())
+}
+
+func (suite *CacheTestSuite) TestVaryHeaders() {
+	suite.createRoute("cache-route", "/")
+
+	assert.Equal(suite.T(), "en", suite.get("/vary", map[string]string{"Accept-Language": "en"}).Body.String())
+	assert.Equal(suite.T(), "id", suite.get("/vary", map[string]string{"Accept-Language": "id"}).Body.String())
+
+	hit := suite.get("/vary", map[string]string{"Accept-Language": "en"})
+	assert.Equal(suite.T(), "HIT", hit.Header().Get("X-Cache"))
+	assert.Equal(suite.T(), "en", hit.Body.String())
+	assert.Equal(suite.T(), int64(2), suite.hits.Load())
+}
+
+func (suite *CacheTestSuite) TestPurgeByRouteAndPrefix() {
+	suite.createRoute("users-route", "/users")
+	suite.createRoute("orders-route", "/orders")
+	suite.get("/users/1", nil)
+	suite.get("/users/2", nil)
+	suite.get("/orders/1", nil)
+	delivery := routedelivery.NewTestRouteCacheDelivery(suite.ctx, suite.cache)
+
+	purge := func(path string) int {
+		response := httputils.HTTPTestRequest(suite.T(), httputils.HTTPTestConfig{
+			Method: http.MethodDelete,
+			Path:   path,
+			HandlerFunc: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				delivery.Purge(suite.ctx, w, r)
+			}),
+		})
+		assert.Equal(suite.T(), http.StatusOK, response.Code)
+
+		var responseBody struct {
+			Data domain.CachePurgeResult `json:"data"`
+		}
+		assert.NoError(suite.T(), json.Unmarshal(response.Body.Bytes(), &responseBody))
+		return responseBody.Data.Purged
+	}
+
+	assert.Equal(suite.T(), 1, purge("/cache/users-route?prefix=/users/1"))
+	assert.Equal(suite.T(), "HIT", suite.get("/users/2", nil).Header().Get("X-Cache"))
+	assert.Equal(suite.T(), "MISS", suite.get("/users/1", nil).Header().Get("X-Cache"))
+
+	assert.Equal(suite.T(), 1, purge("/cache/orders-route"))
+	assert.Equal(suite.T(), 2, purge("/cache/?prefix=/users"))
+}
+
+func TestCacheTestSuite(t *testing.T) {
+	suite.Run(t, new(CacheTestSuite))
+}
@@ -0,0 +1,194 @@
+package test
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"test/portal/domain"
+	"test/portal/internal/proxy"
+	"test/portal/internal/route/repository/yaml"
+	"test/portal/internal/route/usecase"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type CompressionTestSuite struct {
+	suite.Suite
+	repo    domain.RouteItemRepository
+	usecase domain.RouteItemUsecase
+	ctx     context.Context
+	backend *httptest.Server
+	payload string
+}
+
+func (suite *CompressionTestSuite) SetupTest() {
+	// Clean or recreate yaml file
+	os.Remove("./.data/routes.yaml")
+	file, err := os.Create("./.data/routes.yaml")
+	if err != nil {
+		log.Fatal("Failed to create test yaml file:", err)
+	}
+	file.Close()
+
+	suite.repo = yaml.NewRouteYamlRepository()
+	suite.usecase = usecase.NewRouteUsecase(suite.repo)
+	suite.ctx = context.Background()
+	suite.payload = `{"items":[` + strings.Repeat(`{"name":"route","enabled":true},`, 100) + `{}]}`
+
+	suite.backend = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/small":
+			w.Write([]byte(`{}`))
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte(suite.payload))
+		case "/encoded":
+			w.Header().Set("Content-Encoding", "gzip")
+			encoder := gzip.NewWriter(w)
+			encoder.Write([]byte(suite.payload))
+			encoder.Close()
+		case "/stream":
+			w.Header().Set("Content-Type", "text/event-stream")
+			for i := 0; i < 3; i++ {
+				w.Write([]byte("data: event\n\n"))
+				w.(http.Flusher).Flush()
+			}
+		default:
+			w.Header().Set("ETag", `"abc"`)
+			http.ServeContent(w, r, "items.json", time.Time{}, strings.NewReader(suite.payload))
+		}
+	}))
+
+	isEnabled := true
+	_, err = suite.repo.Create(suite.ctx, domain.RouteItem{
+		Name:    "compress-route",
+		Host:    "app.example.com",
+		Path:    "/",
+		Backend: suite.backend.URL,
+		Enabled: &isEnabled,
+		Compression: &domain.RouteCompressionPolicy{
+			Enabled:      true,
+			Algorithms:   []string{"br", "gzip"},
+			MinSizeBytes: 256,
+			ContentTypes: []string{"application/json", "text/*"},
+		},
+	})
+	assert.NoError(suite.T(), err)
+}
+
+func (suite *CompressionTestSuite) TearDownTest() {
+	suite.backend.Close()
+}
+
+func (suite *CompressionTestSuite) get(path string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Host = "app.example.com"
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	response := httptest.NewRecorder()
+	proxy.NewProxy(suite.usecase, proxy.Config{}).ServeHTTP(response, req)
+	return response
+}
+
+func (suite *CompressionTestSuite) TestGzip() {
+	response := suite.get("/items", map[string]string{"Accept-Encoding": "gzip"})
+
+	assert.Equal(suite.T(), http.StatusOK, response.Code)
+	assert.Equal(suite.T(), "gzip", response.Header().Get("Content-Encoding"))
+	assert.Equal(suite.T(), "Accept-Encoding", response.Header().Get("Vary"))
+	assert.Empty(suite.T(), response.Header().Get("Content-Length"))
+	assert.Empty(suite.T(), response.Header().Get("Accept-Ranges"))
+	assert.Equal(suite.T(), `W/"abc"`, response.Header().Get("ETag"))
+
+	reader, err := gzip.NewReader(response.Body)
+	assert.NoError(suite.T(), err)
+	body, err := io.ReadAll(reader)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), suite.payload, string(body))
+}
+
+func (suite *CompressionTestSuite) TestBrotliPreferredByQuality() {
+	response := suite.get("/items", map[string]string{"Accept-Encoding": "gzip;q=0.5, br"})
+
+	assert.Equal(suite.T(), "br", response.Header().Get("Content-Encoding"))
+	body, err := io.ReadAll(brotli.NewReader(response.Body))
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), suite.payload, string(body))
+
+	response = suite.get("/items", map[string]string{"Accept-Encoding": "br;q=0, *"})
+	assert.Equal(suite.T(), "gzip", response.Header().Get("Content-Encoding"))
+}
+
+func (suite *CompressionTestSuite) TestNotAcceptedStillVary() {
+	response := suite.get("/items", nil)
+
+	assert.Empty(suite.T(), response.Header().Get("Content-Encoding"))
+	assert.Equal(suite.T(), "Accept-Encoding", response.Header().Get("Vary"))
+	assert.Equal(suite.T(), suite.payload, response.Body.String())
+}
+
+func (suite *CompressionTestSuite) TestSkippedResponses() {
+	headers := map[string]string{"Accept-Encoding": "gzip, br"}
+
+	small := suite.get("/small", headers)
+	assert.Empty(suite.T(), small.Header().Get("Content-Encoding"))
+	assert.Equal(suite.T(), "{}", small.Body.String())
+
+	image := suite.get("/image", headers)
+	assert.Empty(suite.T(), image.Header().Get("Content-Encoding"))
+	assert.Empty(suite.T(), image.Header().Get("Vary"))
+
+	// Already compressed by the backend, passed as is
+	encoded := suite.get("/encoded", headers)
+	assert.Equal(suite.T(), "gzip", encoded.Header().Get("Content-Encoding"))
+	reader, err := gzip.NewReader(encoded.Body)
+	assert.NoError(suite.T(), err)
+	body, err := io.ReadAll(reader)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), suite.payload, string(body))
+}
+
+func (suite *CompressionTestSuite) TestRangeRequestIsNotCompressed() {
+	response := suite.get("/items", map[string]string{"Accept-Encoding": "gzip", "Range": "bytes=0-9"})
+
+	assert.Equal(suite.T(), http.StatusPartialContent, response.Code)
+	assert.Empty(suite.T(), response.Header().Get("Content-Encoding"))
+	assert.Equal(suite.T(), suite.payload[:10], response.Body.String())
+}
+
+func (suite *CompressionTestSuite) TestStreamingResponse() {
+	server := httptest.NewServer(proxy.NewProxy(suite.usecase, proxy.Config{}))
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/stream", nil)
+	assert.NoError(suite.T(), err)
+	req.Host = "app.example.com"
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	// Use a transport without transparent decompression
+	response, err := (&http.Transport{DisableCompression: true}).RoundTrip(req)
+	assert.NoError(suite.T(), err)
+	defer response.Body.Close()
+
+	assert.Equal(suite.T(), "gzip", response.Header.Get("Content-Encoding"))
+	reader, err := gzip.NewReader(response.Body)
+	assert.NoError(suite.T(), err)
+	body, err := io.ReadAll(reader)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), strings.Repeat("data: event\n\n", 3), string(body))
+}
+
+func TestCompressionTestSuite(t *testing.T) {
+	suite.Run(t, new(CompressionTestSuite))
+}
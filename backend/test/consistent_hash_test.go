@@ -0,0 +1,186 @@
+package test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"test/portal/domain"
+	"test/portal/internal/proxy/balancer"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ConsistentHashTestSuite struct {
+	suite.Suite
+	route domain.RouteItem
+	keys  []string
+}
+
+func (suite *ConsistentHashTestSuite) SetupTest() {
+	suite.route = domain.RouteItem{
+		Name: "cache-heavy-route",
+		Path: "/",
+		LoadBalancing: &domain.RouteLoadBalancing{
+			Strategy: "consistent_hash",
+			HashOn:   "header",
+			HashKey:  "X-User-ID",
+		},
+	}
+	suite.keys = make([]string, 0, 10000)
+	for i := 0; i < 10000; i++ {
+		suite.keys = append(suite.keys, fmt.Sprintf("user-%d", i))
+	}
+}
+
+func (suite *ConsistentHashTestSuite) newBalancer(count int) *balancer.Balancer {
+	backends := make([]domain.RouteBackend, 0, count)
+	for i := 0; i < count; i++ {
+		backends = append(backends, domain.RouteBackend{URL: fmt.Sprintf("http://replica-%d.internal:8080", i)})
+	}
+	routeBalancer, err := balancer.New(backends, time.Now)
+	assert.NoError(suite.T(), err)
+	return routeBalancer
+}
+
+// Backend URL serving each key
+func (suite *ConsistentHashTestSuite) assign(routeBalancer *balancer.Balancer) map[string]string {
+	assignment := make(map[string]string, len(suite.keys))
+	for _, key := range suite.keys {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-User-ID", key)
+		target, cookie := routeBalancer.Pick(req, &suite.route, netip.Addr{})
+		assert.Nil(suite.T(), cookie)
+		assignment[key] = target.Backend.URL
+	}
+	return assignment
+}
+
+func (suite *ConsistentHashTestSuite) TestKeyDistribution() {
+	assignment := suite.assign(suite.newBalancer(4))
+
+	counts := map[string]int{}
+	for _, url := range assignment {
+		counts[url]++
+	}
+	assert.Len(suite.T(), counts, 4)
+	for url, count := range counts {
+		share := float64(count) / float64(len(suite.keys))
+		assert.InDelta(suite.T(), 0.25, share, 0.07, "unbalanced share for %s", url)
+	}
+}
+
+func (suite *ConsistentHashTestSuite) TestStableAssignment() {
+	first := suite.assign(suite.newBalancer(4))
+	second := suite.assign(suite.newBalancer(4))
+	assert.Equal(suite.T(), first, second)
+}
+
+func (suite *ConsistentHashTestSuite) TestMinimalRemappingOnAdd() {
+	before := suite.assign(suite.newBalancer(4))
+	after := suite.assign(suite.newBalancer(5))
+
+	moved := 0
+	for key, url := range before {
+		if after[key] != url {
+			moved++
+			// Keys only move to the new replica
+			assert.Equal(suite.T(), "http://replica-4.internal:8080", after[key])
+		}
+	}
+	// Ideal is 1/5 of the keys
+	assert.InDelta(suite.T(), 0.2, float64(moved)/float64(len(suite.keys)), 0.07)
+}
+
+func (suite *ConsistentHashTestSuite) TestMinimalRemappingOnRemove() {
+	before := suite.assign(suite.newBalancer(5))
+	after := suite.assign(suite.newBalancer(4))
+
+	for key, url := range before {
+		if url != "http://replica-4.internal:8080" {
+			// Keys of the remaining replicas stay where they are
+			assert.Equal(suite.T(), url, after[key])
+		}
+	}
+}
+
+func (suite *ConsistentHashTestSuite) TestUnhealthyTargetOnlyMoveItsKeys() {
+	routeBalancer := suite.newBalancer(4)
+	before := suite.assign(routeBalancer)
+
+	down := routeBalancer.Targets()[1]
+	routeBalancer.MarkUnhealthy(down)
+	after := suite.assign(routeBalancer)
+
+	for key, url := range before {
+		if url == down.Backend.URL {
+			assert.NotEqual(suite.T(), url, after[key])
+			continue
+		}
+		assert.Equal(suite.T(), url, after[key])
+	}
+}
+
+func (suite *ConsistentHashTestSuite) TestHashSources() {
+	routeBalancer := suite.newBalancer(4)
+	pick := func(lb *domain.RouteLoadBalancing, req *http.Request, clientIP netip.Addr) string {
+		route := domain.RouteItem{Name: "hash-route", Path: "/", LoadBalancing: lb}
+		target, _ := routeBalancer.Pick(req, &route, clientIP)
+		return target.Backend.URL
+	}
+
+	byQuery := &domain.RouteLoadBalancing{Strategy: "consistent_hash", HashOn: "query", HashKey: "tenant"}
+	byCookie := &domain.RouteLoadBalancing{Strategy: "consistent_hash", HashOn: "cookie", HashKey: "uid"}
+	byClientIP := &domain.RouteLoadBalancing{Strategy: "consistent_hash", HashOn: "client_ip"}
+
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		queryReq := httptest.NewRequest(http.MethodGet, "/?tenant="+key, nil)
+		assert.Equal(suite.T(), pick(byQuery, queryReq, netip.Addr{}), pick(byQuery, queryReq, netip.Addr{}))
+
+		cookieReq := httptest.NewRequest(http.MethodGet, "/", nil)
+		cookieReq.AddCookie(&http.Cookie{Name: "uid", Value: key})
+		assert.Equal(suite.T(), pick(byCookie, cookieReq, netip.Addr{}), pick(byCookie, cookieReq, netip.Addr{}))
+
+		clientIP := netip.AddrFrom4([4]byte{192, 0, 2, byte(i)})
+		plainReq := httptest.NewRequest(http.MethodGet, "/", nil)
+		assert.Equal(suite.T(), pick(byClientIP, plainReq, clientIP), pick(byClientIP, plainReq, clientIP))
+	}
+
+	// Without key the requests are spread round robin
+	seen := map[string]bool{}
+	for i := 0; i < 4; i++ {
+		seen[pick(byQuery, httptest.NewRequest(http.MethodGet, "/", nil), netip.Addr{})] = true
+	}
+	assert.Len(suite.T(), seen, 4)
+}
+
+func (suite *ConsistentHashTestSuite) TestValidation() {
+	validate := newTestValidator()
+	isEnabled := true
+	route := domain.RouteItem{
+		Name:          "hash-route",
+		Host:          "hash.example.com",
+		Path:          "/",
+		Backend:       "http://localhost:8080",
+		Enabled:       &isEnabled,
+		LoadBalancing: &domain.RouteLoadBalancing{Strategy: "consistent_hash", HashOn: "client_ip"},
+	}
+	assert.NoError(suite.T(), validate.Struct(route))
+
+	route.LoadBalancing = &domain.RouteLoadBalancing{Strategy: "consistent_hash", HashOn: "header"}
+	assert.Error(suite.T(), validate.Struct(route))
+
+	route.LoadBalancing = &domain.RouteLoadBalancing{Strategy: "consistent_hash"}
+	assert.Error(suite.T(), validate.Struct(route))
+
+	route.LoadBalancing = &domain.RouteLoadBalancing{Strategy: "maglev"}
+	assert.Error(suite.T(), validate.Struct(route))
+}
+
+func TestConsistentHashTestSuite(t *testing.T) {
+	suite.Run(t, new(ConsistentHashTestSuite))
+}
@@ -0,0 +1,239 @@
+package test
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"test/portal/domain"
+	"test/portal/internal/proxy"
+	"test/portal/internal/proxy/drain"
+	"test/portal/internal/route/repository/yaml"
+	"test/portal/internal/route/usecase"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type DrainTestSuite struct {
+	suite.Suite
+	usecase domain.RouteItemUsecase
+	ctx     context.Context
+	proxy   *httptest.Server
+	backend *httptest.Server
+	// Closed to let the blocked backend requests answer
+	release chan struct{}
+	started chan struct{}
+}
+
+func (suite *DrainTestSuite) setup(grace time.Duration) {
+	// Clean or recreate yaml file
+	os.Remove("./.data/routes.yaml")
+	file, err := os.Create("./.data/routes.yaml")
+	if err != nil {
+		log.Fatal("Failed to create test yaml file:", err)
+	}
+	file.Close()
+
+	tracker := drain.New(grace)
+	suite.usecase = usecase.NewConfiguredRouteUsecase(yaml.NewRouteYamlRepository(), usecase.Config{Drainer: tracker})
+	suite.ctx = context.Background()
+	suite.release = make(chan struct{})
+	suite.started = make(chan struct{}, 10)
+
+	suite.backend = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") == "echo" {
+			// Minimal upgraded protocol echoing the bytes received
+			conn, buffer, err := http.NewResponseController(w).Hijack()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			buffer.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+			buffer.Flush()
+			suite.started <- struct{}{}
+			io.Copy(conn, buffer)
+			return
+		}
+		suite.started <- struct{}{}
+		select {
+		case <-suite.release:
+			w.Write([]byte("done"))
+		case <-r.Context().Done():
+		}
+	}))
+	suite.proxy = httptest.NewServer(proxy.NewProxy(suite.usecase, proxy.Config{Drain: tracker}))
+
+	isEnabled := true
+	_, err = suite.usecase.Create(suite.ctx, domain.RouteItem{
+		Name:    "orders-route",
+		Host:    "orders.example.com",
+		Path:    "/orders",
+		Backend: suite.backend.URL,
+		Enabled: &isEnabled,
+	})
+	suite.Require().NoError(err)
+}
+
+func (suite *DrainTestSuite) TearDownTest() {
+	suite.proxy.Close()
+	suite.backend.Close()
+}
+
+func (suite *DrainTestSuite) get() (*http.Response, error) {
+	req, _ := http.NewRequest(http.MethodGet, suite.proxy.URL+"/orders", nil)
+	req.Host = "orders.example.com"
+	return http.DefaultClient.Do(req)
+}
+
+// Start a request blocked on the backend, its response is sent on the channel
+func (suite *DrainTestSuite) startRequest() chan *http.Response {
+	responses := make(chan *http.Response, 1)
+	go func() {
+		response, err := suite.get()
+		if err != nil {
+			responses <- nil
+			return
+		}
+		responses <- response
+	}()
+	<-suite.started
+	return responses
+}
+
+func (suite *DrainTestSuite) disable() {
+	isEnabled := false
+	route, err := suite.usecase.GetOne(suite.ctx, "orders-route")
+	suite.Require().NoError(err)
+	route.Enabled = &isEnabled
+	_, err = suite.usecase.Update(suite.ctx, *route)
+	suite.Require().NoError(err)
+}
+
+func (suite *DrainTestSuite) TestDisableKeepInFlight() {
+	suite.setup(time.Minute)
+	responses := suite.startRequest()
+
+	suite.disable()
+
+	// New requests don't match anymore
+	response, err := suite.get()
+	suite.Require().NoError(err)
+	response.Body.Close()
+	assert.Equal(suite.T(), http.StatusNotFound, response.StatusCode)
+
+	status, err := suite.usecase.GetDrainStatus(suite.ctx, "orders-route")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), status.Draining)
+	assert.Equal(suite.T(), 1, status.InFlightRequests)
+	assert.WithinDuration(suite.T(), time.Now().Add(time.Minute), *status.Deadline, 5*time.Second)
+	route, _ := suite.usecase.GetOne(suite.ctx, "orders-route")
+	assert.True(suite.T(), route.Drain.Draining)
+
+	// The in-flight request complete normally
+	close(suite.release)
+	response = <-responses
+	suite.Require().NotNil(response)
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	assert.Equal(suite.T(), http.StatusOK, response.StatusCode)
+	assert.Equal(suite.T(), "done", string(body))
+
+	status, err = suite.usecase.GetDrainStatus(suite.ctx, "orders-route")
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), status.Draining)
+	route, _ = suite.usecase.GetOne(suite.ctx, "orders-route")
+	assert.Nil(suite.T(), route.Drain)
+}
+
+func (suite *DrainTestSuite) TestDeleteGracePeriod() {
+	suite.setup(200 * time.Millisecond)
+	responses := suite.startRequest()
+
+	assert.NoError(suite.T(), suite.usecase.Delete(suite.ctx, "orders-route"))
+
+	// Still reported while draining even though the route is gone
+	status, err := suite.usecase.GetDrainStatus(suite.ctx, "orders-route")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), status.Draining)
+
+	// The request is cut once the grace period is over
+	select {
+	case response := <-responses:
+		suite.Require().NotNil(response)
+		response.Body.Close()
+		assert.Equal(suite.T(), http.StatusBadGateway, response.StatusCode)
+	case <-time.After(5 * time.Second):
+		suite.T().Fatal("request not cancelled after the grace period")
+	}
+
+	assert.Eventually(suite.T(), func() bool {
+		_, err := suite.usecase.GetDrainStatus(suite.ctx, "orders-route")
+		return err != nil && err.Error() == domain.ErrNotFound
+	}, time.Second, 10*time.Millisecond)
+}
+
+func (suite *DrainTestSuite) TestUpgradedConnection() {
+	suite.setup(300 * time.Millisecond)
+
+	conn, err := net.Dial("tcp", suite.proxy.Listener.Addr().String())
+	suite.Require().NoError(err)
+	defer conn.Close()
+	conn.Write([]byte("GET /orders/ws HTTP/1.1\r\nHost: orders.example.com\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n"))
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, nil)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), http.StatusSwitchingProtocols, response.StatusCode)
+	<-suite.started
+
+	suite.disable()
+	status, err := suite.usecase.GetDrainStatus(suite.ctx, "orders-route")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, status.UpgradedConnections)
+	assert.Equal(suite.T(), 0, status.InFlightRequests)
+
+	// Usable during the grace period
+	conn.Write([]byte("ping\n"))
+	line, err := reader.ReadString('\n')
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "ping\n", line)
+
+	// Then closed
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = reader.ReadString('\n')
+	assert.ErrorIs(suite.T(), err, io.EOF)
+}
+
+func (suite *DrainTestSuite) TestEnableAgainStopDrain() {
+	suite.setup(200 * time.Millisecond)
+	responses := suite.startRequest()
+
+	suite.disable()
+	route, _ := suite.usecase.GetOne(suite.ctx, "orders-route")
+	isEnabled := true
+	route.Enabled = &isEnabled
+	_, err := suite.usecase.Update(suite.ctx, *route)
+	assert.NoError(suite.T(), err)
+
+	status, err := suite.usecase.GetDrainStatus(suite.ctx, "orders-route")
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), status.Draining)
+
+	// Past the grace period the request is still served
+	time.Sleep(400 * time.Millisecond)
+	close(suite.release)
+	response := <-responses
+	suite.Require().NotNil(response)
+	response.Body.Close()
+	assert.Equal(suite.T(), http.StatusOK, response.StatusCode)
+}
+
+func TestDrainTestSuite(t *testing.T) {
+	suite.Run(t, new(DrainTestSuite))
+}
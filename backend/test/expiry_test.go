@@ -0,0 +1,201 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"test/portal/domain"
+	"test/portal/internal/proxy"
+	routedelivery "test/portal/internal/route/delivery/http"
+	"test/portal/internal/route/expiry"
+	"test/portal/internal/route/repository/yaml"
+	"test/portal/internal/route/usecase"
+	"test/portal/pkg/httputils"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ExpiryTestSuite struct {
+	suite.Suite
+	usecase domain.RouteItemUsecase
+	ctx     context.Context
+	now     time.Time
+	backend *httptest.Server
+}
+
+func (suite *ExpiryTestSuite) SetupTest() {
+	// Clean or recreate yaml file
+	os.Remove("./.data/routes.yaml")
+	file, err := os.Create("./.data/routes.yaml")
+	if err != nil {
+		log.Fatal("Failed to create test yaml file:", err)
+	}
+	file.Close()
+
+	suite.now = time.Date(2025, 6, 2, 8, 0, 0, 0, time.UTC)
+	suite.usecase = usecase.NewConfiguredRouteUsecase(yaml.NewRouteYamlRepository(), usecase.Config{
+		Now:           func() time.Time { return suite.now },
+		ExpiryWarning: 6 * time.Hour,
+	})
+	suite.ctx = context.Background()
+	suite.backend = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("preview"))
+	}))
+}
+
+func (suite *ExpiryTestSuite) TearDownTest() {
+	suite.backend.Close()
+}
+
+func (suite *ExpiryTestSuite) createRoute(name string, expiresIn time.Duration, policy string) (*domain.RouteItem, error) {
+	isEnabled := true
+	expiresAt := suite.now.Add(expiresIn)
+	return suite.usecase.Create(suite.ctx, domain.RouteItem{
+		Name:         name,
+		Host:         name + ".preview.example.com",
+		Path:         "/",
+		Backend:      suite.backend.URL,
+		Enabled:      &isEnabled,
+		ExpiresAt:    &expiresAt,
+		ExpiryPolicy: policy,
+	})
+}
+
+func (suite *ExpiryTestSuite) get(name string) int {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Host = name + ".preview.example.com"
+	response := httptest.NewRecorder()
+	proxy.NewProxy(suite.usecase, proxy.Config{}).ServeHTTP(response, req)
+	return response.Code
+}
+
+func (suite *ExpiryTestSuite) TestWarningWindow() {
+	route, err := suite.createRoute("pr-101", 48*time.Hour, "")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), int64(48*3600), route.Expiry.ExpiresInSeconds)
+	assert.Empty(suite.T(), route.Expiry.Warning)
+
+	suite.now = suite.now.Add(45 * time.Hour)
+	route, _ = suite.usecase.GetOne(suite.ctx, "pr-101")
+	assert.False(suite.T(), route.Expiry.Expired)
+	assert.Equal(suite.T(), "Route expires in 3h0m0s", route.Expiry.Warning)
+	assert.Equal(suite.T(), domain.RouteStateActive, route.EffectiveState)
+
+	// Expired routes stop being served before the reaper run
+	suite.now = suite.now.Add(3 * time.Hour)
+	route, _ = suite.usecase.GetOne(suite.ctx, "pr-101")
+	assert.True(suite.T(), route.Expiry.Expired)
+	assert.Equal(suite.T(), int64(0), route.Expiry.ExpiresInSeconds)
+	assert.Equal(suite.T(), domain.RouteStateExpired, route.EffectiveState)
+	assert.Equal(suite.T(), http.StatusNotFound, suite.get("pr-101"))
+}
+
+func (suite *ExpiryTestSuite) TestReaper() {
+	_, err := suite.createRoute("pr-disable", time.Hour, "")
+	assert.NoError(suite.T(), err)
+	_, err = suite.createRoute("pr-delete", time.Hour, domain.RouteExpiryDelete)
+	assert.NoError(suite.T(), err)
+	_, err = suite.createRoute("pr-later", 3*time.Hour, domain.RouteExpiryDelete)
+	assert.NoError(suite.T(), err)
+	reaper := expiry.NewReaper(suite.usecase)
+
+	reaped, err := reaper.Tick(suite.ctx)
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), reaped)
+
+	suite.now = suite.now.Add(time.Hour)
+	reaped, err = reaper.Tick(suite.ctx)
+	assert.NoError(suite.T(), err)
+	assert.ElementsMatch(suite.T(), []string{"pr-disable", "pr-delete"}, reaped)
+
+	route, err := suite.usecase.GetOne(suite.ctx, "pr-disable")
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), *route.Enabled)
+	assert.Equal(suite.T(), domain.RouteStateDisabled, route.EffectiveState)
+	_, err = suite.usecase.GetOne(suite.ctx, "pr-delete")
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusOK, suite.get("pr-later"))
+
+	// Already disabled routes are left alone
+	reaped, err = reaper.Tick(suite.ctx)
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), reaped)
+}
+
+func (suite *ExpiryTestSuite) TestValidation() {
+	_, err := suite.createRoute("pr-past", -time.Minute, "")
+	assert.ErrorContains(suite.T(), err, domain.ErrBadRequest)
+
+	// A disabled route can keep a past expiry
+	isDisabled := false
+	expiresAt := suite.now.Add(-time.Hour)
+	_, err = suite.usecase.Create(suite.ctx, domain.RouteItem{
+		Name: "pr-old", Host: "pr-old.preview.example.com", Path: "/", Backend: suite.backend.URL,
+		Enabled: &isDisabled, ExpiresAt: &expiresAt,
+	})
+	assert.NoError(suite.T(), err)
+
+	validate := newTestValidator()
+	route := domain.RouteItem{
+		Name: "pr-102", Host: "pr-102.preview.example.com", Path: "/", Backend: suite.backend.URL,
+		Enabled: &isDisabled, ExpiryPolicy: "archive",
+	}
+	assert.Error(suite.T(), validate.Struct(route))
+	assert.Error(suite.T(), validate.Struct(domain.RouteExpiryExtension{}))
+	assert.Error(suite.T(), validate.Struct(domain.RouteExpiryExtension{ExpiresAt: &expiresAt, ExtendSeconds: 60}))
+	assert.NoError(suite.T(), validate.Struct(domain.RouteExpiryExtension{ExtendSeconds: 60}))
+}
+
+func (suite *ExpiryTestSuite) extend(name string, extension domain.RouteExpiryExtension) *httptest.ResponseRecorder {
+	delivery := routedelivery.NewTestRouteDelivery(suite.ctx, newTestValidator(), suite.usecase)
+	payload, err := json.Marshal(extension)
+	assert.NoError(suite.T(), err)
+	return httputils.HTTPTestRequest(suite.T(), httputils.HTTPTestConfig{
+		Method:  http.MethodPut,
+		Path:    "/routes/" + name + "/expiry",
+		Payload: bytes.NewBuffer(payload),
+		HandlerFunc: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			delivery.ExtendExpiry(suite.ctx, w, r)
+		}),
+	})
+}
+
+func (suite *ExpiryTestSuite) TestExtend() {
+	_, err := suite.createRoute("pr-103", time.Hour, "")
+	assert.NoError(suite.T(), err)
+
+	// Added to the current expiry
+	response := suite.extend("pr-103", domain.RouteExpiryExtension{ExtendSeconds: 7200})
+	assert.Equal(suite.T(), http.StatusOK, response.Code)
+	route, _ := suite.usecase.GetOne(suite.ctx, "pr-103")
+	assert.Equal(suite.T(), suite.now.Add(3*time.Hour), route.ExpiresAt.UTC())
+
+	expiresAt := suite.now.Add(24 * time.Hour)
+	response = suite.extend("pr-103", domain.RouteExpiryExtension{ExpiresAt: &expiresAt})
+	assert.Equal(suite.T(), http.StatusOK, response.Code)
+	var responseBody map[string]interface{}
+	assert.NoError(suite.T(), json.Unmarshal(response.Body.Bytes(), &responseBody))
+	assert.Equal(suite.T(), float64(24*3600), responseBody["data"].(map[string]interface{})["expiry"].(map[string]interface{})["expiresInSeconds"])
+
+	// Once expired the extension start from now
+	suite.now = suite.now.Add(48 * time.Hour)
+	response = suite.extend("pr-103", domain.RouteExpiryExtension{ExtendSeconds: 60})
+	assert.Equal(suite.T(), http.StatusOK, response.Code)
+	route, _ = suite.usecase.GetOne(suite.ctx, "pr-103")
+	assert.Equal(suite.T(), suite.now.Add(time.Minute), route.ExpiresAt.UTC())
+
+	past := suite.now.Add(-time.Minute)
+	assert.Equal(suite.T(), http.StatusBadRequest, suite.extend("pr-103", domain.RouteExpiryExtension{ExpiresAt: &past}).Code)
+	assert.Equal(suite.T(), http.StatusNotFound, suite.extend("pr-missing", domain.RouteExpiryExtension{ExtendSeconds: 60}).Code)
+}
+
+func TestExpiryTestSuite(t *testing.T) {
+	suite.Run(t, new(ExpiryTestSuite))
+}
@@ -0,0 +1,174 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"test/portal/domain"
+	"test/portal/internal/proxy"
+	"test/portal/internal/route/repository/yaml"
+	"test/portal/internal/route/usecase"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type FaultInjectionTestSuite struct {
+	suite.Suite
+	repo    domain.RouteItemRepository
+	usecase domain.RouteItemUsecase
+	ctx     context.Context
+	backend *httptest.Server
+	hits    int
+}
+
+func (suite *FaultInjectionTestSuite) SetupTest() {
+	// Clean or recreate yaml file
+	os.Remove("./.data/routes.yaml")
+	file, err := os.Create("./.data/routes.yaml")
+	if err != nil {
+		log.Fatal("Failed to create test yaml file:", err)
+	}
+	file.Close()
+
+	suite.repo = yaml.NewRouteYamlRepository()
+	suite.usecase = usecase.NewRouteUsecase(suite.repo)
+	suite.ctx = context.Background()
+
+	suite.hits = 0
+	suite.backend = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		suite.hits++
+		w.Write([]byte("backend"))
+	}))
+}
+
+func (suite *FaultInjectionTestSuite) TearDownTest() {
+	suite.backend.Close()
+}
+
+func (suite *FaultInjectionTestSuite) createRoute(faults *domain.RouteFaultInjection) error {
+	isEnabled := true
+	_, err := suite.usecase.Create(suite.ctx, domain.RouteItem{
+		Name:    "orders-route",
+		Host:    "orders.example.com",
+		Path:    "/orders",
+		Backend: suite.backend.URL,
+		Enabled: &isEnabled,
+		Faults:  faults,
+	})
+	return err
+}
+
+func (suite *FaultInjectionTestSuite) get(random float64, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	req.Host = "orders.example.com"
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	response := httptest.NewRecorder()
+	proxy.NewProxy(suite.usecase, proxy.Config{
+		Random: func() float64 { return random },
+	}).ServeHTTP(response, req)
+	return response
+}
+
+func inOneHour() *time.Time {
+	expiresAt := time.Now().Add(time.Hour)
+	return &expiresAt
+}
+
+func (suite *FaultInjectionTestSuite) TestAbort() {
+	assert.NoError(suite.T(), suite.createRoute(&domain.RouteFaultInjection{
+		Enabled:   true,
+		ExpiresAt: inOneHour(),
+		Abort:     &domain.RouteFaultAbort{StatusCode: http.StatusServiceUnavailable, Percentage: 25},
+	}))
+
+	response := suite.get(0.2, nil)
+	assert.Equal(suite.T(), http.StatusServiceUnavailable, response.Code)
+	assert.Equal(suite.T(), "abort", response.Header().Get("X-Fault-Injected"))
+	var responseBody map[string]interface{}
+	assert.NoError(suite.T(), json.Unmarshal(response.Body.Bytes(), &responseBody))
+	assert.Equal(suite.T(), "503:Service Unavailable", responseBody["message"])
+	assert.Equal(suite.T(), 0, suite.hits)
+
+	// Outside the percentage the request reach the backend
+	response = suite.get(0.3, nil)
+	assert.Equal(suite.T(), http.StatusOK, response.Code)
+	assert.Empty(suite.T(), response.Header().Get("X-Fault-Injected"))
+	assert.Equal(suite.T(), 1, suite.hits)
+}
+
+func (suite *FaultInjectionTestSuite) TestDelay() {
+	assert.NoError(suite.T(), suite.createRoute(&domain.RouteFaultInjection{
+		Enabled:   true,
+		ExpiresAt: inOneHour(),
+		Delay:     &domain.RouteFaultDelay{DurationMs: 200, Percentage: 100},
+	}))
+
+	start := time.Now()
+	response := suite.get(0.99, nil)
+	assert.Equal(suite.T(), http.StatusOK, response.Code)
+	assert.Equal(suite.T(), "delay", response.Header().Get("X-Fault-Injected"))
+	assert.GreaterOrEqual(suite.T(), time.Since(start), 200*time.Millisecond)
+	assert.Equal(suite.T(), 1, suite.hits)
+}
+
+func (suite *FaultInjectionTestSuite) TestHeaderMatch() {
+	assert.NoError(suite.T(), suite.createRoute(&domain.RouteFaultInjection{
+		Enabled:     true,
+		ExpiresAt:   inOneHour(),
+		Abort:       &domain.RouteFaultAbort{StatusCode: http.StatusInternalServerError, Percentage: 100},
+		HeaderName:  "X-Chaos",
+		HeaderValue: "on",
+	}))
+
+	assert.Equal(suite.T(), http.StatusOK, suite.get(0, nil).Code)
+	assert.Equal(suite.T(), http.StatusOK, suite.get(0, map[string]string{"X-Chaos": "off"}).Code)
+	assert.Equal(suite.T(), http.StatusInternalServerError, suite.get(0, map[string]string{"X-Chaos": "on"}).Code)
+}
+
+func (suite *FaultInjectionTestSuite) TestExpired() {
+	assert.NoError(suite.T(), suite.createRoute(nil))
+
+	// Stored before it expired, the proxy stop applying it
+	route, _ := suite.repo.GetOne(suite.ctx, "orders-route")
+	expiredAt := time.Now().Add(-time.Minute)
+	route.Faults = &domain.RouteFaultInjection{
+		Enabled:   true,
+		ExpiresAt: &expiredAt,
+		Abort:     &domain.RouteFaultAbort{StatusCode: http.StatusInternalServerError, Percentage: 100},
+	}
+	_, err := suite.repo.Update(suite.ctx, *route)
+	assert.NoError(suite.T(), err)
+
+	assert.Equal(suite.T(), http.StatusOK, suite.get(0, nil).Code)
+}
+
+func (suite *FaultInjectionTestSuite) TestRequireExpiry() {
+	abort := &domain.RouteFaultAbort{StatusCode: http.StatusInternalServerError, Percentage: 100}
+	validate := newTestValidator()
+
+	assert.Error(suite.T(), validate.Struct(domain.RouteFaultInjection{Enabled: true, Abort: abort}))
+	assert.NoError(suite.T(), validate.Struct(domain.RouteFaultInjection{Enabled: true, ExpiresAt: inOneHour(), Abort: abort}))
+	assert.NoError(suite.T(), validate.Struct(domain.RouteFaultInjection{Enabled: false, Abort: abort}))
+	assert.Error(suite.T(), validate.Struct(domain.RouteFaultInjection{Enabled: true, ExpiresAt: inOneHour()}))
+	assert.Error(suite.T(), validate.Struct(domain.RouteFaultInjection{Enabled: true, ExpiresAt: inOneHour(), Abort: &domain.RouteFaultAbort{StatusCode: 200, Percentage: 100}}))
+	assert.Error(suite.T(), validate.Struct(domain.RouteFaultInjection{Enabled: true, ExpiresAt: inOneHour(), Delay: &domain.RouteFaultDelay{DurationMs: 100, Percentage: 150}}))
+
+	// The usecase also reject an expiry already passed
+	expiredAt := time.Now().Add(-time.Minute)
+	err := suite.createRoute(&domain.RouteFaultInjection{Enabled: true, ExpiresAt: &expiredAt, Abort: abort})
+	assert.ErrorContains(suite.T(), err, domain.ErrBadRequest)
+	err = suite.createRoute(&domain.RouteFaultInjection{Enabled: true, Abort: abort})
+	assert.ErrorContains(suite.T(), err, domain.ErrBadRequest)
+}
+
+func TestFaultInjectionTestSuite(t *testing.T) {
+	suite.Run(t, new(FaultInjectionTestSuite))
+}
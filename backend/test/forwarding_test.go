@@ -0,0 +1,289 @@
+package test
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"test/portal/domain"
+	"test/portal/internal/proxy"
+	"test/portal/internal/proxy/forwarding"
+	"test/portal/internal/route/repository/yaml"
+	"test/portal/internal/route/usecase"
+	"test/portal/pkg/iputils"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ForwardingTestSuite struct {
+	suite.Suite
+	repo    domain.RouteItemRepository
+	usecase domain.RouteItemUsecase
+	ctx     context.Context
+	backend *httptest.Server
+}
+
+func (suite *ForwardingTestSuite) SetupTest() {
+	// Clean or recreate yaml file
+	os.Remove("./.data/routes.yaml")
+	file, err := os.Create("./.data/routes.yaml")
+	if err != nil {
+		log.Fatal("Failed to create test yaml file:", err)
+	}
+	file.Close()
+
+	suite.repo = yaml.NewRouteYamlRepository()
+	suite.usecase = usecase.NewRouteUsecase(suite.repo)
+	suite.ctx = context.Background()
+
+	// Backend echo the forwarding headers it received
+	suite.backend = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, key := range []string{"Forwarded", "X-Forwarded-For", "X-Forwarded-Proto", "X-Forwarded-Host"} {
+			w.Header().Set("Echo-"+key, r.Header.Get(key))
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+}
+
+func (suite *ForwardingTestSuite) TearDownTest() {
+	suite.backend.Close()
+}
+
+func (suite *ForwardingTestSuite) createRoute(disableForwardedHeaders bool) {
+	isEnabled := true
+	_, err := suite.repo.Create(suite.ctx, domain.RouteItem{
+		Name:                    "forward-route",
+		Host:                    "app.example.com",
+		Path:                    "/",
+		Backend:                 suite.backend.URL,
+		Enabled:                 &isEnabled,
+		DisableForwardedHeaders: disableForwardedHeaders,
+	})
+	assert.NoError(suite.T(), err)
+}
+
+func (suite *ForwardingTestSuite) doRequest(remoteAddr string, headers map[string]string) *httptest.ResponseRecorder {
+	trusted, err := iputils.ParsePrefixes([]string{"172.16.0.0/12"})
+	assert.NoError(suite.T(), err)
+	handler := proxy.NewProxy(suite.usecase, proxy.Config{TrustedProxies: trusted})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Host = "app.example.com"
+	req.RemoteAddr = remoteAddr
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, req)
+	return response
+}
+
+func (suite *ForwardingTestSuite) TestHeadersFromDirectClient() {
+	suite.createRoute(false)
+
+	response := suite.doRequest("192.0.2.10:4000", nil)
+
+	assert.Equal(suite.T(), http.StatusOK, response.Code)
+	assert.Equal(suite.T(), "192.0.2.10", response.Header().Get("Echo-X-Forwarded-For"))
+	assert.Equal(suite.T(), "http", response.Header().Get("Echo-X-Forwarded-Proto"))
+	assert.Equal(suite.T(), "app.example.com", response.Header().Get("Echo-X-Forwarded-Host"))
+	assert.Equal(suite.T(), "for=192.0.2.10;host=app.example.com;proto=http", response.Header().Get("Echo-Forwarded"))
+}
+
+func (suite *ForwardingTestSuite) TestUntrustedHeadersAreDropped() {
+	suite.createRoute(false)
+
+	response := suite.doRequest("[2001:db8::1]:4000", map[string]string{
+		"X-Forwarded-For":   "10.0.0.1",
+		"X-Forwarded-Proto": "https",
+		"X-Forwarded-Host":  "spoofed.example.com",
+		"Forwarded":         "for=10.0.0.1",
+	})
+
+	assert.Equal(suite.T(), "2001:db8::1", response.Header().Get("Echo-X-Forwarded-For"))
+	assert.Equal(suite.T(), "http", response.Header().Get("Echo-X-Forwarded-Proto"))
+	assert.Equal(suite.T(), "app.example.com", response.Header().Get("Echo-X-Forwarded-Host"))
+	assert.Equal(suite.T(), `for="[2001:db8::1]";host=app.example.com;proto=http`, response.Header().Get("Echo-Forwarded"))
+}
+
+func (suite *ForwardingTestSuite) TestTrustedXForwardedChainIsExtended() {
+	suite.createRoute(false)
+
+	response := suite.doRequest("172.16.0.5:4000", map[string]string{
+		"X-Forwarded-For":   "192.0.2.10",
+		"X-Forwarded-Proto": "https",
+		"X-Forwarded-Host":  "www.example.com",
+	})
+
+	assert.Equal(suite.T(), "192.0.2.10, 172.16.0.5", response.Header().Get("Echo-X-Forwarded-For"))
+	assert.Equal(suite.T(), "https", response.Header().Get("Echo-X-Forwarded-Proto"))
+	assert.Equal(suite.T(), "www.example.com", response.Header().Get("Echo-X-Forwarded-Host"))
+	assert.Equal(suite.T(), "for=172.16.0.5;host=app.example.com;proto=http", response.Header().Get("Echo-Forwarded"))
+}
+
+func (suite *ForwardingTestSuite) TestTrustedForwardedChainIsExtended() {
+	suite.createRoute(false)
+
+	response := suite.doRequest("172.16.0.5:4000", map[string]string{
+		"Forwarded": `for="[2001:db8::7]:4711";proto=https;host="www.example.com"`,
+	})
+
+	assert.Equal(suite.T(), "https", response.Header().Get("Echo-X-Forwarded-Proto"))
+	assert.Equal(suite.T(), "www.example.com", response.Header().Get("Echo-X-Forwarded-Host"))
+	assert.Equal(suite.T(),
+		`for="[2001:db8::7]:4711";proto=https;host="www.example.com", for=172.16.0.5;host=app.example.com;proto=http`,
+		response.Header().Get("Echo-Forwarded"))
+}
+
+func (suite *ForwardingTestSuite) TestInvalidForwardedProtoAndHost() {
+	trusted, err := iputils.ParsePrefixes([]string{"172.16.0.0/12"})
+	assert.NoError(suite.T(), err)
+
+	for _, header := range []map[string]string{
+		{"X-Forwarded-Proto": "javascript", "X-Forwarded-Host": "www.example.com/admin"},
+		{"X-Forwarded-Proto": "ftp", "X-Forwarded-Host": "www.example.com evil"},
+		{"X-Forwarded-Proto": "", "X-Forwarded-Host": "www.example.com:99999"},
+		{"X-Forwarded-Host": "::1"},
+		{"Forwarded": `for=192.0.2.10;proto=javascript;host="www.example.com/admin"`},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "172.16.0.5:4000"
+		req.Host = "app.example.com"
+		for key, value := range header {
+			req.Header.Set(key, value)
+		}
+		client, err := forwarding.Resolve(req, trusted)
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), "http", client.Proto, header)
+		assert.Equal(suite.T(), "app.example.com", client.Host, header)
+	}
+
+	for _, host := range []string{"WWW.example.com", "www.example.com:8443", "192.0.2.1:80", "[2001:db8::1]", "[2001:db8::1]:8443"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "172.16.0.5:4000"
+		req.Header.Set("X-Forwarded-Proto", "HTTPS")
+		req.Header.Set("X-Forwarded-Host", host)
+		client, err := forwarding.Resolve(req, trusted)
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), "https", client.Proto)
+		assert.Equal(suite.T(), host, client.Host)
+	}
+}
+
+func (suite *ForwardingTestSuite) TestRouteOptOut() {
+	suite.createRoute(true)
+
+	response := suite.doRequest("172.16.0.5:4000", map[string]string{
+		"X-Forwarded-For": "192.0.2.10",
+		"Forwarded":       "for=192.0.2.10",
+	})
+
+	assert.Equal(suite.T(), http.StatusOK, response.Code)
+	assert.Empty(suite.T(), response.Header().Get("Echo-X-Forwarded-For"))
+	assert.Empty(suite.T(), response.Header().Get("Echo-X-Forwarded-Proto"))
+	assert.Empty(suite.T(), response.Header().Get("Echo-Forwarded"))
+}
+
+func (suite *ForwardingTestSuite) TestResolveForwardedSkipTrustedHops() {
+	trusted, err := iputils.ParsePrefixes([]string{"172.16.0.0/12"})
+	assert.NoError(suite.T(), err)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "172.16.0.5:4000"
+	req.Header.Set("Forwarded", `for=10.0.0.1, for=192.0.2.10;proto=https, for=172.16.0.9`)
+
+	client, err := forwarding.Resolve(req, trusted)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), netip.MustParseAddr("192.0.2.10"), client.Addr)
+	assert.Equal(suite.T(), "https", client.Proto)
+
+	// Obfuscated identifier stop the walk
+	req.Header.Set("Forwarded", `for=192.0.2.10, for=_hidden, for=172.16.0.9`)
+	client, err = forwarding.Resolve(req, trusted)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), netip.MustParseAddr("172.16.0.9"), client.Addr)
+}
+
+// Serve the remote address seen by the HTTP server behind the PROXY listener
+func (suite *ForwardingTestSuite) proxyProtocolServer(trusted string) net.Listener {
+	prefixes, err := iputils.ParsePrefixes([]string{trusted})
+	assert.NoError(suite.T(), err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(suite.T(), err)
+
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.RemoteAddr))
+	})}
+	go server.Serve(forwarding.NewListener(listener, prefixes))
+	suite.T().Cleanup(func() { server.Close() })
+	return listener
+}
+
+func (suite *ForwardingTestSuite) sendWithHeader(listener net.Listener, header []byte) string {
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	assert.NoError(suite.T(), err)
+	defer conn.Close()
+
+	conn.Write(header)
+	conn.Write([]byte("GET / HTTP/1.1\r\nHost: app.example.com\r\nConnection: close\r\n\r\n"))
+
+	response, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if !assert.NoError(suite.T(), err) {
+		return ""
+	}
+	defer response.Body.Close()
+	body := make([]byte, 128)
+	n, _ := response.Body.Read(body)
+	return string(body[:n])
+}
+
+func (suite *ForwardingTestSuite) TestProxyProtocolV1() {
+	listener := suite.proxyProtocolServer("127.0.0.0/8")
+
+	remoteAddr := suite.sendWithHeader(listener, []byte("PROXY TCP4 192.0.2.10 127.0.0.1 56324 8000\r\n"))
+	assert.Equal(suite.T(), "192.0.2.10:56324", remoteAddr)
+
+	// Plain connection from a trusted peer still work
+	remoteAddr = suite.sendWithHeader(listener, nil)
+	assert.Contains(suite.T(), remoteAddr, "127.0.0.1:")
+}
+
+func (suite *ForwardingTestSuite) TestProxyProtocolV2() {
+	listener := suite.proxyProtocolServer("127.0.0.0/8")
+
+	header := []byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A, 0x21, 0x21, 0x00, 36}
+	src := netip.MustParseAddr("2001:db8::10").As16()
+	dst := netip.MustParseAddr("2001:db8::1").As16()
+	header = append(header, src[:]...)
+	header = append(header, dst[:]...)
+	header = binary.BigEndian.AppendUint16(header, 40000)
+	header = binary.BigEndian.AppendUint16(header, 8000)
+
+	remoteAddr := suite.sendWithHeader(listener, header)
+	assert.Equal(suite.T(), "[2001:db8::10]:40000", remoteAddr)
+}
+
+func (suite *ForwardingTestSuite) TestProxyProtocolIgnoredFromUntrustedPeer() {
+	listener := suite.proxyProtocolServer("172.16.0.0/12")
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	assert.NoError(suite.T(), err)
+	defer conn.Close()
+
+	// The header is not consumed so the HTTP server reject the request line
+	conn.Write([]byte("PROXY TCP4 192.0.2.10 127.0.0.1 56324 8000\r\nGET / HTTP/1.1\r\nHost: app.example.com\r\n\r\n"))
+	response, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusBadRequest, response.StatusCode)
+}
+
+func TestForwardingTestSuite(t *testing.T) {
+	suite.Run(t, new(ForwardingTestSuite))
+}
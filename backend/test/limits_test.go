@@ -0,0 +1,154 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"test/portal/domain"
+	"test/portal/internal/proxy"
+	routedelivery "test/portal/internal/route/delivery/http"
+	"test/portal/internal/route/repository/yaml"
+	"test/portal/internal/route/usecase"
+	"test/portal/pkg/httputils"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type LimitsTestSuite struct {
+	suite.Suite
+	repo    domain.RouteItemRepository
+	usecase domain.RouteItemUsecase
+	ctx     context.Context
+	backend *httptest.Server
+	server  *httptest.Server
+}
+
+func (suite *LimitsTestSuite) SetupTest() {
+	// Clean or recreate yaml file
+	os.Remove("./.data/routes.yaml")
+	file, err := os.Create("./.data/routes.yaml")
+	if err != nil {
+		log.Fatal("Failed to create test yaml file:", err)
+	}
+	file.Close()
+
+	suite.repo = yaml.NewRouteYamlRepository()
+	suite.usecase = usecase.NewRouteUsecase(suite.repo)
+	suite.ctx = context.Background()
+
+	suite.backend = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write(body)
+	}))
+	suite.server = httptest.NewServer(proxy.NewProxy(suite.usecase, proxy.Config{}))
+
+	isEnabled := true
+	_, err = suite.repo.Create(suite.ctx, domain.RouteItem{
+		Name:                  "upload-route",
+		Host:                  "upload.example.com",
+		Path:                  "/",
+		Backend:               suite.backend.URL,
+		Enabled:               &isEnabled,
+		MaxRequestBodyBytes:   64,
+		MaxRequestHeaderBytes: 512,
+		AllowedContentTypes:   []string{"application/json", "text/*"},
+	})
+	assert.NoError(suite.T(), err)
+}
+
+func (suite *LimitsTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.backend.Close()
+}
+
+func (suite *LimitsTestSuite) send(body io.Reader, contentLength int64, headers map[string]string) (*http.Response, map[string]interface{}) {
+	req, err := http.NewRequest(http.MethodPost, suite.server.URL+"/upload", body)
+	assert.NoError(suite.T(), err)
+	req.Host = "upload.example.com"
+	req.ContentLength = contentLength
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	response, err := http.DefaultClient.Do(req)
+	assert.NoError(suite.T(), err)
+	defer response.Body.Close()
+
+	var responseBody map[string]interface{}
+	json.NewDecoder(response.Body).Decode(&responseBody)
+	return response, responseBody
+}
+
+func (suite *LimitsTestSuite) TestAcceptedRequest() {
+	response, _ := suite.send(strings.NewReader(`{"ok":true}`), 11, map[string]string{"Content-Type": "application/json; charset=utf-8"})
+	assert.Equal(suite.T(), http.StatusOK, response.StatusCode)
+}
+
+func (suite *LimitsTestSuite) TestBodyTooLargeWithContentLength() {
+	payload := strings.Repeat("a", 65)
+	response, responseBody := suite.send(strings.NewReader(payload), 65, map[string]string{"Content-Type": "text/plain"})
+
+	assert.Equal(suite.T(), http.StatusRequestEntityTooLarge, response.StatusCode)
+	assert.Equal(suite.T(), domain.ErrPayloadTooLarge, responseBody["message"])
+}
+
+func (suite *LimitsTestSuite) TestChunkedBodyTooLarge() {
+	// Unknown length, the limit is hit while streaming to the backend
+	payload := io.MultiReader(strings.NewReader(strings.Repeat("a", 50)), strings.NewReader(strings.Repeat("b", 50)))
+	response, responseBody := suite.send(payload, -1, map[string]string{"Content-Type": "text/plain"})
+
+	assert.Equal(suite.T(), http.StatusRequestEntityTooLarge, response.StatusCode)
+	assert.Equal(suite.T(), domain.ErrPayloadTooLarge, responseBody["message"])
+}
+
+func (suite *LimitsTestSuite) TestUnsupportedContentType() {
+	response, responseBody := suite.send(strings.NewReader("<xml/>"), 6, map[string]string{"Content-Type": "application/xml"})
+	assert.Equal(suite.T(), http.StatusUnsupportedMediaType, response.StatusCode)
+	assert.Equal(suite.T(), domain.ErrUnsupportedMediaType, responseBody["message"])
+
+	response, _ = suite.send(strings.NewReader("data"), 4, nil)
+	assert.Equal(suite.T(), http.StatusUnsupportedMediaType, response.StatusCode)
+
+	// Bodyless request doesn't need a content type
+	response, _ = suite.send(nil, 0, nil)
+	assert.Equal(suite.T(), http.StatusOK, response.StatusCode)
+}
+
+func (suite *LimitsTestSuite) TestHeaderTooLarge() {
+	response, responseBody := suite.send(nil, 0, map[string]string{"X-Large": strings.Repeat("h", 600)})
+	assert.Equal(suite.T(), http.StatusRequestHeaderFieldsTooLarge, response.StatusCode)
+	assert.Equal(suite.T(), domain.ErrHeaderTooLarge, responseBody["message"])
+}
+
+func (suite *LimitsTestSuite) TestManagementAPIBodyLimit() {
+	defaultMaxBodyBytes := httputils.MaxBodyBytes
+	httputils.MaxBodyBytes = 32
+	defer func() { httputils.MaxBodyBytes = defaultMaxBodyBytes }()
+
+	delivery := routedelivery.NewTestRouteDelivery(suite.ctx, validator.New(), suite.usecase)
+	payload := `{"name":"` + strings.Repeat("a", 64) + `"}`
+
+	response := httputils.HTTPTestRequest(suite.T(), httputils.HTTPTestConfig{
+		Method:  http.MethodPost,
+		Path:    "/routes",
+		Payload: bytes.NewBufferString(payload),
+		HandlerFunc: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			delivery.Create(suite.ctx, w, r)
+		}),
+	})
+
+	assert.Equal(suite.T(), http.StatusRequestEntityTooLarge, response.Code)
+}
+
+func TestLimitsTestSuite(t *testing.T) {
+	suite.Run(t, new(LimitsTestSuite))
+}
@@ -0,0 +1,148 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"test/portal/domain"
+	"test/portal/pkg/httputils"
+	"test/portal/pkg/logutils"
+	"test/portal/pkg/yamlutils"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type LoggingTestSuite struct {
+	suite.Suite
+	output   *bytes.Buffer
+	previous *slog.Logger
+}
+
+func (suite *LoggingTestSuite) SetupTest() {
+	suite.output = &bytes.Buffer{}
+	suite.previous = slog.Default()
+
+	logger, err := logutils.NewLogger(suite.output, "debug", "json")
+	assert.NoError(suite.T(), err)
+	slog.SetDefault(logger)
+}
+
+func (suite *LoggingTestSuite) TearDownTest() {
+	slog.SetDefault(suite.previous)
+}
+
+// Decoded log lines
+func (suite *LoggingTestSuite) lines() []map[string]interface{} {
+	result := make([]map[string]interface{}, 0)
+	for _, line := range strings.Split(strings.TrimSpace(suite.output.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		entry := make(map[string]interface{})
+		assert.NoError(suite.T(), json.Unmarshal([]byte(line), &entry))
+		result = append(result, entry)
+	}
+	return result
+}
+
+func (suite *LoggingTestSuite) TestLevelAndFormat() {
+	output := &bytes.Buffer{}
+	logger, err := logutils.NewLogger(output, "warn", "text")
+	assert.NoError(suite.T(), err)
+	logger.Info("hidden")
+	logger.Warn("shown", "route", "orders-route")
+	assert.NotContains(suite.T(), output.String(), "hidden")
+	assert.Contains(suite.T(), output.String(), `level=WARN msg=shown route=orders-route`)
+
+	_, err = logutils.NewLogger(output, "verbose", "text")
+	assert.Error(suite.T(), err)
+	_, err = logutils.NewLogger(output, "info", "xml")
+	assert.Error(suite.T(), err)
+}
+
+func (suite *LoggingTestSuite) TestRedaction() {
+	slog.Info("Forward", "Authorization", "Bearer abc", "cookie", "session=1", slog.Group("maintenance", "bypassHeaderValue", "let-me-in"), "route", "orders-route")
+
+	assert.NotContains(suite.T(), suite.output.String(), "Bearer abc")
+	assert.NotContains(suite.T(), suite.output.String(), "session=1")
+	assert.NotContains(suite.T(), suite.output.String(), "let-me-in")
+	line := suite.lines()[0]
+	assert.Equal(suite.T(), "[REDACTED]", line["Authorization"])
+	assert.Equal(suite.T(), "orders-route", line["route"])
+}
+
+func (suite *LoggingTestSuite) TestYamlPayloadNotDumped() {
+	isEnabled := true
+	routes := []domain.RouteItem{{
+		Name:    "orders-route",
+		Host:    "orders.example.com",
+		Path:    "/orders",
+		Backend: "http://orders.internal",
+		Enabled: &isEnabled,
+		Maintenance: &domain.RouteMaintenance{
+			BypassHeader:      "X-Bypass",
+			BypassHeaderValue: "let-me-in",
+		},
+	}}
+	_, err := yamlutils.SaveYamlData(filepath.Join(suite.T().TempDir(), "routes.yaml"), routes)
+	assert.NoError(suite.T(), err)
+
+	assert.NotContains(suite.T(), suite.output.String(), "let-me-in")
+	assert.NotContains(suite.T(), suite.output.String(), "orders.internal")
+	assert.Equal(suite.T(), float64(1), suite.lines()[0]["items"])
+}
+
+func (suite *LoggingTestSuite) TestRequestLogging() {
+	handler := httputils.RequestID(httputils.LogRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if httputils.GetPathParamByPathPosition(r, 2) == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte("route"))
+	})))
+
+	req := httptest.NewRequest(http.MethodGet, "/routes/orders-route", nil)
+	req.Header.Set("X-Request-ID", "req-42")
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, req)
+	assert.Equal(suite.T(), "req-42", response.Header().Get("X-Request-ID"))
+
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/routes", nil))
+	generated := response.Header().Get("X-Request-ID")
+	assert.Len(suite.T(), generated, 32)
+
+	lines := suite.lines()
+	assert.Len(suite.T(), lines, 2)
+	assert.Equal(suite.T(), "req-42", lines[0]["request_id"])
+	assert.Equal(suite.T(), "/routes/orders-route", lines[0]["path"])
+	assert.Equal(suite.T(), float64(http.StatusOK), lines[0]["status"])
+	assert.Equal(suite.T(), float64(len("route")), lines[0]["bytes"])
+	assert.Contains(suite.T(), lines[0], "latency")
+	assert.Equal(suite.T(), generated, lines[1]["request_id"])
+	assert.Equal(suite.T(), float64(http.StatusBadRequest), lines[1]["status"])
+	// Path params are not logged on their own anymore
+	assert.NotContains(suite.T(), suite.output.String(), "Find param value")
+}
+
+func (suite *LoggingTestSuite) TestRequestLoggingFlush() {
+	handler := httputils.LogRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("event"))
+		assert.NoError(suite.T(), http.NewResponseController(w).Flush())
+	}))
+
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/events", nil))
+	assert.True(suite.T(), response.Flushed)
+	assert.Equal(suite.T(), float64(len("event")), suite.lines()[0]["bytes"])
+}
+
+func TestLoggingTestSuite(t *testing.T) {
+	suite.Run(t, new(LoggingTestSuite))
+}
@@ -0,0 +1,171 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"os"
+	"test/portal/domain"
+	"test/portal/internal/proxy"
+	"test/portal/internal/route/repository/yaml"
+	"test/portal/internal/route/usecase"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type LoopTestSuite struct {
+	suite.Suite
+	repo    domain.RouteItemRepository
+	usecase domain.RouteItemUsecase
+	ctx     context.Context
+	backend *httptest.Server
+	via     []string
+}
+
+func (suite *LoopTestSuite) SetupTest() {
+	// Clean or recreate yaml file
+	os.Remove("./.data/routes.yaml")
+	file, err := os.Create("./.data/routes.yaml")
+	if err != nil {
+		log.Fatal("Failed to create test yaml file:", err)
+	}
+	file.Close()
+
+	suite.repo = yaml.NewRouteYamlRepository()
+	suite.usecase = usecase.NewConfiguredRouteUsecase(suite.repo, usecase.Config{
+		ListenAddrs: []string{":8000", "192.0.2.10:80"},
+		LookupIP: func(ctx context.Context, host string) ([]netip.Addr, error) {
+			switch host {
+			case "portal.internal":
+				return []netip.Addr{netip.MustParseAddr("127.0.0.1")}, nil
+			case "public.example.net":
+				return []netip.Addr{netip.MustParseAddr("192.0.2.10")}, nil
+			}
+			return nil, errors.New("no such host")
+		},
+	})
+	suite.ctx = context.Background()
+	suite.via = nil
+	suite.backend = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		suite.via = r.Header.Values("Via")
+		w.Write([]byte("api"))
+	}))
+}
+
+func (suite *LoopTestSuite) TearDownTest() {
+	suite.backend.Close()
+}
+
+func (suite *LoopTestSuite) route(name string, host string, backend string) domain.RouteItem {
+	isEnabled := true
+	return domain.RouteItem{Name: name, Host: host, Path: "/", Backend: backend, Enabled: &isEnabled}
+}
+
+func (suite *LoopTestSuite) TestRejectLoopingBackends() {
+	_, err := suite.usecase.Create(suite.ctx, suite.route("api-route", "api.example.com", suite.backend.URL))
+	assert.NoError(suite.T(), err)
+
+	for _, backend := range []string{
+		// Hosts served by the portal
+		"http://api.example.com",
+		"https://API.example.com.:8443",
+		"http://loop.example.com/",
+		// Listen addresses of the portal
+		"http://127.0.0.1:8000",
+		"http://[::1]:8000",
+		"http://0.0.0.0:8000",
+		"http://portal.internal:8000",
+		"http://192.0.2.10",
+		"http://public.example.net",
+	} {
+		_, err := suite.usecase.Create(suite.ctx, suite.route("loop-route", "loop.example.com", backend))
+		assert.ErrorContains(suite.T(), err, domain.ErrBadRequest, backend)
+	}
+
+	// One looping backend is enough
+	route := suite.route("loop-route", "loop.example.com", "")
+	route.Backends = []domain.RouteBackend{{URL: suite.backend.URL}, {URL: "http://portal.internal:8000"}}
+	_, err = suite.usecase.Create(suite.ctx, route)
+	assert.ErrorContains(suite.T(), err, domain.ErrBadRequest)
+
+	for _, backend := range []string{
+		"http://127.0.0.1:9000",
+		"http://192.0.2.10:8000",
+		"https://public.example.net",
+		"http://unresolved.example.org:8000",
+	} {
+		_, err := suite.usecase.Create(suite.ctx, suite.route("other-route", "other.example.com", backend))
+		assert.NoError(suite.T(), err, backend)
+		assert.NoError(suite.T(), suite.usecase.Delete(suite.ctx, "other-route"))
+	}
+
+	// Updates are checked against the other routes too
+	_, err = suite.usecase.Create(suite.ctx, suite.route("web-route", "web.example.com", suite.backend.URL))
+	assert.NoError(suite.T(), err)
+	_, err = suite.usecase.Update(suite.ctx, suite.route("web-route", "web.example.com", "http://api.example.com:8080"))
+	assert.ErrorContains(suite.T(), err, domain.ErrBadRequest)
+}
+
+func (suite *LoopTestSuite) TestViaHeader() {
+	_, err := suite.usecase.Create(suite.ctx, suite.route("api-route", "api.example.com", suite.backend.URL))
+	assert.NoError(suite.T(), err)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Host = "api.example.com"
+	req.Header.Set("Via", "1.1 edge-cache")
+	response := httptest.NewRecorder()
+	proxy.NewProxy(suite.usecase, proxy.Config{}).ServeHTTP(response, req)
+	assert.Equal(suite.T(), http.StatusOK, response.Code)
+	assert.Equal(suite.T(), []string{"1.1 edge-cache", "1.1 route-portal"}, suite.via)
+}
+
+func (suite *LoopTestSuite) TestHopCounting() {
+	_, err := suite.usecase.Create(suite.ctx, suite.route("api-route", "api.example.com", suite.backend.URL))
+	assert.NoError(suite.T(), err)
+
+	get := func(config proxy.Config, via ...string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Host = "api.example.com"
+		for _, value := range via {
+			req.Header.Add("Via", value)
+		}
+		response := httptest.NewRecorder()
+		proxy.NewProxy(suite.usecase, config).ServeHTTP(response, req)
+		return response.Code
+	}
+
+	assert.Equal(suite.T(), http.StatusLoopDetected, get(proxy.Config{}, "1.1 route-portal"))
+	assert.Equal(suite.T(), http.StatusLoopDetected, get(proxy.Config{}, "HTTP/1.0 cdn, 1.1 Route-Portal (Go)"))
+	assert.Equal(suite.T(), http.StatusOK, get(proxy.Config{}, "1.1 route-portal-staging, 2 cdn"))
+
+	// Chained portals are told apart by their pseudonym or allowed more hops
+	assert.Equal(suite.T(), http.StatusOK, get(proxy.Config{ViaName: "edge-portal"}, "1.1 route-portal"))
+	assert.Equal(suite.T(), http.StatusOK, get(proxy.Config{MaxLoopHops: 2}, "1.1 route-portal"))
+	assert.Equal(suite.T(), http.StatusLoopDetected, get(proxy.Config{MaxLoopHops: 2}, "1.1 route-portal", "1.1 route-portal"))
+}
+
+func (suite *LoopTestSuite) TestRuntimeLoop() {
+	portal := httptest.NewServer(proxy.NewProxy(suite.usecase, proxy.Config{}))
+	defer portal.Close()
+
+	// Stored without the usecase validation, the proxy forward to itself
+	portalURL, err := url.Parse(portal.URL)
+	assert.NoError(suite.T(), err)
+	_, err = suite.repo.Create(suite.ctx, suite.route("self-route", portalURL.Hostname(), portal.URL))
+	assert.NoError(suite.T(), err)
+
+	response, err := http.Get(portal.URL)
+	assert.NoError(suite.T(), err)
+	response.Body.Close()
+	assert.Equal(suite.T(), http.StatusLoopDetected, response.StatusCode)
+}
+
+func TestLoopTestSuite(t *testing.T) {
+	suite.Run(t, new(LoopTestSuite))
+}
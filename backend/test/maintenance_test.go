@@ -0,0 +1,154 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"test/portal/domain"
+	"test/portal/internal/proxy"
+	routedelivery "test/portal/internal/route/delivery/http"
+	"test/portal/internal/route/repository/yaml"
+	"test/portal/internal/route/usecase"
+	"test/portal/pkg/httputils"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type MaintenanceTestSuite struct {
+	suite.Suite
+	repo     domain.RouteItemRepository
+	usecase  domain.RouteItemUsecase
+	ctx      context.Context
+	backend  *httptest.Server
+	delivery *routedelivery.RouteDelivery
+}
+
+func (suite *MaintenanceTestSuite) SetupTest() {
+	// Clean or recreate yaml file
+	os.Remove("./.data/routes.yaml")
+	file, err := os.Create("./.data/routes.yaml")
+	if err != nil {
+		log.Fatal("Failed to create test yaml file:", err)
+	}
+	file.Close()
+
+	suite.repo = yaml.NewRouteYamlRepository()
+	suite.usecase = usecase.NewRouteUsecase(suite.repo)
+	suite.ctx = context.Background()
+	suite.delivery = routedelivery.NewTestRouteDelivery(suite.ctx, newTestValidator(), suite.usecase)
+
+	suite.backend = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("backend"))
+	}))
+
+	isEnabled := true
+	_, err = suite.repo.Create(suite.ctx, domain.RouteItem{
+		Name:    "shop-route",
+		Host:    "shop.example.com",
+		Path:    "/",
+		Backend: suite.backend.URL,
+		Enabled: &isEnabled,
+	})
+	assert.NoError(suite.T(), err)
+}
+
+func (suite *MaintenanceTestSuite) TearDownTest() {
+	suite.backend.Close()
+}
+
+func (suite *MaintenanceTestSuite) setMaintenance(routeName string, maintenance any) *httptest.ResponseRecorder {
+	payload, err := json.Marshal(maintenance)
+	assert.NoError(suite.T(), err)
+
+	return httputils.HTTPTestRequest(suite.T(), httputils.HTTPTestConfig{
+		Method:  http.MethodPut,
+		Path:    "/routes/" + routeName + "/maintenance",
+		Payload: bytes.NewBuffer(payload),
+		HandlerFunc: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			suite.delivery.SetMaintenance(suite.ctx, w, r)
+		}),
+	})
+}
+
+func (suite *MaintenanceTestSuite) get(remoteAddr string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/cart", nil)
+	req.Host = "shop.example.com"
+	req.RemoteAddr = remoteAddr
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	response := httptest.NewRecorder()
+	proxy.NewProxy(suite.usecase, proxy.Config{}).ServeHTTP(response, req)
+	return response
+}
+
+func (suite *MaintenanceTestSuite) TestToggleMaintenance() {
+	response := suite.setMaintenance("shop-route", domain.RouteMaintenance{Enabled: true, RetryAfterSeconds: 120})
+	assert.Equal(suite.T(), http.StatusOK, response.Code)
+
+	// The rest of the route is untouched
+	route, err := suite.repo.GetOne(suite.ctx, "shop-route")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), suite.backend.URL, route.Backend)
+	assert.True(suite.T(), route.Maintenance.Enabled)
+
+	proxied := suite.get("192.0.2.10:4000", nil)
+	assert.Equal(suite.T(), http.StatusServiceUnavailable, proxied.Code)
+	assert.Equal(suite.T(), "120", proxied.Header().Get("Retry-After"))
+
+	var responseBody map[string]interface{}
+	assert.NoError(suite.T(), json.Unmarshal(proxied.Body.Bytes(), &responseBody))
+	assert.Equal(suite.T(), domain.ErrUnavailable, responseBody["message"])
+
+	response = suite.setMaintenance("shop-route", domain.RouteMaintenance{Enabled: false})
+	assert.Equal(suite.T(), http.StatusOK, response.Code)
+	assert.Equal(suite.T(), "backend", suite.get("192.0.2.10:4000", nil).Body.String())
+}
+
+func (suite *MaintenanceTestSuite) TestCustomPage() {
+	suite.setMaintenance("shop-route", domain.RouteMaintenance{
+		Enabled:     true,
+		ContentType: "text/html",
+		Body:        "<h1>Back soon</h1>",
+	})
+
+	response := suite.get("192.0.2.10:4000", nil)
+	assert.Equal(suite.T(), http.StatusServiceUnavailable, response.Code)
+	assert.Equal(suite.T(), "text/html; charset=utf-8", response.Header().Get("Content-Type"))
+	assert.Equal(suite.T(), "<h1>Back soon</h1>", response.Body.String())
+	assert.Empty(suite.T(), response.Header().Get("Retry-After"))
+}
+
+func (suite *MaintenanceTestSuite) TestBypass() {
+	suite.setMaintenance("shop-route", domain.RouteMaintenance{
+		Enabled:           true,
+		BypassCIDRs:       []string{"10.8.0.0/16"},
+		BypassHeader:      "X-Maintenance-Bypass",
+		BypassHeaderValue: "let-me-in",
+	})
+
+	assert.Equal(suite.T(), http.StatusOK, suite.get("10.8.1.2:4000", nil).Code)
+	assert.Equal(suite.T(), http.StatusOK, suite.get("192.0.2.10:4000", map[string]string{"X-Maintenance-Bypass": "let-me-in"}).Code)
+	assert.Equal(suite.T(), http.StatusServiceUnavailable, suite.get("192.0.2.10:4000", map[string]string{"X-Maintenance-Bypass": "wrong"}).Code)
+}
+
+func (suite *MaintenanceTestSuite) TestInvalidMaintenance() {
+	response := suite.setMaintenance("shop-route", domain.RouteMaintenance{Enabled: true, Body: "<h1>Back soon</h1>"})
+	assert.Equal(suite.T(), http.StatusBadRequest, response.Code)
+
+	response = suite.setMaintenance("shop-route", domain.RouteMaintenance{Enabled: true, BypassCIDRs: []string{"vpn"}})
+	assert.Equal(suite.T(), http.StatusBadRequest, response.Code)
+
+	response = suite.setMaintenance("unknown-route", domain.RouteMaintenance{Enabled: true})
+	assert.Equal(suite.T(), http.StatusNotFound, response.Code)
+}
+
+func TestMaintenanceTestSuite(t *testing.T) {
+	suite.Run(t, new(MaintenanceTestSuite))
+}
@@ -0,0 +1,224 @@
+package test
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"test/portal/domain"
+	"test/portal/internal/proxy"
+	"test/portal/internal/proxy/metrics"
+	"test/portal/internal/route/repository/yaml"
+	"test/portal/internal/route/usecase"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type MetricsTestSuite struct {
+	suite.Suite
+	repo     domain.RouteItemRepository
+	usecase  domain.RouteItemUsecase
+	ctx      context.Context
+	backend  *httptest.Server
+	registry *prometheus.Registry
+	proxy    *proxy.Proxy
+}
+
+func (suite *MetricsTestSuite) SetupTest() {
+	// Clean or recreate yaml file
+	os.Remove("./.data/routes.yaml")
+	file, err := os.Create("./.data/routes.yaml")
+	if err != nil {
+		log.Fatal("Failed to create test yaml file:", err)
+	}
+	file.Close()
+
+	suite.repo = yaml.NewRouteYamlRepository()
+	suite.usecase = usecase.NewRouteUsecase(suite.repo)
+	suite.ctx = context.Background()
+
+	suite.backend = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/orders/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		w.Write([]byte("orders"))
+	}))
+
+	suite.registry = prometheus.NewRegistry()
+	suite.proxy = proxy.NewProxy(suite.usecase, proxy.Config{Metrics: metrics.New(suite.registry)})
+	suite.registry.MustRegister(metrics.NewStateCollector(suite.usecase, suite.proxy))
+
+	isEnabled, isDisabled := true, false
+	_, err = suite.repo.Create(suite.ctx, domain.RouteItem{
+		Name:    "orders-route",
+		Host:    "orders.example.com",
+		Path:    "/orders",
+		Backend: suite.backend.URL,
+		Enabled: &isEnabled,
+	})
+	assert.NoError(suite.T(), err)
+	_, err = suite.repo.Create(suite.ctx, domain.RouteItem{
+		Name:     "down-route",
+		Host:     "orders.example.com",
+		Path:     "/down",
+		Backends: []domain.RouteBackend{{URL: "http://127.0.0.1:1"}},
+		Enabled:  &isEnabled,
+	})
+	assert.NoError(suite.T(), err)
+	_, err = suite.repo.Create(suite.ctx, domain.RouteItem{
+		Name:    "legacy-route",
+		Host:    "legacy.example.com",
+		Path:    "/",
+		Backend: suite.backend.URL,
+		Enabled: &isDisabled,
+	})
+	assert.NoError(suite.T(), err)
+}
+
+func (suite *MetricsTestSuite) TearDownTest() {
+	suite.backend.Close()
+}
+
+func (suite *MetricsTestSuite) get(path string) {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Host = "orders.example.com"
+	suite.proxy.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+// Metric of the family matching every given label
+func gatherMetric(t *testing.T, registry *prometheus.Registry, name string, labels map[string]string) *dto.Metric {
+	families, err := registry.Gather()
+	assert.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			matched := 0
+			for _, label := range metric.GetLabel() {
+				if value, found := labels[label.GetName()]; found && value == label.GetValue() {
+					matched++
+				}
+			}
+			if matched == len(labels) {
+				return metric
+			}
+		}
+	}
+	return nil
+}
+
+func (suite *MetricsTestSuite) metric(name string, labels map[string]string) *dto.Metric {
+	return gatherMetric(suite.T(), suite.registry, name, labels)
+}
+
+func (suite *MetricsTestSuite) TestRequestMetrics() {
+	suite.get("/orders/1")
+	suite.get("/orders/2")
+	suite.get("/orders/missing")
+
+	success := map[string]string{"route": "orders-route", "backend": suite.backend.URL, "status_class": "2xx"}
+	assert.Equal(suite.T(), 2.0, suite.metric("portal_proxy_requests_total", success).GetCounter().GetValue())
+	assert.Equal(suite.T(), uint64(2), suite.metric("portal_proxy_request_duration_seconds", success).GetHistogram().GetSampleCount())
+	assert.Equal(suite.T(), float64(2*len("orders")), suite.metric("portal_proxy_response_size_bytes", success).GetHistogram().GetSampleSum())
+
+	notFound := map[string]string{"route": "orders-route", "status_class": "4xx"}
+	assert.Equal(suite.T(), 1.0, suite.metric("portal_proxy_requests_total", notFound).GetCounter().GetValue())
+	assert.Equal(suite.T(), 0.0, suite.metric("portal_proxy_requests_in_flight", map[string]string{"route": "orders-route"}).GetGauge().GetValue())
+}
+
+func (suite *MetricsTestSuite) TestUpstreamErrorsAndHealth() {
+	suite.get("/down")
+	suite.get("/orders")
+
+	backend := map[string]string{"route": "down-route", "backend": "http://127.0.0.1:1"}
+	assert.Equal(suite.T(), 1.0, suite.metric("portal_proxy_upstream_errors_total", backend).GetCounter().GetValue())
+	assert.Equal(suite.T(), 1.0, suite.metric("portal_proxy_requests_total", map[string]string{"route": "down-route", "status_class": "5xx"}).GetCounter().GetValue())
+	assert.Equal(suite.T(), 0.0, suite.metric("portal_proxy_backend_healthy", backend).GetGauge().GetValue())
+	assert.Equal(suite.T(), 1.0, suite.metric("portal_proxy_backend_healthy", map[string]string{"route": "orders-route"}).GetGauge().GetValue())
+}
+
+func (suite *MetricsTestSuite) TestRouteState() {
+	suite.get("/orders")
+	assert.Equal(suite.T(), 2.0, suite.metric("portal_routes", map[string]string{"state": "enabled"}).GetGauge().GetValue())
+	assert.Equal(suite.T(), 1.0, suite.metric("portal_routes", map[string]string{"state": "disabled"}).GetGauge().GetValue())
+
+	// Deleted routes leave the health gauge
+	assert.NoError(suite.T(), suite.repo.Delete(suite.ctx, "orders-route"))
+	assert.Nil(suite.T(), suite.metric("portal_proxy_backend_healthy", map[string]string{"route": "orders-route"}))
+	assert.Equal(suite.T(), 1.0, suite.metric("portal_routes", map[string]string{"state": "enabled"}).GetGauge().GetValue())
+}
+
+func (suite *MetricsTestSuite) routesWithBalancer() []string {
+	routes := make([]string, 0)
+	for _, health := range suite.proxy.BackendHealth() {
+		routes = append(routes, health.Route)
+	}
+	return routes
+}
+
+func (suite *MetricsTestSuite) TestBalancersOfDeletedRoutes() {
+	suite.get("/down")
+	suite.get("/orders")
+	assert.ElementsMatch(suite.T(), []string{"down-route", "orders-route"}, suite.routesWithBalancer())
+
+	// The next request after the change drop the balancer of the deleted route
+	assert.NoError(suite.T(), suite.repo.Delete(suite.ctx, "down-route"))
+	suite.get("/orders")
+	assert.Equal(suite.T(), []string{"orders-route"}, suite.routesWithBalancer())
+}
+
+func (suite *MetricsTestSuite) TestBalancersWhileRoutesChange() {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					suite.get("/orders")
+					suite.get("/down")
+				}
+			}
+		}()
+	}
+
+	isEnabled := true
+	assert.NoError(suite.T(), suite.repo.Delete(suite.ctx, "down-route"))
+	_, err := suite.repo.Create(suite.ctx, domain.RouteItem{
+		Name:    "users-route",
+		Host:    "orders.example.com",
+		Path:    "/users",
+		Backend: suite.backend.URL,
+		Enabled: &isEnabled,
+	})
+	assert.NoError(suite.T(), err)
+	suite.get("/users")
+	close(done)
+	wg.Wait()
+
+	// Requests matched before the changes keep neither the deleted route
+	// balancer nor drop the one of the created route
+	suite.get("/orders")
+	assert.ElementsMatch(suite.T(), []string{"orders-route", "users-route"}, suite.routesWithBalancer())
+}
+
+func (suite *MetricsTestSuite) TestStatusClass() {
+	assert.Equal(suite.T(), "2xx", metrics.StatusClass(204))
+	assert.Equal(suite.T(), "5xx", metrics.StatusClass(502))
+	assert.Equal(suite.T(), "unknown", metrics.StatusClass(0))
+}
+
+func TestMetricsTestSuite(t *testing.T) {
+	suite.Run(t, new(MetricsTestSuite))
+}
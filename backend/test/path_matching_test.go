@@ -0,0 +1,302 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"test/portal/domain"
+	"test/portal/internal/proxy"
+	routedelivery "test/portal/internal/route/delivery/http"
+	"test/portal/internal/route/repository/yaml"
+	"test/portal/internal/route/usecase"
+	"test/portal/pkg/httputils"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type PathMatchingTestSuite struct {
+	suite.Suite
+	usecase domain.RouteItemUsecase
+	ctx     context.Context
+	backend *httptest.Server
+}
+
+func (suite *PathMatchingTestSuite) SetupTest() {
+	// Clean or recreate yaml file
+	os.Remove("./.data/routes.yaml")
+	file, err := os.Create("./.data/routes.yaml")
+	if err != nil {
+		log.Fatal("Failed to create test yaml file:", err)
+	}
+	file.Close()
+
+	suite.usecase = usecase.NewRouteUsecase(yaml.NewRouteYamlRepository())
+	suite.ctx = context.Background()
+
+	// Backend echo the path and the request target as received
+	suite.backend = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Backend-Path", r.URL.Path)
+		w.Header().Set("X-Backend-URI", r.RequestURI)
+	}))
+}
+
+func (suite *PathMatchingTestSuite) TearDownTest() {
+	suite.backend.Close()
+}
+
+func (suite *PathMatchingTestSuite) createRoute(name string, path string, pathMatching *domain.RoutePathMatching) {
+	isEnabled := true
+	_, err := suite.usecase.Create(suite.ctx, domain.RouteItem{
+		Name:         name,
+		Host:         "api.example.com",
+		Path:         path,
+		Backend:      suite.backend.URL,
+		Enabled:      &isEnabled,
+		PathMatching: pathMatching,
+	})
+	assert.NoError(suite.T(), err)
+}
+
+func (suite *PathMatchingTestSuite) request(method string, target string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	req.Host = "api.example.com"
+	response := httptest.NewRecorder()
+	proxy.NewProxy(suite.usecase, proxy.Config{}).ServeHTTP(response, req)
+	return response
+}
+
+// Route name the tester report for the path, empty when nothing match
+func (suite *PathMatchingTestSuite) tester(path string) (string, map[string]interface{}) {
+	delivery := routedelivery.NewTestRouteDelivery(suite.ctx, newTestValidator(), suite.usecase)
+	response := httputils.HTTPTestRequest(suite.T(), httputils.HTTPTestConfig{
+		Method: http.MethodGet,
+		Path:   "/match?host=api.example.com&path=" + url.QueryEscape(path),
+		HandlerFunc: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			delivery.MatchRoute(suite.ctx, w, r)
+		}),
+	})
+	if response.Code != http.StatusOK {
+		return "", nil
+	}
+	var responseBody map[string]interface{}
+	assert.NoError(suite.T(), json.Unmarshal(response.Body.Bytes(), &responseBody))
+	data := responseBody["data"].(map[string]interface{})
+	return data["route"].(map[string]interface{})["name"].(string), data
+}
+
+func (suite *PathMatchingTestSuite) TestCaseInsensitive() {
+	suite.createRoute("users", "/api/users/{id}", &domain.RoutePathMatching{CaseInsensitive: true})
+	suite.createRoute("orders", "/api/orders", nil)
+
+	response := suite.request(http.MethodGet, "/API/Users/AbC")
+	assert.Equal(suite.T(), http.StatusOK, response.Code)
+	// The backend get the path as sent, the parameter keep its case
+	assert.Equal(suite.T(), "/API/Users/AbC", response.Header().Get("X-Backend-Path"))
+	name, data := suite.tester("/API/Users/AbC")
+	assert.Equal(suite.T(), "users", name)
+	assert.Equal(suite.T(), "AbC", data["params"].(map[string]interface{})["id"])
+
+	assert.Equal(suite.T(), http.StatusNotFound, suite.request(http.MethodGet, "/API/Orders").Code)
+
+	// Only the ASCII case is folded, the Kelvin sign and the long s don't
+	// stand for k and s
+	assert.Equal(suite.T(), http.StatusNotFound, suite.request(http.MethodGet, "/api/u%C5%BFers/1").Code)
+	suite.createRoute("keys", "/api/keys", &domain.RoutePathMatching{CaseInsensitive: true})
+	assert.Equal(suite.T(), http.StatusNotFound, suite.request(http.MethodGet, "/api/%E2%84%AAeys").Code)
+	assert.Equal(suite.T(), http.StatusOK, suite.request(http.MethodGet, "/api/KEYS").Code)
+}
+
+func (suite *PathMatchingTestSuite) TestTrailingSlash() {
+	suite.createRoute("ignore", "/ignore", nil)
+	suite.createRoute("strict", "/strict", &domain.RoutePathMatching{TrailingSlash: domain.TrailingSlashStrict})
+	suite.createRoute("strict-dir", "/strict-dir/", &domain.RoutePathMatching{TrailingSlash: domain.TrailingSlashStrict})
+	suite.createRoute("redirect", "/redirect", &domain.RoutePathMatching{TrailingSlash: domain.TrailingSlashRedirect})
+	suite.createRoute("redirect-dir", "/docs/{page}/", &domain.RoutePathMatching{TrailingSlash: domain.TrailingSlashRedirect})
+	suite.createRoute("files", "/files/*", &domain.RoutePathMatching{TrailingSlash: domain.TrailingSlashStrict})
+
+	for path, expected := range map[string]int{
+		"/ignore":          http.StatusOK,
+		"/ignore/":         http.StatusOK,
+		"/strict":          http.StatusOK,
+		"/strict/":         http.StatusNotFound,
+		"/strict/users":    http.StatusOK,
+		"/strict-dir/":     http.StatusOK,
+		"/strict-dir":      http.StatusNotFound,
+		"/strict-dir/x":    http.StatusOK,
+		"/redirect":        http.StatusOK,
+		"/redirect/":       http.StatusMovedPermanently,
+		"/docs/intro/":     http.StatusOK,
+		"/docs/intro":      http.StatusMovedPermanently,
+		"/files":           http.StatusOK,
+		"/files/":          http.StatusOK,
+		"/files/a/b.txt":   http.StatusOK,
+		"/redirect/x/../":  http.StatusOK,
+		"/docs/intro/more": http.StatusOK,
+	} {
+		assert.Equal(suite.T(), expected, suite.request(http.MethodGet, path).Code, path)
+		name, _ := suite.tester(path)
+		assert.Equal(suite.T(), expected == http.StatusNotFound, name == "", path)
+	}
+
+	// The query is kept and other methods are redirected with a 308
+	response := suite.request(http.MethodGet, "/redirect/?page=2")
+	assert.Equal(suite.T(), "/redirect?page=2", response.Header().Get("Location"))
+	response = suite.request(http.MethodPost, "/docs/intro?x=1")
+	assert.Equal(suite.T(), http.StatusPermanentRedirect, response.Code)
+	assert.Equal(suite.T(), "/docs/intro/?x=1", response.Header().Get("Location"))
+	_, data := suite.tester("/redirect/?page=2")
+	assert.Equal(suite.T(), "/redirect?page=2", data["redirect"])
+}
+
+func (suite *PathMatchingTestSuite) TestRedirectStayOnHost() {
+	suite.createRoute("site", "/{site}", &domain.RoutePathMatching{TrailingSlash: domain.TrailingSlashRedirect, MergeSlashes: true})
+	suite.createRoute("empty", "//evil-com", &domain.RoutePathMatching{TrailingSlash: domain.TrailingSlashRedirect})
+
+	redirected := 0
+	for _, path := range []string{"//evil.com/", "///evil.com/", "/%2F%2Fevil.com/", "/%5Cevil.com/", "//evil-com/"} {
+		response := suite.request(http.MethodGet, path)
+		if response.Code != http.StatusMovedPermanently {
+			continue
+		}
+		redirected++
+		location := response.Header().Get("Location")
+		assert.Regexp(suite.T(), `^/[^/\\]`, location, path)
+		parsed, err := url.Parse(location)
+		assert.NoError(suite.T(), err)
+		assert.Empty(suite.T(), parsed.Host, path)
+	}
+	assert.GreaterOrEqual(suite.T(), redirected, 3)
+}
+
+func (suite *PathMatchingTestSuite) TestMergeSlashes() {
+	suite.createRoute("users", "/api/users", &domain.RoutePathMatching{MergeSlashes: true})
+	suite.createRoute("orders", "/api/orders", nil)
+
+	// The backend get the path the route matched
+	response := suite.request(http.MethodGet, "//api///users//42")
+	assert.Equal(suite.T(), http.StatusOK, response.Code)
+	assert.Equal(suite.T(), "/api/users/42", response.Header().Get("X-Backend-URI"))
+	_, data := suite.tester("//api///users//42")
+	assert.Equal(suite.T(), "/api/users/42", data["path"])
+
+	assert.Equal(suite.T(), http.StatusNotFound, suite.request(http.MethodGet, "/api//orders").Code)
+
+	// Encoded slashes are not merged
+	assert.Equal(suite.T(), http.StatusNotFound, suite.request(http.MethodGet, "/api/%2F/users").Code)
+}
+
+func (suite *PathMatchingTestSuite) TestDecodePercent() {
+	suite.createRoute("users", "/api/users/{id}", &domain.RoutePathMatching{DecodePercent: true})
+
+	// Unreserved characters are decoded
+	response := suite.request(http.MethodGet, "/api/%75sers/%34%32")
+	assert.Equal(suite.T(), http.StatusOK, response.Code)
+	assert.Equal(suite.T(), "/api/users/42", response.Header().Get("X-Backend-URI"))
+	name, data := suite.tester("/api/%75sers/%34%32")
+	assert.Equal(suite.T(), "users", name)
+	assert.Equal(suite.T(), "42", data["params"].(map[string]interface{})["id"])
+
+	// Encoded slashes, backslashes and percent signs stay encoded and in
+	// their segment, so the backend never decode the path twice
+	response = suite.request(http.MethodGet, "/api/users/a%2fb")
+	assert.Equal(suite.T(), http.StatusOK, response.Code)
+	assert.Equal(suite.T(), "/api/users/a%2Fb", response.Header().Get("X-Backend-URI"))
+	response = suite.request(http.MethodGet, "/api/users/..%5Cadmin")
+	assert.Equal(suite.T(), "/api/users/..%5Cadmin", response.Header().Get("X-Backend-URI"))
+	response = suite.request(http.MethodGet, "/api/users/%252e%252e")
+	assert.Equal(suite.T(), "/api/users/%252e%252e", response.Header().Get("X-Backend-URI"))
+	_, data = suite.tester("/api/users/%252e%252e")
+	assert.Equal(suite.T(), "%252e%252e", data["params"].(map[string]interface{})["id"])
+
+	// Other characters are escaped again for the backend
+	response = suite.request(http.MethodGet, "/api/users/%E2%9C%93%20x")
+	assert.Equal(suite.T(), "/api/users/%E2%9C%93%20x", response.Header().Get("X-Backend-URI"))
+
+	for _, path := range []string{
+		// Dot segments, encoded or not
+		"/api/users/%2e%2e",
+		"/api/users/%2E",
+		"/api/users/1/%2e%2e/%2e%2e/admin",
+		"/api/users/1/../2",
+		// Control characters
+		"/api/users/%00",
+		"/api/users/1%0d%0aX-Admin:%20true",
+		"/api/users/%7f",
+		// Overlong and invalid UTF-8
+		"/api/users/%C0%AE%C0%AE",
+		"/api/users/%FF",
+	} {
+		assert.Equal(suite.T(), http.StatusNotFound, suite.request(http.MethodGet, path).Code, path)
+		name, _ := suite.tester(path)
+		assert.Empty(suite.T(), name, path)
+	}
+
+	// Without the option the path is matched as net/http decode it
+	suite.createRoute("orders", "/api/orders/{id}", nil)
+	response = suite.request(http.MethodGet, "/api/orders/a%2Fb")
+	assert.Equal(suite.T(), "/api/orders/a%2Fb", response.Header().Get("X-Backend-URI"))
+	_, data = suite.tester("/api/orders/a%2Fb")
+	assert.Equal(suite.T(), "a", data["params"].(map[string]interface{})["id"])
+}
+
+func (suite *PathMatchingTestSuite) TestCombinedOptions() {
+	route := domain.RoutePathMatching{CaseInsensitive: true, TrailingSlash: domain.TrailingSlashRedirect, MergeSlashes: true, DecodePercent: true}
+	suite.createRoute("users", "/api/users", &route)
+
+	response := suite.request(http.MethodGet, "//API/%55sers//")
+	assert.Equal(suite.T(), http.StatusMovedPermanently, response.Code)
+	assert.Equal(suite.T(), "/API/Users", response.Header().Get("Location"))
+
+	response = suite.request(http.MethodGet, "/API//%55sers/%34%32")
+	assert.Equal(suite.T(), http.StatusOK, response.Code)
+	assert.Equal(suite.T(), "/API/Users/42", response.Header().Get("X-Backend-URI"))
+}
+
+func (suite *PathMatchingTestSuite) TestTesterRequests() {
+	suite.createRoute("users", "/api/users", nil)
+
+	delivery := routedelivery.NewTestRouteDelivery(suite.ctx, newTestValidator(), suite.usecase)
+	test := func(query string) int {
+		return httputils.HTTPTestRequest(suite.T(), httputils.HTTPTestConfig{
+			Method: http.MethodGet,
+			Path:   "/match?" + query,
+			HandlerFunc: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				delivery.MatchRoute(suite.ctx, w, r)
+			}),
+		}).Code
+	}
+	assert.Equal(suite.T(), http.StatusOK, test("host=api.example.com&path=/api/users"))
+	assert.Equal(suite.T(), http.StatusNotFound, test("host=api.example.com&path=/api/orders"))
+	assert.Equal(suite.T(), http.StatusNotFound, test("host=other.example.com&path=/api/users"))
+	assert.Equal(suite.T(), http.StatusBadRequest, test("host=api.example.com"))
+	assert.Equal(suite.T(), http.StatusBadRequest, test("host=api.example.com&path=api/users"))
+	assert.Equal(suite.T(), http.StatusBadRequest, test("host=api.example.com&path="+url.QueryEscape("/api/%zz")))
+}
+
+func (suite *PathMatchingTestSuite) TestValidation() {
+	validate := newTestValidator()
+	isEnabled := true
+	route := domain.RouteItem{
+		Name: "users", Host: "api.example.com", Path: "/api/users", Backend: suite.backend.URL, Enabled: &isEnabled,
+		PathMatching: &domain.RoutePathMatching{TrailingSlash: "sometimes"},
+	}
+	assert.Error(suite.T(), validate.Struct(route))
+	route.PathMatching.TrailingSlash = domain.TrailingSlashRedirect
+	assert.NoError(suite.T(), validate.Struct(route))
+
+	// Shapes differing by their case conflict when one route ignore it
+	suite.createRoute("users", "/Users/{id}", &domain.RoutePathMatching{CaseInsensitive: true})
+	route = domain.RouteItem{Name: "members", Host: "api.example.com", Path: "/users/{name}", Backend: suite.backend.URL, Enabled: &isEnabled}
+	_, err := suite.usecase.Create(suite.ctx, route)
+	assert.ErrorContains(suite.T(), err, domain.ErrBadRequest)
+}
+
+func TestPathMatchingTestSuite(t *testing.T) {
+	suite.Run(t, new(PathMatchingTestSuite))
+}
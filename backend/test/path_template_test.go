@@ -0,0 +1,213 @@
+package test
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"test/portal/domain"
+	"test/portal/internal/proxy"
+	routematch "test/portal/internal/route/match"
+	"test/portal/internal/route/repository/yaml"
+	"test/portal/internal/route/usecase"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type PathTemplateTestSuite struct {
+	suite.Suite
+	usecase domain.RouteItemUsecase
+	ctx     context.Context
+	backend *httptest.Server
+}
+
+func (suite *PathTemplateTestSuite) SetupTest() {
+	// Clean or recreate yaml file
+	os.Remove("./.data/routes.yaml")
+	file, err := os.Create("./.data/routes.yaml")
+	if err != nil {
+		log.Fatal("Failed to create test yaml file:", err)
+	}
+	file.Close()
+
+	suite.usecase = usecase.NewRouteUsecase(yaml.NewRouteYamlRepository())
+	suite.ctx = context.Background()
+
+	// Backend echo the path and the injected headers
+	suite.backend = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Backend-Path", r.URL.Path)
+		w.Header().Set("X-Backend-User", r.Header.Get("X-User-ID"))
+		w.Header().Set("X-Backend-Tenant", r.Header.Get("X-Tenant"))
+	}))
+}
+
+func (suite *PathTemplateTestSuite) TearDownTest() {
+	suite.backend.Close()
+}
+
+func (suite *PathTemplateTestSuite) route(name string, path string) domain.RouteItem {
+	isEnabled := true
+	return domain.RouteItem{Name: name, Host: "api.example.com", Path: path, Backend: suite.backend.URL, Enabled: &isEnabled}
+}
+
+func (suite *PathTemplateTestSuite) TestValidation() {
+	validate := newTestValidator()
+	for _, path := range []string{"/", "/api", "/api/", "/users/{id}", "/users/{id}/orders/{order_id}", "/static/*", "/{tenant}/files/*", "/*"} {
+		assert.NoError(suite.T(), validate.Struct(suite.route("valid-route", path)), path)
+	}
+	for _, path := range []string{"api", "/users/{id", "/users/{1d}", "/users/{}", "/users/id}", "/users/x{id}", "/static/*/x", "/static/*.css", "/{id}/{id}", "/users/{id}/../admin", "/api?x=1"} {
+		assert.Error(suite.T(), validate.Struct(suite.route("invalid-route", path)), path)
+	}
+}
+
+func (suite *PathTemplateTestSuite) match(routes []domain.RouteItem, path string) *domain.RouteMatch {
+	requestURL, err := url.ParseRequestURI(path)
+	assert.NoError(suite.T(), err)
+	return routematch.Route(routes, "api.example.com", requestURL)
+}
+
+func (suite *PathTemplateTestSuite) TestMatching() {
+	routes := []domain.RouteItem{
+		suite.route("users", "/users/{id}"),
+		suite.route("me", "/users/me"),
+		suite.route("orders", "/users/{id}/orders"),
+		suite.route("order", "/users/{user}/orders/{order}"),
+		suite.route("static", "/static/*"),
+		suite.route("assets", "/static/assets"),
+	}
+
+	match := suite.match(routes, "/users/42")
+	assert.Equal(suite.T(), "users", match.Route.Name)
+	assert.Equal(suite.T(), map[string]string{"id": "42"}, match.Params)
+
+	// Literal segments win over parameters
+	assert.Equal(suite.T(), "me", suite.match(routes, "/users/me").Route.Name)
+	assert.Equal(suite.T(), "orders", suite.match(routes, "/users/me/orders").Route.Name)
+
+	match = suite.match(routes, "/users/42/orders/7/items")
+	assert.Equal(suite.T(), "order", match.Route.Name)
+	assert.Equal(suite.T(), map[string]string{"user": "42", "order": "7"}, match.Params)
+	assert.Equal(suite.T(), "/items", match.Rest)
+
+	// Like literal paths the templates match on segment boundary
+	match = suite.match(routes, "/users/42/profile")
+	assert.Equal(suite.T(), "users", match.Route.Name)
+	assert.Equal(suite.T(), "/profile", match.Rest)
+	assert.Nil(suite.T(), suite.match(routes, "/users"))
+	assert.Nil(suite.T(), suite.match(routes, "/users/"))
+	assert.Nil(suite.T(), suite.match(routes, "/userss/42"))
+
+	match = suite.match(routes, "/static/css/site.css")
+	assert.Equal(suite.T(), "static", match.Route.Name)
+	assert.Equal(suite.T(), "css/site.css", match.Params["*"])
+	assert.Equal(suite.T(), "", suite.match(routes, "/static").Params["*"])
+	assert.Equal(suite.T(), "assets", suite.match(routes, "/static/assets/logo.png").Route.Name)
+
+	// Dot segments are never captured
+	assert.Nil(suite.T(), suite.match(routes, "/users/../admin"))
+	assert.Nil(suite.T(), suite.match(routes, "/static/css/../../admin"))
+	assert.Nil(suite.T(), suite.match(routes, "/users//orders"))
+}
+
+func (suite *PathTemplateTestSuite) get(path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Host = "api.example.com"
+	response := httptest.NewRecorder()
+	proxy.NewProxy(suite.usecase, proxy.Config{}).ServeHTTP(response, req)
+	return response
+}
+
+func (suite *PathTemplateTestSuite) TestRewriteAndHeaders() {
+	route := suite.route("orders", "/users/{id}/orders")
+	route.RewritePath = "/v2/orders"
+	route.RequestHeaders = map[string]string{"X-User-ID": "{id}"}
+	_, err := suite.usecase.Create(suite.ctx, route)
+	assert.NoError(suite.T(), err)
+
+	route = suite.route("files", "/{tenant}/files/*")
+	route.RewritePath = "/storage/{tenant}/{*}"
+	route.RequestHeaders = map[string]string{"X-Tenant": "tenant={tenant}"}
+	_, err = suite.usecase.Create(suite.ctx, route)
+	assert.NoError(suite.T(), err)
+
+	// The rest of the request path is appended
+	response := suite.get("/users/42/orders/7")
+	assert.Equal(suite.T(), http.StatusOK, response.Code)
+	assert.Equal(suite.T(), "/v2/orders/7", response.Header().Get("X-Backend-Path"))
+	assert.Equal(suite.T(), "42", response.Header().Get("X-Backend-User"))
+
+	response = suite.get("/acme/files/reports/2025/q1.pdf")
+	assert.Equal(suite.T(), "/storage/acme/reports/2025/q1.pdf", response.Header().Get("X-Backend-Path"))
+	assert.Equal(suite.T(), "tenant=acme", response.Header().Get("X-Backend-Tenant"))
+
+	// Encoded characters stay in their segment
+	response = suite.get("/users/a%2Fb/orders")
+	assert.Equal(suite.T(), http.StatusNotFound, response.Code)
+	response = suite.get("/users/%E2%9C%93/orders")
+	assert.Equal(suite.T(), "/v2/orders", response.Header().Get("X-Backend-Path"))
+	assert.Equal(suite.T(), "✓", response.Header().Get("X-Backend-User"))
+
+	// A captured control character never reach the headers
+	response = suite.get("/users/42%0D%0AX-Admin:%20true/orders")
+	assert.Equal(suite.T(), http.StatusOK, response.Code)
+	assert.Empty(suite.T(), response.Header().Get("X-Backend-User"))
+}
+
+func (suite *PathTemplateTestSuite) TestTemplateValidation() {
+	route := suite.route("orders", "/users/{id}/orders")
+	route.RewritePath = "/v2/{user}/orders"
+	_, err := suite.usecase.Create(suite.ctx, route)
+	assert.ErrorContains(suite.T(), err, domain.ErrBadRequest)
+
+	route.RewritePath = ""
+	route.RequestHeaders = map[string]string{"X-Order": "{*}"}
+	_, err = suite.usecase.Create(suite.ctx, route)
+	assert.ErrorContains(suite.T(), err, domain.ErrBadRequest)
+
+	route.RequestHeaders = map[string]string{"X-User": "{id}\r\nX-Admin: true"}
+	_, err = suite.usecase.Create(suite.ctx, route)
+	assert.ErrorContains(suite.T(), err, domain.ErrBadRequest)
+
+	route = suite.route("site", "/sites/{site}")
+	route.Backend = ""
+	route.Static = &domain.RouteStatic{Directory: "site"}
+	_, err = suite.usecase.Create(suite.ctx, route)
+	assert.ErrorContains(suite.T(), err, "Static routes can't have path parameters")
+}
+
+func (suite *PathTemplateTestSuite) TestConflicts() {
+	_, err := suite.usecase.Create(suite.ctx, suite.route("users", "/users/{id}"))
+	assert.NoError(suite.T(), err)
+	_, err = suite.usecase.Create(suite.ctx, suite.route("static", "/static/*"))
+	assert.NoError(suite.T(), err)
+
+	for _, path := range []string{"/users/{name}", "/users/{user_id}/", "/static", "/static/"} {
+		_, err := suite.usecase.Create(suite.ctx, suite.route("conflict", path))
+		assert.ErrorContains(suite.T(), err, domain.ErrBadRequest, path)
+	}
+
+	// More or less specific templates are fine, as are other hosts
+	for _, path := range []string{"/users/me", "/users/{id}/orders", "/{section}/{id}", "/static/{file}"} {
+		_, err := suite.usecase.Create(suite.ctx, suite.route("other", path))
+		assert.NoError(suite.T(), err, path)
+		assert.NoError(suite.T(), suite.usecase.Delete(suite.ctx, "other"))
+	}
+	route := suite.route("other", "/users/{name}")
+	route.Host = "admin.example.com"
+	_, err = suite.usecase.Create(suite.ctx, route)
+	assert.NoError(suite.T(), err)
+
+	// Updating a route doesn't conflict with itself
+	_, err = suite.usecase.Update(suite.ctx, suite.route("users", "/users/{user_id}"))
+	assert.NoError(suite.T(), err)
+	_, err = suite.usecase.Update(suite.ctx, suite.route("static", "/users/{key}"))
+	assert.ErrorContains(suite.T(), err, domain.ErrBadRequest)
+}
+
+func TestPathTemplateTestSuite(t *testing.T) {
+	suite.Run(t, new(PathTemplateTestSuite))
+}
@@ -0,0 +1,189 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"test/portal/domain"
+	"test/portal/internal/proxy"
+	"test/portal/internal/route/repository/yaml"
+	"test/portal/internal/route/usecase"
+	"test/portal/pkg/iputils"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ProxyTestSuite struct {
+	suite.Suite
+	repo    domain.RouteItemRepository
+	usecase domain.RouteItemUsecase
+	ctx     context.Context
+	backend *httptest.Server
+}
+
+func (suite *ProxyTestSuite) SetupTest() {
+	// Clean or recreate yaml file
+	os.Remove("./.data/routes.yaml")
+	file, err := os.Create("./.data/routes.yaml")
+	if err != nil {
+		log.Fatal("Failed to create test yaml file:", err)
+	}
+	file.Close()
+
+	suite.repo = yaml.NewRouteYamlRepository()
+	suite.usecase = usecase.NewRouteUsecase(suite.repo)
+	suite.ctx = context.Background()
+
+	// Backend echo the path and the forwarded client address
+	suite.backend = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Backend-Path", r.URL.Path)
+		w.Header().Set("X-Backend-Forwarded-For", r.Header.Get("X-Forwarded-For"))
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("backend"))
+	}))
+}
+
+func (suite *ProxyTestSuite) TearDownTest() {
+	suite.backend.Close()
+}
+
+func (suite *ProxyTestSuite) createRoute(route domain.RouteItem) {
+	isEnabled := true
+	if route.Enabled == nil {
+		route.Enabled = &isEnabled
+	}
+	if route.Backend == "" {
+		route.Backend = suite.backend.URL
+	}
+	_, err := suite.repo.Create(suite.ctx, route)
+	assert.NoError(suite.T(), err)
+}
+
+func (suite *ProxyTestSuite) newProxy(trusted ...string) *proxy.Proxy {
+	trustedProxies, err := iputils.ParsePrefixes(trusted)
+	assert.NoError(suite.T(), err)
+	return proxy.NewProxy(suite.usecase, proxy.Config{TrustedProxies: trustedProxies})
+}
+
+func (suite *ProxyTestSuite) doRequest(handler http.Handler, host, path, remoteAddr string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Host = host
+	req.RemoteAddr = remoteAddr
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, req)
+	return response
+}
+
+func (suite *ProxyTestSuite) TestForwardToBackend() {
+	suite.createRoute(domain.RouteItem{Name: "api-route", Host: "api.example.com", Path: "/api"})
+
+	response := suite.doRequest(suite.newProxy(), "api.example.com:8000", "/api/users", "192.0.2.10:5000", nil)
+
+	assert.Equal(suite.T(), http.StatusOK, response.Code)
+	assert.Equal(suite.T(), "backend", response.Body.String())
+	assert.Equal(suite.T(), "/api/users", response.Header().Get("X-Backend-Path"))
+}
+
+func (suite *ProxyTestSuite) TestLongestPathWins() {
+	suite.createRoute(domain.RouteItem{Name: "root-route", Host: "api.example.com", Path: "/", Backend: "http://127.0.0.1:1"})
+	suite.createRoute(domain.RouteItem{Name: "api-route", Host: "api.example.com", Path: "/api"})
+
+	response := suite.doRequest(suite.newProxy(), "api.example.com", "/api/users", "192.0.2.10:5000", nil)
+	assert.Equal(suite.T(), http.StatusOK, response.Code)
+
+	response = suite.doRequest(suite.newProxy(), "api.example.com", "/apis", "192.0.2.10:5000", nil)
+	assert.Equal(suite.T(), http.StatusBadGateway, response.Code)
+}
+
+func (suite *ProxyTestSuite) TestUnknownAndDisabledRoute() {
+	isEnabled := false
+	suite.createRoute(domain.RouteItem{Name: "disabled-route", Host: "off.example.com", Path: "/", Enabled: &isEnabled})
+
+	response := suite.doRequest(suite.newProxy(), "off.example.com", "/", "192.0.2.10:5000", nil)
+	assert.Equal(suite.T(), http.StatusNotFound, response.Code)
+
+	response = suite.doRequest(suite.newProxy(), "unknown.example.com", "/", "192.0.2.10:5000", nil)
+	assert.Equal(suite.T(), http.StatusNotFound, response.Code)
+}
+
+func (suite *ProxyTestSuite) TestAllowList() {
+	suite.createRoute(domain.RouteItem{
+		Name:       "admin-route",
+		Host:       "admin.example.com",
+		Path:       "/",
+		AllowCIDRs: []string{"10.8.0.0/16", "fd00::/8"},
+	})
+	handler := suite.newProxy()
+
+	response := suite.doRequest(handler, "admin.example.com", "/", "10.8.1.2:4000", nil)
+	assert.Equal(suite.T(), http.StatusOK, response.Code)
+
+	response = suite.doRequest(handler, "admin.example.com", "/", "[fd00::1]:4000", nil)
+	assert.Equal(suite.T(), http.StatusOK, response.Code)
+
+	response = suite.doRequest(handler, "admin.example.com", "/", "192.0.2.10:4000", nil)
+	assert.Equal(suite.T(), http.StatusForbidden, response.Code)
+
+	var responseBody map[string]interface{}
+	err := json.Unmarshal(response.Body.Bytes(), &responseBody)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), domain.ErrForbidden, responseBody["message"])
+	assert.Equal(suite.T(), float64(403), responseBody["status"])
+}
+
+func (suite *ProxyTestSuite) TestDenyWinsOverAllow() {
+	suite.createRoute(domain.RouteItem{
+		Name:       "admin-route",
+		Host:       "admin.example.com",
+		Path:       "/",
+		AllowCIDRs: []string{"10.8.0.0/16"},
+		DenyCIDRs:  []string{"10.8.5.0/24", "10.8.9.9"},
+	})
+	handler := suite.newProxy()
+
+	response := suite.doRequest(handler, "admin.example.com", "/", "10.8.5.20:4000", nil)
+	assert.Equal(suite.T(), http.StatusForbidden, response.Code)
+
+	response = suite.doRequest(handler, "admin.example.com", "/", "10.8.9.9:4000", nil)
+	assert.Equal(suite.T(), http.StatusForbidden, response.Code)
+
+	response = suite.doRequest(handler, "admin.example.com", "/", "10.8.9.10:4000", nil)
+	assert.Equal(suite.T(), http.StatusOK, response.Code)
+}
+
+func (suite *ProxyTestSuite) TestForwardedForOnlyFromTrustedProxy() {
+	suite.createRoute(domain.RouteItem{
+		Name:       "admin-route",
+		Host:       "admin.example.com",
+		Path:       "/",
+		AllowCIDRs: []string{"10.8.0.0/16"},
+	})
+	handler := suite.newProxy("172.16.0.0/12")
+
+	// Spoofed header from an untrusted peer is ignored
+	response := suite.doRequest(handler, "admin.example.com", "/", "192.0.2.10:4000",
+		map[string]string{"X-Forwarded-For": "10.8.1.2"})
+	assert.Equal(suite.T(), http.StatusForbidden, response.Code)
+
+	// Trusted load balancer reporting a VPN client
+	response = suite.doRequest(handler, "admin.example.com", "/", "172.16.0.5:4000",
+		map[string]string{"X-Forwarded-For": "10.8.1.2, 172.16.0.9"})
+	assert.Equal(suite.T(), http.StatusOK, response.Code)
+
+	// Client prepend a fake VPN address, the right most untrusted hop is used
+	response = suite.doRequest(handler, "admin.example.com", "/", "172.16.0.5:4000",
+		map[string]string{"X-Forwarded-For": "10.8.1.2, 192.0.2.10"})
+	assert.Equal(suite.T(), http.StatusForbidden, response.Code)
+}
+
+func TestProxyTestSuite(t *testing.T) {
+	suite.Run(t, new(ProxyTestSuite))
+}
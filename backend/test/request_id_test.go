@@ -0,0 +1,169 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"test/portal/domain"
+	"test/portal/internal/proxy"
+	routedelivery "test/portal/internal/route/delivery/http"
+	"test/portal/internal/route/repository/yaml"
+	"test/portal/internal/route/usecase"
+	"test/portal/pkg/httputils"
+	"test/portal/pkg/logutils"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type RequestIDTestSuite struct {
+	suite.Suite
+	repo     domain.RouteItemRepository
+	usecase  domain.RouteItemUsecase
+	ctx      context.Context
+	delivery *routedelivery.RouteDelivery
+	backend  *httptest.Server
+	received string
+}
+
+func (suite *RequestIDTestSuite) SetupTest() {
+	// Clean or recreate yaml file
+	os.Remove("./.data/routes.yaml")
+	file, err := os.Create("./.data/routes.yaml")
+	if err != nil {
+		log.Fatal("Failed to create test yaml file:", err)
+	}
+	file.Close()
+
+	suite.repo = yaml.NewRouteYamlRepository()
+	suite.usecase = usecase.NewRouteUsecase(suite.repo)
+	suite.ctx = context.Background()
+	suite.delivery = routedelivery.NewTestRouteDelivery(suite.ctx, newTestValidator(), suite.usecase)
+
+	suite.received = ""
+	suite.backend = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		suite.received = r.Header.Get("X-Request-ID")
+	}))
+
+	isEnabled := true
+	_, err = suite.repo.Create(suite.ctx, domain.RouteItem{
+		Name:    "orders-route",
+		Host:    "orders.example.com",
+		Path:    "/orders",
+		Backend: suite.backend.URL,
+		Enabled: &isEnabled,
+	})
+	assert.NoError(suite.T(), err)
+}
+
+func (suite *RequestIDTestSuite) TearDownTest() {
+	suite.backend.Close()
+}
+
+func (suite *RequestIDTestSuite) getRoute(name string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	response := httputils.HTTPTestRequest(suite.T(), httputils.HTTPTestConfig{
+		Method: http.MethodGet,
+		Path:   "/routes/" + name,
+		HandlerFunc: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			httputils.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				suite.delivery.GetOne(suite.ctx, w, r)
+			})).ServeHTTP(w, r)
+		}),
+	})
+	var responseBody map[string]interface{}
+	assert.NoError(suite.T(), json.Unmarshal(response.Body.Bytes(), &responseBody))
+	return response, responseBody
+}
+
+func (suite *RequestIDTestSuite) TestEnvelope() {
+	response, responseBody := suite.getRoute("orders-route")
+	generated := response.Header().Get("X-Request-ID")
+	assert.Len(suite.T(), generated, 32)
+	assert.Equal(suite.T(), generated, responseBody["requestId"])
+
+	// Without the middleware the envelope is unchanged
+	plain := httptest.NewRecorder()
+	httputils.WriteErrorResponse(plain, errors.New(domain.ErrBadRequest))
+	assert.NotContains(suite.T(), plain.Body.String(), "requestId")
+}
+
+func (suite *RequestIDTestSuite) TestAcceptOrReplace() {
+	handler := httputils.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(suite.T(), r.Header.Get("X-Request-ID"), httputils.RequestIDFrom(r.Context()))
+		httputils.WriteErrorResponse(w, errors.New(domain.ErrBadRequest))
+	}))
+
+	for requestID, kept := range map[string]bool{
+		"req-42":                               true,
+		"4bf92f35-77b3-4da6-a3ce-929d0e0e4736": true,
+		"bad\nid":                              false,
+		"<script>":                             false,
+		strings.Repeat("a", 129):               false,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/routes", nil)
+		req.Header.Set("X-Request-ID", requestID)
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, req)
+
+		var responseBody map[string]interface{}
+		assert.NoError(suite.T(), json.Unmarshal(response.Body.Bytes(), &responseBody))
+		assert.Equal(suite.T(), response.Header().Get("X-Request-ID"), responseBody["requestId"])
+		assert.Equal(suite.T(), kept, response.Header().Get("X-Request-ID") == requestID, requestID)
+	}
+}
+
+func (suite *RequestIDTestSuite) TestProxy() {
+	handler := httputils.RequestID(proxy.NewProxy(suite.usecase, proxy.Config{}))
+
+	req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	req.Host = "orders.example.com"
+	req.Header.Set("X-Request-ID", "req-42")
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, req)
+	assert.Equal(suite.T(), "req-42", suite.received)
+	assert.Equal(suite.T(), "req-42", response.Header().Get("X-Request-ID"))
+
+	// Generated when missing, the proxy own errors carry it too
+	req = httptest.NewRequest(http.MethodGet, "/unknown", nil)
+	req.Host = "orders.example.com"
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, req)
+	var responseBody map[string]interface{}
+	assert.NoError(suite.T(), json.Unmarshal(response.Body.Bytes(), &responseBody))
+	assert.Equal(suite.T(), float64(http.StatusNotFound), responseBody["status"])
+	assert.Equal(suite.T(), response.Header().Get("X-Request-ID"), responseBody["requestId"])
+}
+
+func (suite *RequestIDTestSuite) TestLogs() {
+	output := &bytes.Buffer{}
+	logger, err := logutils.NewLogger(output, "info", "json")
+	assert.NoError(suite.T(), err)
+	previous := slog.Default()
+	slog.SetDefault(logger)
+	defer slog.SetDefault(previous)
+
+	route, _ := suite.repo.GetOne(suite.ctx, "orders-route")
+	route.Backend = "http://127.0.0.1:1"
+	_, err = suite.repo.Update(suite.ctx, *route)
+	assert.NoError(suite.T(), err)
+
+	req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	req.Host = "orders.example.com"
+	req.Header.Set("X-Request-ID", "req-42")
+	httputils.RequestID(proxy.NewProxy(suite.usecase, proxy.Config{})).ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Contains(suite.T(), output.String(), `"msg":"Failed proxy request"`)
+	assert.Contains(suite.T(), output.String(), `"request_id":"req-42"`)
+}
+
+func TestRequestIDTestSuite(t *testing.T) {
+	suite.Run(t, new(RequestIDTestSuite))
+}
@@ -0,0 +1,363 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"test/portal/domain"
+	routematch "test/portal/internal/route/match"
+	"test/portal/internal/route/repository/yaml"
+	"test/portal/internal/route/usecase"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type RouteIndexTestSuite struct {
+	suite.Suite
+	repo    domain.RouteItemRepository
+	usecase domain.RouteItemUsecase
+	ctx     context.Context
+}
+
+func (suite *RouteIndexTestSuite) SetupTest() {
+	// Clean or recreate yaml file
+	os.Remove("./.data/routes.yaml")
+	file, err := os.Create("./.data/routes.yaml")
+	if err != nil {
+		log.Fatal("Failed to create test yaml file:", err)
+	}
+	file.Close()
+
+	suite.repo = yaml.NewRouteYamlRepository()
+	suite.usecase = usecase.NewRouteUsecase(suite.repo)
+	suite.ctx = context.Background()
+}
+
+func indexRoute(name string, host string, path string) domain.RouteItem {
+	isEnabled := true
+	return domain.RouteItem{Name: name, Host: host, Path: path, Backend: "http://backend.internal", Enabled: &isEnabled}
+}
+
+func (suite *RouteIndexTestSuite) match(index *routematch.Index, host string, path string) string {
+	requestURL, err := url.ParseRequestURI(path)
+	assert.NoError(suite.T(), err)
+	match := index.Match(host, requestURL, time.Now())
+	if match == nil {
+		return ""
+	}
+	return match.Route.Name
+}
+
+func (suite *RouteIndexTestSuite) TestMatching() {
+	disabled := indexRoute("disabled", "api.example.com", "/api/v1/users/admin")
+	*disabled.Enabled = false
+	insensitive := indexRoute("insensitive", "api.example.com", "/Api/V2")
+	insensitive.PathMatching = &domain.RoutePathMatching{CaseInsensitive: true}
+	index := routematch.NewIndex([]domain.RouteItem{
+		indexRoute("root", "api.example.com", "/"),
+		indexRoute("api", "api.example.com", "/api"),
+		indexRoute("users", "api.example.com", "/api/v1/users"),
+		indexRoute("user", "api.example.com", "/api/v1/users/{id}"),
+		indexRoute("orders", "api.example.com", "/api/v1/orders"),
+		indexRoute("files", "api.example.com", "/api/v1/{tenant}/files/*"),
+		indexRoute("sensitive", "api.example.com", "/API/v3"),
+		indexRoute("other-host", "admin.example.com", "/api/v1/users"),
+		disabled,
+		insensitive,
+	})
+
+	// Every node on the way may serve the request, the deepest wins
+	assert.Equal(suite.T(), "root", suite.match(index, "api.example.com", "/health"))
+	assert.Equal(suite.T(), "api", suite.match(index, "api.example.com", "/api/v1"))
+	assert.Equal(suite.T(), "users", suite.match(index, "api.example.com", "/api/v1/users"))
+	assert.Equal(suite.T(), "user", suite.match(index, "api.example.com", "/api/v1/users/admin"))
+	assert.Equal(suite.T(), "orders", suite.match(index, "api.example.com", "/api/v1/orders/7"))
+	assert.Equal(suite.T(), "files", suite.match(index, "api.example.com", "/api/v1/acme/files/a/b"))
+	assert.Equal(suite.T(), "api", suite.match(index, "api.example.com", "/api/v1/acme/file"))
+
+	// Literal segments are indexed in lower case, case-sensitive routes still
+	// compare the case
+	assert.Equal(suite.T(), "insensitive", suite.match(index, "api.example.com", "/api/v2/x"))
+	assert.Equal(suite.T(), "sensitive", suite.match(index, "api.example.com", "/API/v3"))
+	assert.Equal(suite.T(), "api", suite.match(index, "api.example.com", "/api/v3"))
+	assert.Equal(suite.T(), "root", suite.match(index, "api.example.com", "/Api/v3"))
+
+	assert.Equal(suite.T(), "other-host", suite.match(index, "ADMIN.example.com:8443", "/api/v1/users"))
+	assert.Equal(suite.T(), "", suite.match(index, "admin.example.com", "/api/v1"))
+	assert.Equal(suite.T(), "", suite.match(index, "unknown.example.com", "/"))
+}
+
+// Random routes and requests, the index must find the route a scan of the
+// routes find
+func (suite *RouteIndexTestSuite) TestSameAsScan() {
+	random := rand.New(rand.NewSource(42))
+	segments := []string{"api", "API", "v1", "users", "", "{}"}
+	requestSegments := []string{"api", "Api", "v1", "users", "42", "", ".", "%2F", "a%20b", "%41PI"}
+	trailingSlashes := []string{domain.TrailingSlashIgnore, domain.TrailingSlashStrict, domain.TrailingSlashRedirect}
+
+	routes := make([]domain.RouteItem, 0, 300)
+	for i := 0; i < cap(routes); i++ {
+		parts := make([]string, random.Intn(4))
+		for j := range parts {
+			parts[j] = segments[random.Intn(len(segments))]
+			if parts[j] == "{}" {
+				parts[j] = fmt.Sprintf("{p%d}", j)
+			}
+		}
+		if random.Intn(4) == 0 {
+			parts = append(parts, "*")
+		} else if random.Intn(4) == 0 {
+			parts = append(parts, "")
+		}
+		route := indexRoute(fmt.Sprintf("route-%d", i), []string{"a.example.com", "b.example.com"}[random.Intn(2)], "/"+strings.Join(parts, "/"))
+		*route.Enabled = random.Intn(10) != 0
+		if random.Intn(2) == 0 {
+			route.PathMatching = &domain.RoutePathMatching{
+				CaseInsensitive: random.Intn(2) == 0,
+				TrailingSlash:   trailingSlashes[random.Intn(len(trailingSlashes))],
+				MergeSlashes:    random.Intn(2) == 0,
+				DecodePercent:   random.Intn(2) == 0,
+			}
+		}
+		routes = append(routes, route)
+	}
+	index := routematch.NewIndex(routes)
+
+	for i := 0; i < 5000; i++ {
+		parts := make([]string, random.Intn(5))
+		for j := range parts {
+			parts[j] = requestSegments[random.Intn(len(requestSegments))]
+		}
+		requestURL, err := url.ParseRequestURI("/" + strings.Join(parts, "/") + "?q=1")
+		assert.NoError(suite.T(), err)
+		host := []string{"a.example.com", "B.example.com", "c.example.com"}[random.Intn(3)]
+
+		expected := routematch.Route(routes, host, requestURL)
+		actual := index.Match(host, requestURL, time.Now())
+		if expected == nil {
+			assert.Nil(suite.T(), actual, requestURL.String())
+			continue
+		}
+		if assert.NotNil(suite.T(), actual, requestURL.String()) {
+			assert.Equal(suite.T(), expected.Route.Name, actual.Route.Name, requestURL.String())
+			assert.Equal(suite.T(), expected.Params, actual.Params, requestURL.String())
+			assert.Equal(suite.T(), expected.Path, actual.Path, requestURL.String())
+			assert.Equal(suite.T(), expected.Redirect, actual.Redirect, requestURL.String())
+			assert.Equal(suite.T(), expected.Rest, actual.Rest, requestURL.String())
+		}
+	}
+}
+
+func (suite *RouteIndexTestSuite) matchRoute(path string) string {
+	match, err := suite.usecase.MatchRoute(suite.ctx, "api.example.com", &url.URL{Path: path})
+	if err != nil {
+		assert.EqualError(suite.T(), err, domain.ErrNotFound)
+		return ""
+	}
+	return match.Route.Name
+}
+
+func (suite *RouteIndexTestSuite) TestRebuildOnChanges() {
+	assert.Equal(suite.T(), "", suite.matchRoute("/users"))
+
+	_, err := suite.usecase.Create(suite.ctx, indexRoute("users", "api.example.com", "/users"))
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "users", suite.matchRoute("/users/42"))
+
+	// Writes outside of the usecase are seen too
+	_, err = suite.repo.Create(suite.ctx, indexRoute("user", "api.example.com", "/users/{id}"))
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "user", suite.matchRoute("/users/42"))
+
+	route := indexRoute("user", "api.example.com", "/users/{id}")
+	*route.Enabled = false
+	_, err = suite.repo.Update(suite.ctx, route)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "users", suite.matchRoute("/users/42"))
+
+	assert.NoError(suite.T(), suite.usecase.Delete(suite.ctx, "users"))
+	assert.Equal(suite.T(), "", suite.matchRoute("/users/42"))
+}
+
+func (suite *RouteIndexTestSuite) TestConcurrentChanges() {
+	_, err := suite.usecase.Create(suite.ctx, indexRoute("users", "api.example.com", "/users"))
+	assert.NoError(suite.T(), err)
+
+	// Requests keep matching while the index is swapped under them
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				match, err := suite.usecase.MatchRoute(suite.ctx, "api.example.com", &url.URL{Path: "/users/42"})
+				if assert.NoError(suite.T(), err) {
+					assert.Equal(suite.T(), "users", match.Route.Name)
+				}
+			}
+		}()
+	}
+	for i := 0; i < 5; i++ {
+		_, err := suite.usecase.Create(suite.ctx, indexRoute(fmt.Sprintf("user-%d", i), "api.example.com", fmt.Sprintf("/users/{id}/v%d", i)))
+		assert.NoError(suite.T(), err)
+	}
+	close(done)
+	wg.Wait()
+}
+
+// Repository whose GetAll wait for release once blocking, holding a rebuild
+// of the index in progress
+type blockingRepository struct {
+	domain.RouteItemRepository
+	blocking atomic.Bool
+	started  chan struct{}
+	release  chan struct{}
+}
+
+func (r *blockingRepository) GetAll(ctx context.Context) ([]domain.RouteItem, error) {
+	if r.blocking.CompareAndSwap(true, false) {
+		close(r.started)
+		<-r.release
+	}
+	return r.RouteItemRepository.GetAll(ctx)
+}
+
+func (suite *RouteIndexTestSuite) TestDisableThenMatch() {
+	repo := &blockingRepository{RouteItemRepository: suite.repo, started: make(chan struct{}), release: make(chan struct{})}
+	suite.usecase = usecase.NewRouteUsecase(repo)
+	_, err := suite.usecase.Create(suite.ctx, indexRoute("users", "api.example.com", "/users"))
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "users", suite.matchRoute("/users"))
+
+	// A request start a rebuild after another change and hold it
+	_, err = suite.repo.Create(suite.ctx, indexRoute("orders", "api.example.com", "/orders"))
+	assert.NoError(suite.T(), err)
+	repo.blocking.Store(true)
+	go suite.matchRoute("/orders")
+	<-repo.started
+
+	route := indexRoute("users", "api.example.com", "/users")
+	*route.Enabled = false
+	_, err = suite.repo.Update(suite.ctx, route)
+	assert.NoError(suite.T(), err)
+
+	// The next request wait for the index instead of matching the disabled
+	// route in the previous one
+	matched := make(chan string)
+	go func() { matched <- suite.matchRoute("/users") }()
+	select {
+	case name := <-matched:
+		close(repo.release)
+		assert.Fail(suite.T(), "matched before the rebuild", name)
+	case <-time.After(100 * time.Millisecond):
+		close(repo.release)
+		assert.Equal(suite.T(), "", <-matched)
+	}
+}
+
+func TestRouteIndexTestSuite(t *testing.T) {
+	suite.Run(t, new(RouteIndexTestSuite))
+}
+
+// Routes spread over 100 hosts, a third of them templates
+func benchmarkRoutes(count int) []domain.RouteItem {
+	routes := make([]domain.RouteItem, count)
+	for i := range routes {
+		host := fmt.Sprintf("svc-%d.example.com", i%100)
+		var path string
+		switch i % 3 {
+		case 0:
+			path = fmt.Sprintf("/api/v1/resource-%d", i)
+		case 1:
+			path = fmt.Sprintf("/api/v1/resource-%d/{id}/items", i)
+		default:
+			path = fmt.Sprintf("/tenant-%d/{tenant}/files/*", i)
+		}
+		routes[i] = indexRoute(fmt.Sprintf("route-%d", i), host, path)
+	}
+	return routes
+}
+
+type benchmarkRequest struct {
+	host string
+	url  *url.URL
+}
+
+// Requests for routes across the table, and one matching no route
+func benchmarkRequests(count int) []benchmarkRequest {
+	requests := make([]benchmarkRequest, 0, 4)
+	for _, i := range []int{0, count/2 + 1, count - 1} {
+		host := fmt.Sprintf("svc-%d.example.com", i%100)
+		switch i % 3 {
+		case 0:
+			requests = append(requests, benchmarkRequest{host, &url.URL{Path: fmt.Sprintf("/api/v1/resource-%d/status", i)}})
+		case 1:
+			requests = append(requests, benchmarkRequest{host, &url.URL{Path: fmt.Sprintf("/api/v1/resource-%d/42/items", i)}})
+		default:
+			requests = append(requests, benchmarkRequest{host, &url.URL{Path: fmt.Sprintf("/tenant-%d/acme/files/a/b.pdf", i)}})
+		}
+	}
+	return append(requests, benchmarkRequest{"svc-0.example.com", &url.URL{Path: "/api/v2/unknown"}})
+}
+
+var benchmarkSizes = []int{10_000, 100_000}
+
+func BenchmarkRouteIndexMatch(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		b.Run(fmt.Sprintf("routes=%d", size), func(b *testing.B) {
+			index := routematch.NewIndex(benchmarkRoutes(size))
+			requests := benchmarkRequests(size)
+			now := time.Now()
+			i := 0
+			for b.Loop() {
+				request := requests[i%len(requests)]
+				if index.Match(request.host, request.url, now) == nil && i%len(requests) != len(requests)-1 {
+					b.Fatal("no route matched", request.url)
+				}
+				i++
+			}
+		})
+	}
+}
+
+func BenchmarkRouteIndexBuild(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		b.Run(fmt.Sprintf("routes=%d", size), func(b *testing.B) {
+			routes := benchmarkRoutes(size)
+			for b.Loop() {
+				routematch.NewIndex(routes)
+			}
+		})
+	}
+}
+
+// Scan of the routes the index replace, for comparison
+func BenchmarkRouteScanMatch(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		b.Run(fmt.Sprintf("routes=%d", size), func(b *testing.B) {
+			routes := benchmarkRoutes(size)
+			requests := benchmarkRequests(size)
+			i := 0
+			for b.Loop() {
+				request := requests[i%len(requests)]
+				routematch.Route(routes, request.host, request.url)
+				i++
+			}
+		})
+	}
+}
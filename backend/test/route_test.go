@@ -35,6 +35,33 @@ type RouteHandler struct {
 	validate *validator.Validate
 }
 
+// Validator with the custom validations registered like the API server
+func newTestValidator() *validator.Validate {
+	validate := validator.New()
+	if err := validate.RegisterValidation("is_valid_name", validations.IsValidName); err != nil {
+		log.Println("Failed initiate validator is_valid_name", err)
+	}
+	if err := validate.RegisterValidation("is_valid_path", validations.IsValidPath); err != nil {
+		log.Println("Failed initiate validator is_valid_path", err)
+	}
+	if err := validate.RegisterValidation("is_valid_host", validations.IsValidHostName); err != nil {
+		log.Println("Failed initiate validator is_valid_host", err)
+	}
+	if err := validate.RegisterValidation("is_valid_backend_url", validations.IsValidBackendUrl); err != nil {
+		log.Println("Failed initiate validator is_valid_backend_url", err)
+	}
+	if err := validate.RegisterValidation("is_valid_cidr", validations.IsValidCIDR); err != nil {
+		log.Println("Failed initiate validator is_valid_cidr", err)
+	}
+	if err := validate.RegisterValidation("is_valid_header_name", validations.IsValidHeaderName); err != nil {
+		log.Println("Failed initiate validator is_valid_header_name", err)
+	}
+	if err := validate.RegisterValidation("is_valid_sni_host", validations.IsValidSNIHost); err != nil {
+		log.Println("Failed initiate validator is_valid_sni_host", err)
+	}
+	return validate
+}
+
 func (suite *RouteTestSuite) SetupTest() {
 
 	// Clean or recreate yaml file
@@ -47,19 +74,7 @@ func (suite *RouteTestSuite) SetupTest() {
 
 	suite.repo = yaml.NewRouteYamlRepository()
 	suite.usecase = usecase.NewRouteUsecase(suite.repo)
-	suite.validate = validator.New()
-	if err := suite.validate.RegisterValidation("is_valid_name", validations.IsValidName); err != nil {
-		log.Println("Failed initiate validator is_valid_name", err)
-	}
-	if err := suite.validate.RegisterValidation("is_valid_path", validations.IsValidPath); err != nil {
-		log.Println("Failed initiate validator is_valid_path", err)
-	}
-	if err := suite.validate.RegisterValidation("is_valid_host", validations.IsValidHostName); err != nil {
-		log.Println("Failed initiate validator is_valid_host", err)
-	}
-	if err := suite.validate.RegisterValidation("is_valid_backend_url", validations.IsValidBackendUrl); err != nil {
-		log.Println("Failed initiate validator is_valid_backend_url", err)
-	}
+	suite.validate = newTestValidator()
 
 	suite.ctx = context.Background()
 
@@ -277,6 +292,36 @@ func (suite *RouteTestSuite) TestCreateRoute_InvalidData() {
 	assert.Equal(suite.T(), http.StatusBadRequest, response.Code)
 }
 
+func (suite *RouteTestSuite) TestCreateRoute_InvalidCIDR() {
+	delivery := routedelivery.NewTestRouteDelivery(suite.ctx, suite.validate, suite.usecase)
+	isEnabled := true
+	route := domain.RouteItem{
+		Name:       "cidr-test-route",
+		Host:       "cidr.example.com",
+		Path:       "/cidr-test",
+		Backend:    "http://localhost:8085",
+		Enabled:    &isEnabled,
+		AllowCIDRs: []string{"10.8.0.0/16", "10.300.0.0/16"},
+	}
+
+	payload, err := json.Marshal(route)
+	assert.NoError(suite.T(), err)
+
+	config := httputils.HTTPTestConfig{
+		Method:  http.MethodPost,
+		Path:    "/routes",
+		Payload: bytes.NewBuffer(payload),
+		HandlerFunc: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			delivery.Create(suite.ctx, w, r)
+		}),
+	}
+
+	response := httputils.HTTPTestRequest(suite.T(), config)
+
+	// Assertions - should return bad request
+	assert.Equal(suite.T(), http.StatusBadRequest, response.Code)
+}
+
 func (suite *RouteTestSuite) TestGetOneRoute_NotFound() {
 	delivery := routedelivery.NewTestRouteDelivery(suite.ctx, suite.validate, suite.usecase)
 	// Create HTTP request for non-existent route
@@ -0,0 +1,219 @@
+package test
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"test/portal/domain"
+	"test/portal/internal/proxy"
+	"test/portal/internal/route/repository/yaml"
+	"test/portal/internal/route/schedule"
+	"test/portal/internal/route/usecase"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ScheduleTestSuite struct {
+	suite.Suite
+	usecase domain.RouteItemUsecase
+	ctx     context.Context
+	now     time.Time
+	drainer *recordingDrainer
+	backend *httptest.Server
+}
+
+// Drainer recording the calls of the scheduler
+type recordingDrainer struct {
+	calls []string
+}
+
+func (d *recordingDrainer) Drain(routeName string) { d.calls = append(d.calls, "drain "+routeName) }
+func (d *recordingDrainer) CancelDrain(routeName string) {
+	d.calls = append(d.calls, "cancel "+routeName)
+}
+func (d *recordingDrainer) DrainStatus(routeName string) *domain.RouteDrainStatus {
+	return nil
+}
+
+func (suite *ScheduleTestSuite) SetupTest() {
+	// Clean or recreate yaml file
+	os.Remove("./.data/routes.yaml")
+	file, err := os.Create("./.data/routes.yaml")
+	if err != nil {
+		log.Fatal("Failed to create test yaml file:", err)
+	}
+	file.Close()
+
+	// Monday 2025-06-02 10:00 in Paris
+	suite.now = time.Date(2025, 6, 2, 8, 0, 0, 0, time.UTC)
+	suite.drainer = &recordingDrainer{}
+	suite.usecase = usecase.NewConfiguredRouteUsecase(yaml.NewRouteYamlRepository(), usecase.Config{
+		Drainer: suite.drainer,
+		Now:     func() time.Time { return suite.now },
+	})
+	suite.ctx = context.Background()
+	suite.backend = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("campaign"))
+	}))
+}
+
+func (suite *ScheduleTestSuite) TearDownTest() {
+	suite.backend.Close()
+}
+
+func (suite *ScheduleTestSuite) createRoute(routeSchedule *domain.RouteSchedule) (*domain.RouteItem, error) {
+	isEnabled := true
+	return suite.usecase.Create(suite.ctx, domain.RouteItem{
+		Name:     "campaign-route",
+		Host:     "campaign.example.com",
+		Path:     "/",
+		Backend:  suite.backend.URL,
+		Enabled:  &isEnabled,
+		Schedule: routeSchedule,
+	})
+}
+
+func (suite *ScheduleTestSuite) get() int {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Host = "campaign.example.com"
+	response := httptest.NewRecorder()
+	proxy.NewProxy(suite.usecase, proxy.Config{}).ServeHTTP(response, req)
+	return response.Code
+}
+
+func paris(t *testing.T, value string) time.Time {
+	loc, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := time.ParseInLocation("2006-01-02 15:04", value, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+func (suite *ScheduleTestSuite) TestWindows() {
+	officeHours := &domain.RouteSchedule{
+		TimeZone: "Europe/Paris",
+		Windows:  []domain.RouteScheduleWindow{{Days: "mon-fri", Start: "09:00", End: "17:30"}},
+	}
+	assert.True(suite.T(), schedule.IsActive(officeHours, paris(suite.T(), "2025-06-02 09:00")))
+	assert.True(suite.T(), schedule.IsActive(officeHours, paris(suite.T(), "2025-06-06 17:29")))
+	assert.False(suite.T(), schedule.IsActive(officeHours, paris(suite.T(), "2025-06-06 17:30")))
+	assert.False(suite.T(), schedule.IsActive(officeHours, paris(suite.T(), "2025-06-02 08:59")))
+	assert.False(suite.T(), schedule.IsActive(officeHours, paris(suite.T(), "2025-06-07 12:00")))
+	// 07:30 UTC is 09:30 in Paris during summer time
+	assert.True(suite.T(), schedule.IsActive(officeHours, time.Date(2025, 6, 2, 7, 30, 0, 0, time.UTC)))
+
+	// Friday and saturday night, closing the next morning
+	nights := &domain.RouteSchedule{
+		TimeZone: "Europe/Paris",
+		Windows:  []domain.RouteScheduleWindow{{Days: "5,6", Start: "22:00", End: "06:00"}},
+	}
+	assert.True(suite.T(), schedule.IsActive(nights, paris(suite.T(), "2025-06-06 23:00")))
+	assert.True(suite.T(), schedule.IsActive(nights, paris(suite.T(), "2025-06-08 05:59")))
+	assert.False(suite.T(), schedule.IsActive(nights, paris(suite.T(), "2025-06-08 06:00")))
+	assert.False(suite.T(), schedule.IsActive(nights, paris(suite.T(), "2025-06-06 05:00")))
+	assert.False(suite.T(), schedule.IsActive(nights, paris(suite.T(), "2025-06-08 23:00")))
+
+	// Whole days, sunday written 0 or 7
+	weekend := &domain.RouteSchedule{Windows: []domain.RouteScheduleWindow{{Days: "6-7", Start: "00:00", End: "24:00"}}}
+	assert.True(suite.T(), schedule.IsActive(weekend, time.Date(2025, 6, 8, 23, 59, 0, 0, time.UTC)))
+	assert.False(suite.T(), schedule.IsActive(weekend, time.Date(2025, 6, 9, 0, 0, 0, 0, time.UTC)))
+}
+
+func (suite *ScheduleTestSuite) TestActiveBounds() {
+	from := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC)
+	campaign := &domain.RouteSchedule{ActiveFrom: &from, ActiveUntil: &until}
+
+	assert.False(suite.T(), schedule.IsActive(campaign, from.Add(-time.Second)))
+	assert.True(suite.T(), schedule.IsActive(campaign, from))
+	assert.True(suite.T(), schedule.IsActive(campaign, until.Add(-time.Second)))
+	assert.False(suite.T(), schedule.IsActive(campaign, until))
+
+	// Windows only apply inside the bounds
+	campaign.Windows = []domain.RouteScheduleWindow{{Days: "*", Start: "12:00", End: "14:00"}}
+	assert.True(suite.T(), schedule.IsActive(campaign, time.Date(2025, 6, 10, 13, 0, 0, 0, time.UTC)))
+	assert.False(suite.T(), schedule.IsActive(campaign, time.Date(2025, 6, 10, 15, 0, 0, 0, time.UTC)))
+	assert.False(suite.T(), schedule.IsActive(campaign, time.Date(2025, 7, 10, 13, 0, 0, 0, time.UTC)))
+}
+
+func (suite *ScheduleTestSuite) TestEffectiveState() {
+	from := suite.now.Add(time.Hour)
+	route, err := suite.createRoute(&domain.RouteSchedule{ActiveFrom: &from})
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), domain.RouteStateInactive, route.EffectiveState)
+	assert.Equal(suite.T(), http.StatusNotFound, suite.get())
+
+	suite.now = from
+	route, _ = suite.usecase.GetOne(suite.ctx, "campaign-route")
+	assert.Equal(suite.T(), domain.RouteStateActive, route.EffectiveState)
+	assert.Equal(suite.T(), http.StatusOK, suite.get())
+
+	isEnabled := false
+	route.Enabled = &isEnabled
+	route, err = suite.usecase.Update(suite.ctx, *route)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), domain.RouteStateDisabled, route.EffectiveState)
+
+	routes, _ := suite.usecase.GetAll(suite.ctx)
+	assert.Equal(suite.T(), domain.RouteStateDisabled, routes[0].EffectiveState)
+}
+
+func (suite *ScheduleTestSuite) TestScheduler() {
+	_, err := suite.createRoute(&domain.RouteSchedule{
+		TimeZone: "Europe/Paris",
+		Windows:  []domain.RouteScheduleWindow{{Days: "mon-fri", Start: "09:00", End: "17:00"}},
+	})
+	assert.NoError(suite.T(), err)
+	suite.drainer.calls = nil
+	scheduler := schedule.NewScheduler(suite.usecase, suite.drainer)
+
+	assert.NoError(suite.T(), scheduler.Tick(suite.ctx))
+	assert.Empty(suite.T(), suite.drainer.calls)
+
+	// Leaving the window drain the route
+	suite.now = paris(suite.T(), "2025-06-02 17:00")
+	assert.NoError(suite.T(), scheduler.Tick(suite.ctx))
+	assert.Equal(suite.T(), []string{"drain campaign-route"}, suite.drainer.calls)
+	assert.Equal(suite.T(), http.StatusNotFound, suite.get())
+
+	assert.NoError(suite.T(), scheduler.Tick(suite.ctx))
+	assert.Len(suite.T(), suite.drainer.calls, 1)
+
+	suite.now = paris(suite.T(), "2025-06-03 09:00")
+	assert.NoError(suite.T(), scheduler.Tick(suite.ctx))
+	assert.Equal(suite.T(), []string{"drain campaign-route", "cancel campaign-route"}, suite.drainer.calls)
+	assert.Equal(suite.T(), http.StatusOK, suite.get())
+}
+
+func (suite *ScheduleTestSuite) TestValidation() {
+	from := suite.now
+	until := suite.now.Add(-time.Hour)
+	for _, invalid := range []*domain.RouteSchedule{
+		{ActiveFrom: &from, ActiveUntil: &until},
+		{TimeZone: "Mars/Olympus"},
+		{Windows: []domain.RouteScheduleWindow{{Days: "mon-funday", Start: "09:00", End: "17:00"}}},
+		{Windows: []domain.RouteScheduleWindow{{Days: "fri-mon", Start: "09:00", End: "17:00"}}},
+		{Windows: []domain.RouteScheduleWindow{{Days: "8", Start: "09:00", End: "17:00"}}},
+		{Windows: []domain.RouteScheduleWindow{{Days: "*", Start: "9h", End: "17:00"}}},
+		{Windows: []domain.RouteScheduleWindow{{Days: "*", Start: "24:00", End: "17:00"}}},
+		{Windows: []domain.RouteScheduleWindow{{Days: "*", Start: "09:00", End: "25:00"}}},
+	} {
+		_, err := suite.createRoute(invalid)
+		assert.ErrorContains(suite.T(), err, domain.ErrBadRequest, invalid)
+	}
+
+	assert.Error(suite.T(), newTestValidator().Struct(domain.RouteScheduleWindow{Days: "*", Start: "09:00"}))
+}
+
+func TestScheduleTestSuite(t *testing.T) {
+	suite.Run(t, new(ScheduleTestSuite))
+}
@@ -0,0 +1,238 @@
+package test
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"test/portal/domain"
+	"test/portal/internal/proxy"
+	"test/portal/internal/route/repository/yaml"
+	"test/portal/internal/route/usecase"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type StaticTestSuite struct {
+	suite.Suite
+	repo        domain.RouteItemRepository
+	usecase     domain.RouteItemUsecase
+	ctx         context.Context
+	root        string
+	outside     string
+	defaultRoot string
+}
+
+func (suite *StaticTestSuite) SetupTest() {
+	// Clean or recreate yaml file
+	os.Remove("./.data/routes.yaml")
+	file, err := os.Create("./.data/routes.yaml")
+	if err != nil {
+		log.Fatal("Failed to create test yaml file:", err)
+	}
+	file.Close()
+
+	suite.repo = yaml.NewRouteYamlRepository()
+	suite.usecase = usecase.NewRouteUsecase(suite.repo)
+	suite.ctx = context.Background()
+
+	/*
+		root/
+			site/index.html, app.js, .env, docs/guide.html, empty/
+			escape -> outside/
+		outside/secret.txt
+	*/
+	suite.root = suite.T().TempDir()
+	suite.outside = suite.T().TempDir()
+	suite.writeFile(filepath.Join(suite.root, "site", "index.html"), "<h1>home</h1>")
+	suite.writeFile(filepath.Join(suite.root, "site", "app.js"), "console.log('app')")
+	suite.writeFile(filepath.Join(suite.root, "site", ".env"), "SECRET=1")
+	suite.writeFile(filepath.Join(suite.root, "site", "docs", "guide.html"), "<p>guide</p>")
+	suite.Require().NoError(os.MkdirAll(filepath.Join(suite.root, "site", "empty"), 0o755))
+	suite.writeFile(filepath.Join(suite.outside, "secret.txt"), "secret")
+	suite.Require().NoError(os.Symlink(suite.outside, filepath.Join(suite.root, "site", "escape")))
+
+	suite.defaultRoot = usecase.StaticRoot
+	usecase.StaticRoot = suite.root
+}
+
+func (suite *StaticTestSuite) TearDownTest() {
+	usecase.StaticRoot = suite.defaultRoot
+}
+
+func (suite *StaticTestSuite) writeFile(path string, content string) {
+	suite.Require().NoError(os.MkdirAll(filepath.Dir(path), 0o755))
+	suite.Require().NoError(os.WriteFile(path, []byte(content), 0o644))
+}
+
+func (suite *StaticTestSuite) createRoute(static *domain.RouteStatic) error {
+	isEnabled := true
+	_, err := suite.usecase.Create(suite.ctx, domain.RouteItem{
+		Name:    "site-route",
+		Host:    "site.example.com",
+		Path:    "/site",
+		Enabled: &isEnabled,
+		Static:  static,
+	})
+	return err
+}
+
+func (suite *StaticTestSuite) request(method string, target string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	req.Host = "site.example.com"
+	response := httptest.NewRecorder()
+	proxy.NewProxy(suite.usecase, proxy.Config{StaticRoot: suite.root}).ServeHTTP(response, req)
+	return response
+}
+
+func (suite *StaticTestSuite) TestServeFiles() {
+	assert.NoError(suite.T(), suite.createRoute(&domain.RouteStatic{Directory: "site", MaxAgeSeconds: 600}))
+
+	response := suite.request(http.MethodGet, "/site/app.js")
+	assert.Equal(suite.T(), http.StatusOK, response.Code)
+	assert.Equal(suite.T(), "console.log('app')", response.Body.String())
+	assert.Equal(suite.T(), "public, max-age=600", response.Header().Get("Cache-Control"))
+
+	// Index documents are always revalidated
+	response = suite.request(http.MethodGet, "/site/")
+	assert.Equal(suite.T(), http.StatusOK, response.Code)
+	assert.Equal(suite.T(), "<h1>home</h1>", response.Body.String())
+	assert.Equal(suite.T(), "no-cache", response.Header().Get("Cache-Control"))
+
+	response = suite.request(http.MethodHead, "/site/docs/guide.html")
+	assert.Equal(suite.T(), http.StatusOK, response.Code)
+	assert.Empty(suite.T(), response.Body.String())
+
+	response = suite.request(http.MethodGet, "/site/docs?page=1")
+	assert.Equal(suite.T(), http.StatusMovedPermanently, response.Code)
+	assert.Equal(suite.T(), "/site/docs/?page=1", response.Header().Get("Location"))
+
+	response = suite.request(http.MethodPost, "/site/app.js")
+	assert.Equal(suite.T(), http.StatusMethodNotAllowed, response.Code)
+	assert.Equal(suite.T(), "GET, HEAD", response.Header().Get("Allow"))
+
+	assert.Equal(suite.T(), http.StatusNotFound, suite.request(http.MethodGet, "/site/missing.js").Code)
+	assert.Equal(suite.T(), http.StatusNotFound, suite.request(http.MethodGet, "/site/missing").Code)
+}
+
+func (suite *StaticTestSuite) TestCustomIndexAndListing() {
+	suite.writeFile(filepath.Join(suite.root, "site", "docs", "home.html"), "<p>docs home</p>")
+	assert.NoError(suite.T(), suite.createRoute(&domain.RouteStatic{Directory: "site", IndexFile: "home.html", DirectoryListing: true}))
+
+	response := suite.request(http.MethodGet, "/site/docs/")
+	assert.Equal(suite.T(), "<p>docs home</p>", response.Body.String())
+
+	// No home.html at the root, the directory is listed without the dotfiles
+	response = suite.request(http.MethodGet, "/site/")
+	assert.Equal(suite.T(), http.StatusOK, response.Code)
+	assert.Contains(suite.T(), response.Body.String(), `<a href="app.js">app.js</a>`)
+	assert.Contains(suite.T(), response.Body.String(), `<a href="docs/">docs/</a>`)
+	assert.NotContains(suite.T(), response.Body.String(), ".env")
+}
+
+func (suite *StaticTestSuite) TestListingDisabled() {
+	assert.NoError(suite.T(), suite.createRoute(&domain.RouteStatic{Directory: "site"}))
+	assert.Equal(suite.T(), http.StatusNotFound, suite.request(http.MethodGet, "/site/empty/").Code)
+}
+
+func (suite *StaticTestSuite) TestSPAFallback() {
+	assert.NoError(suite.T(), suite.createRoute(&domain.RouteStatic{Directory: "site", SPAFallback: true}))
+
+	response := suite.request(http.MethodGet, "/site/users/42")
+	assert.Equal(suite.T(), http.StatusOK, response.Code)
+	assert.Equal(suite.T(), "<h1>home</h1>", response.Body.String())
+	assert.Equal(suite.T(), "no-cache", response.Header().Get("Cache-Control"))
+
+	// Missing assets stay 404
+	assert.Equal(suite.T(), http.StatusNotFound, suite.request(http.MethodGet, "/site/missing.js").Code)
+}
+
+func (suite *StaticTestSuite) TestTraversal() {
+	assert.NoError(suite.T(), suite.createRoute(&domain.RouteStatic{Directory: "site"}))
+
+	for _, target := range []string{
+		"/site/../../etc/passwd",
+		"/site/%2e%2e/%2e%2e/etc/passwd",
+		"/site/..%2f..%2fetc%2fpasswd",
+		"/site/escape/secret.txt",
+		"/site/.env",
+		"/site/docs/../.env",
+		"/site/%2eenv",
+	} {
+		response := suite.request(http.MethodGet, target)
+		assert.Equal(suite.T(), http.StatusNotFound, response.Code, target)
+		assert.NotContains(suite.T(), response.Body.String(), "secret", target)
+		assert.NotContains(suite.T(), response.Body.String(), "SECRET", target)
+	}
+}
+
+func (suite *StaticTestSuite) storeRoute(name string, path string, pathMatching *domain.RoutePathMatching) {
+	isEnabled := true
+	_, err := suite.repo.Create(suite.ctx, domain.RouteItem{
+		Name:         name,
+		Host:         "site.example.com",
+		Path:         path,
+		Enabled:      &isEnabled,
+		Static:       &domain.RouteStatic{Directory: "site"},
+		PathMatching: pathMatching,
+	})
+	assert.NoError(suite.T(), err)
+}
+
+func (suite *StaticTestSuite) TestFileFromMatch() {
+	suite.storeRoute("assets-route", "/assets/*", nil)
+	suite.storeRoute("docs-route", "/Docs", &domain.RoutePathMatching{CaseInsensitive: true})
+	// Parameters are rejected by the usecase, a hand edited file may still
+	// carry them
+	suite.storeRoute("versions-route", "/v/{version}/*", nil)
+
+	response := suite.request(http.MethodGet, "/assets/docs/guide.html")
+	assert.Equal(suite.T(), "<p>guide</p>", response.Body.String())
+	response = suite.request(http.MethodGet, "/assets/docs")
+	assert.Equal(suite.T(), "/assets/docs/", response.Header().Get("Location"))
+
+	response = suite.request(http.MethodGet, "/DOCS/app.js")
+	assert.Equal(suite.T(), http.StatusOK, response.Code)
+	assert.Equal(suite.T(), "console.log('app')", response.Body.String())
+
+	response = suite.request(http.MethodGet, "/v/1/app.js")
+	assert.Equal(suite.T(), "console.log('app')", response.Body.String())
+	response = suite.request(http.MethodGet, "/v/1%20beta/docs")
+	assert.Equal(suite.T(), "/v/1%20beta/docs/", response.Header().Get("Location"))
+}
+
+func (suite *StaticTestSuite) TestValidation() {
+	validate := newTestValidator()
+	isEnabled := true
+	route := domain.RouteItem{
+		Name:    "site-route",
+		Host:    "site.example.com",
+		Path:    "/site",
+		Enabled: &isEnabled,
+		Static:  &domain.RouteStatic{Directory: "site"},
+	}
+	assert.NoError(suite.T(), validate.Struct(route))
+
+	// A static route has no backend
+	route.Backend = "http://localhost:3000"
+	assert.Error(suite.T(), validate.Struct(route))
+	route.Backend = ""
+	route.Static = &domain.RouteStatic{Directory: "site", IndexFile: "../index.html"}
+	assert.Error(suite.T(), validate.Struct(route))
+
+	// The usecase require an existing directory under the static root
+	assert.ErrorContains(suite.T(), suite.createRoute(&domain.RouteStatic{Directory: suite.outside}), domain.ErrBadRequest)
+	assert.ErrorContains(suite.T(), suite.createRoute(&domain.RouteStatic{Directory: "../"}), domain.ErrBadRequest)
+	assert.ErrorContains(suite.T(), suite.createRoute(&domain.RouteStatic{Directory: "site/escape"}), domain.ErrBadRequest)
+	assert.ErrorContains(suite.T(), suite.createRoute(&domain.RouteStatic{Directory: "missing"}), domain.ErrBadRequest)
+	assert.ErrorContains(suite.T(), suite.createRoute(&domain.RouteStatic{Directory: "site/app.js"}), domain.ErrBadRequest)
+	assert.NoError(suite.T(), suite.createRoute(&domain.RouteStatic{Directory: filepath.Join(suite.root, "site")}))
+}
+
+func TestStaticTestSuite(t *testing.T) {
+	suite.Run(t, new(StaticTestSuite))
+}
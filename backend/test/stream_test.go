@@ -0,0 +1,322 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"test/portal/domain"
+	"test/portal/internal/proxy/stream"
+	routedelivery "test/portal/internal/route/delivery/http"
+	"test/portal/internal/route/repository/yaml"
+	"test/portal/internal/route/usecase"
+	"test/portal/pkg/httputils"
+	"testing"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type StreamTestSuite struct {
+	suite.Suite
+	usecase  domain.StreamRouteUsecase
+	validate *validator.Validate
+	ctx      context.Context
+	proxy    *stream.Proxy
+}
+
+func (suite *StreamTestSuite) SetupTest() {
+	// Clean or recreate yaml file
+	os.Remove("./.data/streams.yaml")
+	file, err := os.Create("./.data/streams.yaml")
+	if err != nil {
+		log.Fatal("Failed to create test yaml file:", err)
+	}
+	file.Close()
+
+	suite.usecase = usecase.NewStreamRouteUsecase(yaml.NewStreamRouteYamlRepository())
+	suite.validate = newTestValidator()
+	suite.ctx = context.Background()
+	suite.proxy = stream.NewProxy(suite.usecase, stream.Config{ListenHost: "127.0.0.1"})
+}
+
+func (suite *StreamTestSuite) TearDownTest() {
+	suite.proxy.Close()
+}
+
+// Port free at the time of the call
+func freePort(t *testing.T) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func (suite *StreamTestSuite) createStream(route domain.StreamRoute) error {
+	isEnabled := true
+	if route.Enabled == nil {
+		route.Enabled = &isEnabled
+	}
+	_, err := suite.usecase.Create(suite.ctx, route)
+	return err
+}
+
+// TCP server answering each connection with its name followed by what it received
+func echoServer(t *testing.T, name string) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.Write([]byte(name + ":"))
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return listener
+}
+
+func (suite *StreamTestSuite) TestPlainTCP() {
+	upstream := echoServer(suite.T(), "mqtt")
+	defer upstream.Close()
+	port := freePort(suite.T())
+	assert.NoError(suite.T(), suite.createStream(domain.StreamRoute{Name: "mqtt", ListenPort: port, Upstream: upstream.Addr().String()}))
+	assert.NoError(suite.T(), suite.proxy.Sync(suite.ctx))
+
+	conn, err := net.Dial("tcp", "127.0.0.1:"+strconv.Itoa(port))
+	suite.Require().NoError(err)
+	defer conn.Close()
+	conn.Write([]byte("ping"))
+	conn.(*net.TCPConn).CloseWrite()
+	received, err := io.ReadAll(conn)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "mqtt:ping", string(received))
+}
+
+func (suite *StreamTestSuite) TestIdleTimeout() {
+	upstream := echoServer(suite.T(), "db")
+	defer upstream.Close()
+	port := freePort(suite.T())
+	assert.NoError(suite.T(), suite.createStream(domain.StreamRoute{Name: "postgres", ListenPort: port, Upstream: upstream.Addr().String(), IdleTimeoutSeconds: 1}))
+	assert.NoError(suite.T(), suite.proxy.Sync(suite.ctx))
+
+	conn, err := net.Dial("tcp", "127.0.0.1:"+strconv.Itoa(port))
+	suite.Require().NoError(err)
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	// Traffic keep the connection open past the timeout
+	buffer := make([]byte, 16)
+	n, _ := io.ReadAtLeast(conn, buffer, 3)
+	assert.Equal(suite.T(), "db:", string(buffer[:n]))
+	for i := 0; i < 3; i++ {
+		time.Sleep(600 * time.Millisecond)
+		conn.Write([]byte("x"))
+		n, err = conn.Read(buffer)
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), "x", string(buffer[:n]))
+	}
+
+	// Then the proxy close it once idle
+	start := time.Now()
+	_, err = conn.Read(buffer)
+	assert.ErrorIs(suite.T(), err, io.EOF)
+	assert.Less(suite.T(), time.Since(start), 3*time.Second)
+}
+
+func (suite *StreamTestSuite) TestSNIPassthrough() {
+	alpha := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("alpha")) }))
+	defer alpha.Close()
+	beta := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("beta")) }))
+	defer beta.Close()
+
+	port := freePort(suite.T())
+	assert.NoError(suite.T(), suite.createStream(domain.StreamRoute{Name: "alpha", ListenPort: port, SNIHost: "db.example.com", Upstream: alpha.Listener.Addr().String()}))
+	assert.NoError(suite.T(), suite.createStream(domain.StreamRoute{Name: "beta", ListenPort: port, SNIHost: "*.mq.example.com", Upstream: beta.Listener.Addr().String()}))
+	assert.NoError(suite.T(), suite.proxy.Sync(suite.ctx))
+
+	get := func(serverName string) (string, *tls.ConnectionState, error) {
+		client := &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return net.Dial("tcp", "127.0.0.1:"+strconv.Itoa(port))
+			},
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}}
+		defer client.CloseIdleConnections()
+		response, err := client.Get("https://" + serverName + "/")
+		if err != nil {
+			return "", nil, err
+		}
+		defer response.Body.Close()
+		body, _ := io.ReadAll(response.Body)
+		return string(body), response.TLS, nil
+	}
+
+	// TLS is terminated by the upstream itself
+	body, state, err := get("db.example.com")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "alpha", body)
+	assert.True(suite.T(), state.PeerCertificates[0].Equal(alpha.Certificate()))
+
+	body, _, err = get("EU.mq.example.com")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "beta", body)
+
+	// One label only for the wildcard, unknown names are dropped
+	_, _, err = get("a.eu.mq.example.com")
+	assert.Error(suite.T(), err)
+	_, _, err = get("other.example.com")
+	assert.Error(suite.T(), err)
+}
+
+func (suite *StreamTestSuite) TestSyncListeners() {
+	upstream := echoServer(suite.T(), "mqtt")
+	defer upstream.Close()
+	port := freePort(suite.T())
+	isDisabled := false
+	assert.NoError(suite.T(), suite.createStream(domain.StreamRoute{Name: "mqtt", ListenPort: port, Upstream: upstream.Addr().String(), Enabled: &isDisabled}))
+	assert.NoError(suite.T(), suite.proxy.Sync(suite.ctx))
+
+	_, err := net.Dial("tcp", "127.0.0.1:"+strconv.Itoa(port))
+	assert.Error(suite.T(), err)
+
+	isEnabled := true
+	_, err = suite.usecase.Update(suite.ctx, domain.StreamRoute{Name: "mqtt", ListenPort: port, Upstream: upstream.Addr().String(), Enabled: &isEnabled})
+	assert.NoError(suite.T(), err)
+	assert.NoError(suite.T(), suite.proxy.Sync(suite.ctx))
+	conn, err := net.Dial("tcp", "127.0.0.1:"+strconv.Itoa(port))
+	assert.NoError(suite.T(), err)
+	conn.Close()
+
+	assert.NoError(suite.T(), suite.usecase.Delete(suite.ctx, "mqtt"))
+	assert.NoError(suite.T(), suite.proxy.Sync(suite.ctx))
+	_, err = net.Dial("tcp", "127.0.0.1:"+strconv.Itoa(port))
+	assert.Error(suite.T(), err)
+}
+
+func (suite *StreamTestSuite) TestListenConflicts() {
+	assert.NoError(suite.T(), suite.createStream(domain.StreamRoute{Name: "mqtt", ListenPort: 1883, Upstream: "mqtt.internal:1883"}))
+	assert.ErrorContains(suite.T(), suite.createStream(domain.StreamRoute{Name: "mqtt-two", ListenPort: 1883, Upstream: "mqtt.internal:1884"}), domain.ErrBadRequest)
+	assert.ErrorContains(suite.T(), suite.createStream(domain.StreamRoute{Name: "mqtt-tls", ListenPort: 1883, SNIHost: "mq.example.com", Upstream: "mqtt.internal:8883"}), domain.ErrBadRequest)
+
+	assert.NoError(suite.T(), suite.createStream(domain.StreamRoute{Name: "postgres", ListenPort: 5432, SNIHost: "db.example.com", Upstream: "db.internal:5432"}))
+	assert.NoError(suite.T(), suite.createStream(domain.StreamRoute{Name: "db-replica", ListenPort: 5432, SNIHost: "replica.example.com", Upstream: "replica.internal:5432"}))
+	assert.ErrorContains(suite.T(), suite.createStream(domain.StreamRoute{Name: "db-copy", ListenPort: 5432, SNIHost: "DB.example.com", Upstream: "db.internal:5433"}), domain.ErrBadRequest)
+	assert.ErrorContains(suite.T(), suite.createStream(domain.StreamRoute{Name: "db-plain", ListenPort: 5432, Upstream: "db.internal:5432"}), domain.ErrBadRequest)
+	assert.ErrorContains(suite.T(), suite.createStream(domain.StreamRoute{Name: "postgres", ListenPort: 5433, Upstream: "db.internal:5432"}), domain.ErrBadRequest)
+
+	// Updating a route keep its own port
+	isEnabled := true
+	_, err := suite.usecase.Update(suite.ctx, domain.StreamRoute{Name: "postgres", ListenPort: 5432, SNIHost: "db.example.com", Upstream: "db.internal:6432", Enabled: &isEnabled})
+	assert.NoError(suite.T(), err)
+	_, err = suite.usecase.Update(suite.ctx, domain.StreamRoute{Name: "postgres", ListenPort: 1883, SNIHost: "db.example.com", Upstream: "db.internal:6432", Enabled: &isEnabled})
+	assert.ErrorContains(suite.T(), err, domain.ErrBadRequest)
+}
+
+func (suite *StreamTestSuite) TestPortalPorts() {
+	suite.usecase = usecase.NewConfiguredStreamRouteUsecase(yaml.NewStreamRouteYamlRepository(), usecase.StreamConfig{
+		ListenAddrs: []string{":8000", "127.0.0.1:8080"},
+	})
+	for _, port := range []int{8000, 8080} {
+		err := suite.createStream(domain.StreamRoute{Name: "portal", ListenPort: port, Upstream: "db.internal:5432"})
+		assert.ErrorContains(suite.T(), err, domain.ErrBadRequest)
+	}
+
+	assert.NoError(suite.T(), suite.createStream(domain.StreamRoute{Name: "postgres", ListenPort: 5432, Upstream: "db.internal:5432"}))
+	isEnabled := true
+	_, err := suite.usecase.Update(suite.ctx, domain.StreamRoute{Name: "postgres", ListenPort: 8080, Upstream: "db.internal:5432", Enabled: &isEnabled})
+	assert.ErrorContains(suite.T(), err, "is used by the portal")
+}
+
+func (suite *StreamTestSuite) TestValidation() {
+	isEnabled := true
+	valid := domain.StreamRoute{Name: "postgres", ListenPort: 5432, SNIHost: "*.example.com", Upstream: "10.0.0.5:5432", Enabled: &isEnabled}
+	assert.NoError(suite.T(), suite.validate.Struct(valid))
+
+	for _, invalid := range []func(route *domain.StreamRoute){
+		func(route *domain.StreamRoute) { route.ListenPort = 0 },
+		func(route *domain.StreamRoute) { route.ListenPort = 70000 },
+		func(route *domain.StreamRoute) { route.Upstream = "10.0.0.5" },
+		func(route *domain.StreamRoute) { route.Upstream = "http://10.0.0.5:5432" },
+		func(route *domain.StreamRoute) { route.SNIHost = "db.*.example.com" },
+		func(route *domain.StreamRoute) { route.SNIHost = "db example.com" },
+		func(route *domain.StreamRoute) { route.IdleTimeoutSeconds = -1 },
+		func(route *domain.StreamRoute) { route.Enabled = nil },
+	} {
+		route := valid
+		invalid(&route)
+		assert.Error(suite.T(), suite.validate.Struct(route), route)
+	}
+}
+
+func (suite *StreamTestSuite) TestDelivery() {
+	delivery := routedelivery.NewTestStreamRouteDelivery(suite.ctx, suite.validate, suite.usecase)
+	isEnabled := true
+	payload, err := json.Marshal(domain.StreamRoute{Name: "mqtt", ListenPort: 1883, Upstream: "mqtt.internal:1883", Enabled: &isEnabled})
+	assert.NoError(suite.T(), err)
+
+	response := httputils.HTTPTestRequest(suite.T(), httputils.HTTPTestConfig{
+		Method:  http.MethodPost,
+		Path:    "/streams",
+		Payload: bytes.NewBuffer(payload),
+		HandlerFunc: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			delivery.Create(suite.ctx, w, r)
+		}),
+	})
+	assert.Equal(suite.T(), http.StatusOK, response.Code)
+
+	response = httputils.HTTPTestRequest(suite.T(), httputils.HTTPTestConfig{
+		Method: http.MethodGet,
+		Path:   "/streams/mqtt",
+		HandlerFunc: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			delivery.GetOne(suite.ctx, w, r)
+		}),
+	})
+	assert.Equal(suite.T(), http.StatusOK, response.Code)
+	var responseBody map[string]interface{}
+	assert.NoError(suite.T(), json.Unmarshal(response.Body.Bytes(), &responseBody))
+	assert.Equal(suite.T(), float64(1883), responseBody["data"].(map[string]interface{})["listenPort"])
+
+	response = httputils.HTTPTestRequest(suite.T(), httputils.HTTPTestConfig{
+		Method: http.MethodGet,
+		Path:   "/streams/missing",
+		HandlerFunc: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			delivery.GetOne(suite.ctx, w, r)
+		}),
+	})
+	assert.Equal(suite.T(), http.StatusNotFound, response.Code)
+
+	response = httputils.HTTPTestRequest(suite.T(), httputils.HTTPTestConfig{
+		Method: http.MethodDelete,
+		Path:   "/streams/mqtt",
+		HandlerFunc: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			delivery.Delete(suite.ctx, w, r)
+		}),
+	})
+	assert.Equal(suite.T(), http.StatusOK, response.Code)
+	routes, err := suite.usecase.GetAll(suite.ctx)
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), routes)
+}
+
+func TestStreamTestSuite(t *testing.T) {
+	suite.Run(t, new(StreamTestSuite))
+}
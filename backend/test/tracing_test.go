@@ -0,0 +1,165 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"test/portal/domain"
+	"test/portal/internal/proxy"
+	routedelivery "test/portal/internal/route/delivery/http"
+	"test/portal/internal/route/repository/yaml"
+	"test/portal/internal/route/usecase"
+	"test/portal/pkg/httputils"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const incomingTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+type TracingTestSuite struct {
+	suite.Suite
+	repo     domain.RouteItemRepository
+	usecase  domain.RouteItemUsecase
+	ctx      context.Context
+	recorder *tracetest.SpanRecorder
+	delivery *routedelivery.RouteDelivery
+}
+
+func (suite *TracingTestSuite) SetupTest() {
+	// Clean or recreate yaml file
+	os.Remove("./.data/routes.yaml")
+	file, err := os.Create("./.data/routes.yaml")
+	if err != nil {
+		log.Fatal("Failed to create test yaml file:", err)
+	}
+	file.Close()
+
+	suite.recorder = tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(suite.recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	suite.repo = yaml.NewRouteYamlRepository()
+	suite.usecase = usecase.NewRouteUsecase(suite.repo)
+	suite.ctx = context.Background()
+	suite.delivery = routedelivery.NewTestRouteDelivery(suite.ctx, newTestValidator(), suite.usecase)
+}
+
+func (suite *TracingTestSuite) TearDownTest() {
+	otel.SetTracerProvider(noop.NewTracerProvider())
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+}
+
+func (suite *TracingTestSuite) spans() map[string]sdktrace.ReadOnlySpan {
+	result := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range suite.recorder.Ended() {
+		result[span.Name()] = span
+	}
+	return result
+}
+
+func (suite *TracingTestSuite) TestManagementSpans() {
+	isEnabled := true
+	payload, _ := json.Marshal(domain.RouteItem{
+		Name:    "orders-route",
+		Host:    "orders.example.com",
+		Path:    "/orders",
+		Backend: "http://orders.internal",
+		Enabled: &isEnabled,
+	})
+	response := httputils.HTTPTestRequest(suite.T(), httputils.HTTPTestConfig{
+		Method:  http.MethodPost,
+		Path:    "/routes",
+		Payload: bytes.NewBuffer(payload),
+		HandlerFunc: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Header.Set("traceparent", incomingTraceparent)
+			suite.delivery.Create(suite.ctx, w, r)
+		}),
+	})
+	assert.Equal(suite.T(), http.StatusOK, response.Code)
+
+	spans := suite.spans()
+	delivery := spans["RouteDelivery.Create"]
+	usecaseSpan := spans["routeUsecase.Create"]
+	repository := spans["routeYamlRepository.Create"]
+	assert.NotNil(suite.T(), delivery)
+	assert.NotNil(suite.T(), usecaseSpan)
+	assert.NotNil(suite.T(), repository)
+
+	// One trace continuing the caller, delivery > usecase > repository
+	assert.Equal(suite.T(), "4bf92f3577b34da6a3ce929d0e0e4736", delivery.SpanContext().TraceID().String())
+	assert.Equal(suite.T(), "00f067aa0ba902b7", delivery.Parent().SpanID().String())
+	assert.Equal(suite.T(), delivery.SpanContext().SpanID(), usecaseSpan.Parent().SpanID())
+	assert.Equal(suite.T(), usecaseSpan.SpanContext().SpanID(), repository.Parent().SpanID())
+	assert.Equal(suite.T(), usecaseSpan.SpanContext().SpanID(), spans["routeYamlRepository.GetOne"].Parent().SpanID())
+}
+
+func (suite *TracingTestSuite) TestErrorSpans() {
+	response := httputils.HTTPTestRequest(suite.T(), httputils.HTTPTestConfig{
+		Method: http.MethodDelete,
+		Path:   "/routes/missing-route",
+		HandlerFunc: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			suite.delivery.Delete(suite.ctx, w, r)
+		}),
+	})
+	assert.Equal(suite.T(), http.StatusNotFound, response.Code)
+
+	spans := suite.spans()
+	assert.Equal(suite.T(), codes.Error, spans["RouteDelivery.Delete"].Status().Code)
+	assert.Equal(suite.T(), codes.Error, spans["routeUsecase.Delete"].Status().Code)
+	assert.Equal(suite.T(), codes.Error, spans["routeYamlRepository.GetOne"].Status().Code)
+	assert.Len(suite.T(), spans["routeYamlRepository.GetOne"].Events(), 1)
+}
+
+func (suite *TracingTestSuite) TestProxyPropagation() {
+	var traceparent string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+	}))
+	defer backend.Close()
+
+	isEnabled := true
+	_, err := suite.repo.Create(suite.ctx, domain.RouteItem{
+		Name:    "orders-route",
+		Host:    "orders.example.com",
+		Path:    "/orders",
+		Backend: backend.URL,
+		Enabled: &isEnabled,
+	})
+	assert.NoError(suite.T(), err)
+	suite.recorder.Reset()
+
+	req := httptest.NewRequest(http.MethodGet, "/orders/42", nil)
+	req.Host = "orders.example.com"
+	req.Header.Set("traceparent", incomingTraceparent)
+	proxy.NewProxy(suite.usecase, proxy.Config{}).ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := suite.spans()
+	server := spans["Proxy.ServeHTTP"]
+	forward := spans["Proxy.forward"]
+	assert.Equal(suite.T(), trace.SpanKindServer, server.SpanKind())
+	assert.Equal(suite.T(), trace.SpanKindClient, forward.SpanKind())
+	assert.Equal(suite.T(), server.SpanContext().SpanID(), forward.Parent().SpanID())
+	assert.Equal(suite.T(), server.SpanContext().SpanID(), spans["routeUsecase.MatchRoute"].Parent().SpanID())
+	assert.Contains(suite.T(), server.Attributes(), attribute.String("portal.route", "orders-route"))
+
+	// The backend continue the trace under the forward span
+	assert.Equal(suite.T(), "00-4bf92f3577b34da6a3ce929d0e0e4736-"+forward.SpanContext().SpanID().String()+"-01", traceparent)
+}
+
+func TestTracingTestSuite(t *testing.T) {
+	suite.Run(t, new(TracingTestSuite))
+}
@@ -0,0 +1,256 @@
+package test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"test/portal/domain"
+	"test/portal/internal/proxy"
+	"test/portal/internal/route/repository/yaml"
+	"test/portal/internal/route/usecase"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type UpstreamTLSTestSuite struct {
+	suite.Suite
+	repo        domain.RouteItemRepository
+	usecase     domain.RouteItemUsecase
+	ctx         context.Context
+	dir         string
+	backend     *httptest.Server
+	connections atomic.Int64
+}
+
+// Issue a certificate signed by the parent, self signed when parent is nil
+func issueCertificate(template *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, []byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+	certificate, _ := x509.ParseCertificate(der)
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+	return certificate, key,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+func (suite *UpstreamTLSTestSuite) SetupTest() {
+	// Clean or recreate yaml file
+	os.Remove("./.data/routes.yaml")
+	file, err := os.Create("./.data/routes.yaml")
+	if err != nil {
+		log.Fatal("Failed to create test yaml file:", err)
+	}
+	file.Close()
+
+	suite.repo = yaml.NewRouteYamlRepository()
+	suite.usecase = usecase.NewRouteUsecase(suite.repo)
+	suite.ctx = context.Background()
+	suite.dir = suite.T().TempDir()
+	suite.connections.Store(0)
+
+	// Internal CA issuing the backend and the proxy client certificates
+	notAfter := time.Now().Add(time.Hour)
+	ca, caKey, caPEM, _ := issueCertificate(&x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Internal CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}, nil, nil)
+	_, _, serverPEM, serverKeyPEM := issueCertificate(&x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "orders.internal"},
+		DNSNames:     []string{"orders.internal"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca, caKey)
+	_, _, clientPEM, clientKeyPEM := issueCertificate(&x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "route-portal"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, caKey)
+
+	for name, content := range map[string][]byte{"ca.pem": caPEM, "client.pem": clientPEM, "client-key.pem": clientKeyPEM} {
+		assert.NoError(suite.T(), os.WriteFile(filepath.Join(suite.dir, name), content, 0600))
+	}
+
+	serverCertificate, err := tls.X509KeyPair(serverPEM, serverKeyPEM)
+	assert.NoError(suite.T(), err)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca)
+
+	// Backend requiring a client certificate from the internal CA
+	suite.backend = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	suite.backend.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCertificate},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	}
+	suite.backend.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			suite.connections.Add(1)
+		}
+	}
+	suite.backend.StartTLS()
+}
+
+func (suite *UpstreamTLSTestSuite) TearDownTest() {
+	suite.backend.Close()
+}
+
+func (suite *UpstreamTLSTestSuite) mtlsSettings() *domain.RouteBackendTLS {
+	return &domain.RouteBackendTLS{
+		CAFile:         filepath.Join(suite.dir, "ca.pem"),
+		ClientCertFile: filepath.Join(suite.dir, "client.pem"),
+		ClientKeyFile:  filepath.Join(suite.dir, "client-key.pem"),
+		ServerName:     "orders.internal",
+		MinVersion:     "1.2",
+	}
+}
+
+func (suite *UpstreamTLSTestSuite) createRoute(name string, path string, settings *domain.RouteBackendTLS) error {
+	isEnabled := true
+	_, err := suite.usecase.Create(suite.ctx, domain.RouteItem{
+		Name:     name,
+		Host:     "orders.example.com",
+		Path:     path,
+		Backends: []domain.RouteBackend{{URL: suite.backend.URL, TLS: settings}},
+		Enabled:  &isEnabled,
+	})
+	return err
+}
+
+func (suite *UpstreamTLSTestSuite) get(handler http.Handler, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Host = "orders.example.com"
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, req)
+	return response
+}
+
+func (suite *UpstreamTLSTestSuite) TestMutualTLS() {
+	assert.NoError(suite.T(), suite.createRoute("orders-route", "/", suite.mtlsSettings()))
+
+	response := suite.get(proxy.NewProxy(suite.usecase, proxy.Config{}), "/orders")
+	assert.Equal(suite.T(), http.StatusOK, response.Code)
+	assert.Equal(suite.T(), "route-portal", response.Body.String())
+}
+
+func (suite *UpstreamTLSTestSuite) TestUntrustedBackendOrMissingClientCertificate() {
+	withoutCA := suite.mtlsSettings()
+	withoutCA.CAFile = ""
+	assert.NoError(suite.T(), suite.createRoute("no-ca-route", "/no-ca", withoutCA))
+
+	withoutClientCert := suite.mtlsSettings()
+	withoutClientCert.ClientCertFile = ""
+	withoutClientCert.ClientKeyFile = ""
+	assert.NoError(suite.T(), suite.createRoute("no-cert-route", "/no-cert", withoutClientCert))
+
+	handler := proxy.NewProxy(suite.usecase, proxy.Config{})
+	assert.Equal(suite.T(), http.StatusBadGateway, suite.get(handler, "/no-ca").Code)
+	assert.Equal(suite.T(), http.StatusBadGateway, suite.get(handler, "/no-cert").Code)
+}
+
+func (suite *UpstreamTLSTestSuite) TestInsecureSkipVerify() {
+	settings := suite.mtlsSettings()
+	settings.CAFile = ""
+	settings.InsecureSkipVerify = true
+	assert.NoError(suite.T(), suite.createRoute("insecure-route", "/", settings))
+
+	response := suite.get(proxy.NewProxy(suite.usecase, proxy.Config{}), "/orders")
+	assert.Equal(suite.T(), http.StatusOK, response.Code)
+}
+
+func (suite *UpstreamTLSTestSuite) TestTransportSharedBySameSettings() {
+	assert.NoError(suite.T(), suite.createRoute("orders-route", "/orders", suite.mtlsSettings()))
+	assert.NoError(suite.T(), suite.createRoute("invoices-route", "/invoices", suite.mtlsSettings()))
+
+	handler := proxy.NewProxy(suite.usecase, proxy.Config{})
+	for i := 0; i < 3; i++ {
+		assert.Equal(suite.T(), http.StatusOK, suite.get(handler, "/orders").Code)
+		assert.Equal(suite.T(), http.StatusOK, suite.get(handler, "/invoices").Code)
+	}
+	// Both routes reuse the same keep alive connection
+	assert.Equal(suite.T(), int64(1), suite.connections.Load())
+}
+
+func (suite *UpstreamTLSTestSuite) TestUpdateTLSOnly() {
+	assert.NoError(suite.T(), suite.createRoute("orders-route", "/", suite.mtlsSettings()))
+	handler := proxy.NewProxy(suite.usecase, proxy.Config{})
+	assert.Equal(suite.T(), http.StatusOK, suite.get(handler, "/orders").Code)
+
+	// Same backend URL, the running proxy pick up the new TLS settings
+	withoutClientCert := suite.mtlsSettings()
+	withoutClientCert.ClientCertFile = ""
+	withoutClientCert.ClientKeyFile = ""
+	isEnabled := true
+	_, err := suite.usecase.Update(suite.ctx, domain.RouteItem{
+		Name:     "orders-route",
+		Host:     "orders.example.com",
+		Path:     "/",
+		Backends: []domain.RouteBackend{{URL: suite.backend.URL, TLS: withoutClientCert}},
+		Enabled:  &isEnabled,
+	})
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), http.StatusBadGateway, suite.get(handler, "/orders").Code)
+}
+
+func (suite *UpstreamTLSTestSuite) TestValidation() {
+	missingFile := suite.mtlsSettings()
+	missingFile.CAFile = filepath.Join(suite.dir, "missing.pem")
+	assert.ErrorContains(suite.T(), suite.createRoute("missing-route", "/", missingFile), domain.ErrBadRequest)
+
+	isEnabled := true
+	_, err := suite.usecase.Create(suite.ctx, domain.RouteItem{
+		Name:     "plain-route",
+		Host:     "orders.example.com",
+		Path:     "/",
+		Backends: []domain.RouteBackend{{URL: "http://orders.internal", TLS: suite.mtlsSettings()}},
+		Enabled:  &isEnabled,
+	})
+	assert.ErrorContains(suite.T(), err, domain.ErrBadRequest)
+
+	onlyCert := suite.mtlsSettings()
+	onlyCert.ClientKeyFile = ""
+	assert.Error(suite.T(), newTestValidator().Struct(domain.RouteBackend{URL: suite.backend.URL, TLS: onlyCert}))
+
+	badVersion := suite.mtlsSettings()
+	badVersion.MinVersion = "1.4"
+	assert.Error(suite.T(), newTestValidator().Struct(domain.RouteBackend{URL: suite.backend.URL, TLS: badVersion}))
+}
+
+func TestUpstreamTLSTestSuite(t *testing.T) {
+	suite.Run(t, new(UpstreamTLSTestSuite))
+}
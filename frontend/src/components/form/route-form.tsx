@@ -25,7 +25,7 @@ const routeSchema = z.object({
     backend: z.string().url('Backend must be a valid URL'),
     path: z.string()
         .min(1, 'Path is required')
-        .regex(/^\/[a-zA-Z0-9\-\/_]*$/, 'Path must start with /'),
+        .regex(/^\/(([a-zA-Z0-9\-_]*|\{[a-zA-Z_][a-zA-Z0-9_]*\})\/)*([a-zA-Z0-9\-_]*|\{[a-zA-Z_][a-zA-Z0-9_]*\}|\*)$/, 'Path must start with /, segments may be {param} and the last one *'),
     enabled: z.boolean(),
 });
 